@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"slices"
+	"sync"
+	"time"
+)
+
+// rateAlertBuckets is the resolution of the sliding window: the window is
+// split into this many buckets and slides a bucket at a time.
+const rateAlertBuckets = 60
+
+// rateAlert counts the certificates with a name matching a pattern over a
+// sliding window of log time and fires once when the count rises above a
+// threshold, as a sudden burst of issuance for a domain can indicate a
+// compromised account or CA. It re-arms when the count falls back to the
+// threshold. Log timestamps rather than the wall clock are used so that
+// backfills do not look like bursts.
+type rateAlert struct {
+	match     *regexp.Regexp // nil matches every certificate
+	window    time.Duration
+	threshold int
+
+	mu      sync.Mutex
+	width   int64 // bucket width in nanoseconds
+	buckets [rateAlertBuckets]int
+	head    int64 // number of the newest bucket, in units of width since the epoch
+	total   int
+	firing  bool
+}
+
+func newRateAlert(match *regexp.Regexp, window time.Duration, threshold int) *rateAlert {
+	return &rateAlert{
+		match:     match,
+		window:    window,
+		threshold: threshold,
+		width:     max(1, int64(window/rateAlertBuckets)),
+	}
+}
+
+// observe records ev if it matches, returning the count within the window
+// and whether the alert fired.
+func (a *rateAlert) observe(ev *certEvent) (count int, fired bool) {
+	if !a.matches(ev) {
+		return 0, false
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	n := ev.Timestamp.UnixNano() / a.width
+	if n > a.head {
+		for i := a.head + 1; i <= n && i <= a.head+rateAlertBuckets; i++ {
+			a.total -= a.buckets[i%rateAlertBuckets]
+			a.buckets[i%rateAlertBuckets] = 0
+		}
+		a.head = n
+		if a.total <= a.threshold {
+			a.firing = false
+		}
+	} else if n <= a.head-rateAlertBuckets {
+		return a.total, false // older than the window
+	}
+	a.buckets[n%rateAlertBuckets]++
+	a.total++
+	if a.total > a.threshold && !a.firing {
+		a.firing = true
+		return a.total, true
+	}
+	return a.total, false
+}
+
+func (a *rateAlert) matches(ev *certEvent) bool {
+	if a.match == nil {
+		return true
+	}
+	return slices.ContainsFunc(certNames(ev.Cert), a.match.MatchString)
+}
+
+// writeAlert appends the alert line for a burst of count certificates,
+// the latest of which is ev.
+func (a *rateAlert) writeAlert(buf *bytes.Buffer, cfg *config, ev *certEvent, count int) {
+	buf.WriteString("Alert: ")
+	startColor(buf, cfg, ansiRed)
+	fmt.Fprintf(buf, "%d certificates", count)
+	if a.match != nil {
+		fmt.Fprintf(buf, " matching %q", a.match.String())
+	}
+	fmt.Fprintf(buf, " within %s (threshold %d)", a.window, a.threshold)
+	endColor(buf, cfg)
+	buf.WriteString(", Latest: ")
+	writeLimitedNames(buf, cfg, normalizeNames(cfg, certNames(ev.Cert)))
+	buf.WriteString(", Log: ")
+	buf.WriteString(ev.Log.Description)
+	buf.WriteByte('\n')
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/google/certificate-transparency-go/x509"
+)
+
+// hostAllowlist is the set of hostnames a user legitimately has
+// certificates for. The domains it covers are the listed names themselves
+// and everything below them: a certificate for a covered name that is not
+// listed may have been issued without the owner's knowledge.
+type hostAllowlist map[string]struct{}
+
+// loadAllowlist reads hostnames from path, one per line. Blank lines and
+// lines starting with # are ignored.
+func loadAllowlist(path string) (hostAllowlist, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	allow := make(hostAllowlist)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		allow[canonicalHost(line)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(allow) == 0 {
+		return nil, fmt.Errorf("%s lists no hostnames", path)
+	}
+	return allow, nil
+}
+
+func canonicalHost(name string) string {
+	return strings.TrimSuffix(strings.ToLower(name), ".")
+}
+
+// covers reports whether name is, or is below, a listed name. Wildcard
+// entries cover the domain they are a wildcard for.
+func (a hostAllowlist) covers(name string) bool {
+	name = strings.TrimPrefix(name, "*.")
+	for {
+		if _, ok := a[name]; ok {
+			return true
+		}
+		if _, ok := a["*."+name]; ok {
+			return true
+		}
+		_, parent, found := strings.Cut(name, ".")
+		if !found {
+			return false
+		}
+		name = parent
+	}
+}
+
+// unauthorizedNames returns the names of cert that are covered by the
+// allowlist but not listed in it.
+func (a hostAllowlist) unauthorizedNames(cert *x509.Certificate) []string {
+	var names []string
+	for _, name := range certNames(cert) {
+		name = canonicalHost(name)
+		if a.unauthorized(name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// hasUnauthorizedName reports whether unauthorizedNames would return any,
+// stopping at the first.
+func (a hostAllowlist) hasUnauthorizedName(cert *x509.Certificate) bool {
+	for _, name := range certNames(cert) {
+		if a.unauthorized(canonicalHost(name)) {
+			return true
+		}
+	}
+	return false
+}
+
+// unauthorized reports whether the canonical name is covered by the
+// allowlist but not listed in it.
+func (a hostAllowlist) unauthorized(name string) bool {
+	if _, ok := a[name]; ok {
+		return false
+	}
+	return a.covers(name)
+}
+
+// status describes how the allowlist classifies a single name: "listed",
+// "unauthorized" (covered but not listed) or "not covered".
+func (a hostAllowlist) status(name string) string {
+	name = canonicalHost(name)
+	if _, ok := a[name]; ok {
+		return "listed"
+	}
+	if a.covers(name) {
+		return "unauthorized"
+	}
+	return "not covered"
+}
+
+// allowlistFile is the -allowlist file, which is read again on SIGHUP.
+type allowlistFile struct {
+	path string
+	list atomic.Pointer[hostAllowlist]
+}
+
+func openAllowlist(path string) (*allowlistFile, error) {
+	a := &allowlistFile{path: path}
+	if err := a.reload(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// reload reads the file again. On error the current list stays in force.
+func (a *allowlistFile) reload() error {
+	list, err := loadAllowlist(a.path)
+	if err != nil {
+		return err
+	}
+	a.list.Store(&list)
+	return nil
+}
+
+// unauthorizedNames is hostAllowlist.unauthorizedNames for the current
+// list.
+func (a *allowlistFile) unauthorizedNames(cert *x509.Certificate) []string {
+	return a.list.Load().unauthorizedNames(cert)
+}
+
+// hasUnauthorizedName is hostAllowlist.hasUnauthorizedName for the current
+// list.
+func (a *allowlistFile) hasUnauthorizedName(cert *x509.Certificate) bool {
+	return a.list.Load().hasUnauthorizedName(cert)
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	ct "github.com/google/certificate-transparency-go"
+)
+
+// archiveRangeSize is the number of log indices per archive file.
+const archiveRangeSize = 100000
+
+// rawArchive writes the raw get-entries leaves of every log, before any
+// parsing, to gzipped NDJSON files under dir: one directory per log and
+// one file per archiveRangeSize indices, e.g. dir/<log>/00000000-00099999.ndjson.gz.
+// Each line holds an entry's index and its base64 leaf_input and
+// extra_data, exactly as the log served them. Each log's directory also
+// holds an archiveLogFile naming the log, for -replay to read. Runs append to existing
+// files as further gzip members, so an entry fetched more than once (after
+// a failed poll, or by a later run) can appear more than once.
+//
+// Once maxBytes of compressed data have been written, archiving stops.
+type rawArchive struct {
+	dir      string
+	maxBytes int64
+
+	mu        sync.Mutex
+	files     map[string]*archiveFile // keyed by file path
+	described map[string]bool         // log directories whose archiveLogFile was written
+	written   int64
+	full      bool
+}
+
+type archiveFile struct {
+	f  *os.File
+	gz *gzip.Writer
+}
+
+// archivedEntry is a line of an archive file.
+type archivedEntry struct {
+	Index     int64  `json:"index"`
+	LeafInput []byte `json:"leaf_input"`
+	ExtraData []byte `json:"extra_data"`
+}
+
+// archiveLogFile is the file in each log's directory that describes the
+// log, as an archivedLog.
+const archiveLogFile = "log.json"
+
+// archivedLog describes the log whose entries are in an archive directory:
+// its operator's name and its entry in the log list.
+type archivedLog struct {
+	Operator string  `json:"operator"`
+	Log      LogInfo `json:"log"`
+}
+
+func newRawArchive(dir string, maxBytes int64) (*rawArchive, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &rawArchive{dir: dir, maxBytes: maxBytes, files: make(map[string]*archiveFile), described: make(map[string]bool)}, nil
+}
+
+// write archives leaves, the entries of logInfo starting at index start.
+func (a *rawArchive) write(operator *Operator, logInfo *LogInfo, start int64, leaves []ct.LeafEntry) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var last *archiveFile
+	defer func() {
+		// Flush after every batch, so that the file is readable up to
+		// here should certtail crash.
+		if last != nil {
+			last.gz.Flush()
+		}
+	}()
+	for i := range leaves {
+		if a.full {
+			return
+		}
+		index := start + int64(i)
+		af, err := a.file(operator, logInfo, index)
+		if err != nil {
+			log.Printf("Failed to open archive file: %v", err)
+			return
+		}
+		if last != nil && last != af {
+			last.gz.Flush()
+		}
+		last = af
+		line, err := json.Marshal(archivedEntry{Index: index, LeafInput: leaves[i].LeafInput, ExtraData: leaves[i].ExtraData})
+		if err != nil {
+			continue
+		}
+		if _, err := af.gz.Write(append(line, '\n')); err != nil {
+			log.Printf("Failed to write archive file %s: %v", af.f.Name(), err)
+			return
+		}
+	}
+}
+
+// file returns the open archive file for index of logInfo, opening it as
+// needed and closing the file of the previous range. a.mu must be held.
+func (a *rawArchive) file(operator *Operator, logInfo *LogInfo, index int64) (*archiveFile, error) {
+	lo := index - index%archiveRangeSize
+	logDir := filepath.Join(a.dir, archiveDirName(logInfo.URL))
+	path := filepath.Join(logDir, fmt.Sprintf("%08d-%08d.ndjson.gz", lo, lo+archiveRangeSize-1))
+	if af, ok := a.files[path]; ok {
+		return af, nil
+	}
+	for p, af := range a.files {
+		if filepath.Dir(p) == logDir {
+			a.closeFile(p, af)
+		}
+	}
+	if err := os.MkdirAll(logDir, 0o755); err != nil {
+		return nil, err
+	}
+	if !a.described[logDir] {
+		// Rewritten once per run, so that it follows the log list.
+		described := archivedLog{Log: *logInfo}
+		if operator != nil {
+			described.Operator = operator.Name
+		}
+		desc, err := json.Marshal(described)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(filepath.Join(logDir, archiveLogFile), append(desc, '\n'), 0o644); err != nil {
+			return nil, err
+		}
+		a.described[logDir] = true
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	af := &archiveFile{f: f, gz: gzip.NewWriter(&countingWriter{w: f, a: a})}
+	a.files[path] = af
+	return af, nil
+}
+
+func (a *rawArchive) closeFile(path string, af *archiveFile) {
+	if err := af.gz.Close(); err != nil {
+		log.Printf("Failed to write archive file %s: %v", path, err)
+	}
+	af.f.Close()
+	delete(a.files, path)
+}
+
+// close flushes and closes all open archive files.
+func (a *rawArchive) close() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for path, af := range a.files {
+		a.closeFile(path, af)
+	}
+}
+
+// countingWriter counts the bytes written to the archive's files towards
+// its size limit. It is only used with a.mu held.
+type countingWriter struct {
+	w io.Writer
+	a *rawArchive
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.a.written += int64(n)
+	if c.a.maxBytes > 0 && c.a.written >= c.a.maxBytes && !c.a.full {
+		c.a.full = true
+		log.Printf("Raw archive reached -archive-max-bytes (%d bytes), no longer archiving", c.a.maxBytes)
+	}
+	return n, err
+}
+
+// archiveDirName turns a log URL into a directory name, e.g.
+// "ct.googleapis.com_logs_us1_argon2025h1" for
+// https://ct.googleapis.com/logs/us1/argon2025h1/.
+func archiveDirName(url string) string {
+	name := url
+	if _, rest, ok := strings.Cut(name, "://"); ok {
+		name = rest
+	}
+	name = strings.Trim(name, "/")
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+			return r
+		}
+		return '_'
+	}, name)
+}
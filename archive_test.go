@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestArchiveReplayRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	leaves := mockLeaves(t, 6)
+	operator := &Operator{Name: "Test"}
+	logInfo := &LogInfo{Description: "Test log", URL: "https://ct.example.com/log/"}
+
+	a, err := newRawArchive(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Index 2 is fetched twice, as after a failed poll.
+	a.write(operator, logInfo, 0, leaves[:3])
+	a.write(operator, logInfo, 2, leaves[2:5])
+	a.close()
+	// A later run appends to the same file.
+	a, err = newRawArchive(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.write(operator, logInfo, 5, leaves[5:])
+	a.close()
+
+	logs, err := archivedLogs(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 1 || logs[0].logInfo.URL != logInfo.URL || logs[0].operator == nil || logs[0].operator.Name != operator.Name {
+		t.Fatalf("archivedLogs = %+v, want the one archived log", logs)
+	}
+	files, err := archiveFiles(logs[0].dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("archiveFiles = %q, want one file", files)
+	}
+
+	cfg, _, err := parseTestFlags(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := newTestProcessor(cfg)
+	n, err := replayArchiveFile(p, files[0], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(leaves)) {
+		t.Errorf("replayed %d entries, want %d", n, len(leaves))
+	}
+	lines := strings.Split(strings.TrimSpace(p.out.String()), "\n")
+	for i := range leaves {
+		name := fmt.Sprintf("name%d.example.com", i)
+		got := 0
+		for _, line := range lines {
+			if strings.Contains(line, name) {
+				got++
+			}
+		}
+		if got != 1 {
+			t.Errorf("%s was emitted %d times, want once", name, got)
+		}
+	}
+
+	// An archive cut short, as by a crash, replays up to its last
+	// complete entry.
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	truncated := filepath.Join(t.TempDir(), filepath.Base(files[0]))
+	if err := os.WriteFile(truncated, data[:len(data)-20], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	p = newTestProcessor(cfg)
+	n, err = replayArchiveFile(p, truncated, nil)
+	if err == nil || !strings.Contains(err.Error(), "ends early") {
+		t.Errorf("replaying a truncated archive: error = %v, want one saying it ends early", err)
+	}
+	if n != int64(len(leaves)-1) {
+		t.Errorf("replayed %d entries of a truncated archive, want %d", n, len(leaves)-1)
+	}
+}
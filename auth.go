@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// headerList is a repeatable flag of "Name: value" HTTP headers.
+type headerList http.Header
+
+func (h headerList) String() string {
+	var parts []string
+	for name, values := range h {
+		for _, v := range values {
+			parts = append(parts, name+": "+v)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (h headerList) Set(v string) error {
+	name, value, ok := strings.Cut(v, ":")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" {
+		return fmt.Errorf("header must be of the form \"Name: value\"")
+	}
+	http.Header(h).Add(name, strings.TrimSpace(value))
+	return nil
+}
+
+// basicAuthorization returns the Authorization header value for HTTP basic
+// auth credentials given as "user:password".
+func basicAuthorization(credentials string) (string, error) {
+	if !strings.Contains(credentials, ":") {
+		return "", fmt.Errorf("basic auth credentials must be of the form user:password")
+	}
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(credentials)), nil
+}
+
+// headerTransport adds a fixed set of headers to every request.
+type headerTransport struct {
+	base    http.RoundTripper
+	headers http.Header
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTrippers must not modify the caller's request.
+	req = req.Clone(req.Context())
+	for name, values := range t.headers {
+		req.Header[name] = append([]string(nil), values...)
+	}
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,90 @@
+package main
+
+import "time"
+
+type breakerState int
+
+const (
+	breakerClosed   breakerState = iota // polling normally
+	breakerOpen                         // polling suspended until the cooldown ends
+	breakerHalfOpen                     // cooldown over, probing the log again
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerClosed:
+		return "closed"
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// circuitBreaker stops a monitor from polling a log that keeps failing.
+// After threshold consecutive failed polls the breaker opens and polls are
+// skipped for the cooldown; the next poll after that is a probe which either
+// closes the breaker again or re-opens it for another cooldown.
+//
+// A circuitBreaker is owned by a single monitor goroutine and is not safe for
+// concurrent use. A zero threshold disables it.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	state    breakerState
+	failures int
+	openedAt time.Time
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown}
+}
+
+// allow reports whether the log may be polled at now.
+func (b *circuitBreaker) allow(now time.Time) bool {
+	if b.state == breakerOpen {
+		if now.Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = breakerHalfOpen
+	}
+	return true
+}
+
+// success records a successful poll and returns the state the breaker was in.
+func (b *circuitBreaker) success() breakerState {
+	prev := b.state
+	b.state = breakerClosed
+	b.failures = 0
+	return prev
+}
+
+// failure records a failed poll and reports whether it (re-)opened the
+// breaker.
+func (b *circuitBreaker) failure(now time.Time) bool {
+	if b.threshold <= 0 {
+		return false
+	}
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= b.threshold {
+		b.state = breakerOpen
+		b.openedAt = now
+		return true
+	}
+	return false
+}
+
+// trip opens the breaker at once, for failures that retrying will not fix,
+// and reports whether it did.
+func (b *circuitBreaker) trip(now time.Time) bool {
+	if b.threshold <= 0 {
+		return false
+	}
+	b.failures++
+	b.state = breakerOpen
+	b.openedAt = now
+	return true
+}
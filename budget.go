@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// requestBudget is a token bucket shared by all monitors that caps the
+// number of requests sent to the logs per minute. It holds up to a
+// minute's worth of tokens and refills continuously, so short bursts
+// (catching up after a pause) are allowed as long as the average stays
+// within the budget.
+type requestBudget struct {
+	perMinute int
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+
+	requests atomic.Uint64
+	waitNs   atomic.Int64 // total time spent waiting for tokens
+}
+
+func newRequestBudget(perMinute int) *requestBudget {
+	return &requestBudget{perMinute: perMinute, tokens: float64(perMinute), last: time.Now()}
+}
+
+// refill adds the tokens accrued since the last call. b.mu must be held.
+func (b *requestBudget) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Minutes() * float64(b.perMinute)
+	b.tokens = min(b.tokens, float64(b.perMinute))
+	b.last = now
+}
+
+// wait blocks until a request may be sent or ctx is done.
+func (b *requestBudget) wait(ctx context.Context) error {
+	start := time.Now()
+	defer func() { b.waitNs.Add(int64(time.Since(start))) }()
+	for {
+		b.mu.Lock()
+		b.refill(time.Now())
+		if b.tokens >= 1 {
+			b.tokens--
+			b.mu.Unlock()
+			b.requests.Add(1)
+			return nil
+		}
+		delay := time.Duration((1 - b.tokens) / float64(b.perMinute) * float64(time.Minute))
+		b.mu.Unlock()
+
+		t := time.NewTimer(delay)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// budgetStats is the request budget's state as reported on /status.
+type budgetStats struct {
+	PerMinute int `json:"per_minute"`
+	// Utilization is the fraction of the bucket currently used up: 0 when
+	// no requests were sent in the last minute, 1 when monitors are
+	// waiting for the budget.
+	Utilization float64 `json:"utilization"`
+	Requests    uint64  `json:"requests"`
+	WaitSeconds float64 `json:"wait_seconds"`
+}
+
+func (b *requestBudget) stats() budgetStats {
+	b.mu.Lock()
+	b.refill(time.Now())
+	utilization := 1 - max(b.tokens, 0)/float64(b.perMinute)
+	b.mu.Unlock()
+	return budgetStats{
+		PerMinute:   b.perMinute,
+		Utilization: utilization,
+		Requests:    b.requests.Load(),
+		WaitSeconds: time.Duration(b.waitNs.Load()).Seconds(),
+	}
+}
+
+// budgetTransport makes every request wait for the request budget.
+type budgetTransport struct {
+	base   http.RoundTripper
+	budget *requestBudget
+}
+
+func (t *budgetTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.budget.wait(req.Context()); err != nil {
+		return nil, err
+	}
+	return t.base.RoundTrip(req)
+}
+
+// rateLimiter is the -rate-limit token bucket of a single log. Unlike the
+// request budget it holds only a second's worth of tokens (at least one),
+// so that a monitor catching up does not burst past the log's limit.
+type rateLimiter struct {
+	perSecond float64
+	burst     float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(perSecond float64) *rateLimiter {
+	burst := max(perSecond, 1)
+	return &rateLimiter{perSecond: perSecond, burst: burst, tokens: burst, last: time.Now()}
+}
+
+// wait blocks until a request may be sent or ctx is done.
+func (l *rateLimiter) wait(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.perSecond)
+		l.last = now
+		if l.tokens >= 1 {
+			l.tokens--
+			l.mu.Unlock()
+			return nil
+		}
+		delay := time.Duration((1 - l.tokens) / l.perSecond * float64(time.Second))
+		l.mu.Unlock()
+
+		t := time.NewTimer(delay)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// rateLimitTransport makes every request to a log wait for its rate limit.
+type rateLimitTransport struct {
+	base    http.RoundTripper
+	limiter *rateLimiter
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.limiter.wait(req.Context()); err != nil {
+		return nil, err
+	}
+	return t.base.RoundTrip(req)
+}
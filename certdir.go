@@ -0,0 +1,71 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// runCertDirSink writes every final certificate from sub to dir as
+// <sha256>.pem, in a subdirectory named after the first two hex digits of
+// the fingerprint so that no directory grows too large. Certificates whose
+// file already exists are skipped, so the directory doubles as a
+// deduplicated corpus across runs. Precertificates are not written, as their
+// TBSCertificate is not a certificate.
+func runCertDirSink(dir string, sub *subscription) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	go func() {
+		var failed int
+		for ev := range sub.C {
+			if ev.Precert {
+				continue
+			}
+			if err := writeCertFile(dir, ev.Cert.Raw); err != nil {
+				// Only log the first few failures, e.g. for a full disk.
+				if failed++; failed <= 10 {
+					log.Printf("Failed to write certificate to %s: %v", dir, err)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// writeCertFile writes der as PEM to its fingerprint's file under dir
+// unless that file already exists. The file is written under a
+// temporary name and renamed, so a crash never leaves a truncated one.
+func writeCertFile(dir string, der []byte) error {
+	sum := sha256.Sum256(der)
+	name := hex.EncodeToString(sum[:])
+	sub := filepath.Join(dir, name[:2])
+	path := filepath.Join(sub, name+".pem")
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err := os.MkdirAll(sub, 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(sub, name+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+	if err := pem.Encode(tmp, &pem.Block{Type: "CERTIFICATE", Bytes: der}); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,299 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        v5.29.3
+// source: certtail.proto
+
+package certtailpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type StreamEventsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamEventsRequest) Reset() {
+	*x = StreamEventsRequest{}
+	mi := &file_certtail_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamEventsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamEventsRequest) ProtoMessage() {}
+
+func (x *StreamEventsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_certtail_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamEventsRequest.ProtoReflect.Descriptor instead.
+func (*StreamEventsRequest) Descriptor() ([]byte, []int) {
+	return file_certtail_proto_rawDescGZIP(), []int{0}
+}
+
+// CertEvent is a certificate observed in a CT log.
+type CertEvent struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Time the entry was added to the log.
+	Timestamp *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	// Issuer distinguished name.
+	Issuer string `protobuf:"bytes,2,opt,name=issuer,proto3" json:"issuer,omitempty"`
+	// DNS names, or the subject common name if the certificate has none.
+	Names []string `protobuf:"bytes,3,rep,name=names,proto3" json:"names,omitempty"`
+	// Serial number as colon-separated hex.
+	Serial         string                 `protobuf:"bytes,4,opt,name=serial,proto3" json:"serial,omitempty"`
+	NotBefore      *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=not_before,json=notBefore,proto3" json:"not_before,omitempty"`
+	NotAfter       *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=not_after,json=notAfter,proto3" json:"not_after,omitempty"`
+	LogUrl         string                 `protobuf:"bytes,7,opt,name=log_url,json=logUrl,proto3" json:"log_url,omitempty"`
+	LogDescription string                 `protobuf:"bytes,8,opt,name=log_description,json=logDescription,proto3" json:"log_description,omitempty"`
+	Operator       string                 `protobuf:"bytes,9,opt,name=operator,proto3" json:"operator,omitempty"`
+	// DER encoding of the certificate; for precertificates, of the
+	// TBSCertificate.
+	Der []byte `protobuf:"bytes,10,opt,name=der,proto3" json:"der,omitempty"`
+	// Issuer organization (O) and common name (CN), for grouping by CA
+	// without parsing the distinguished name.
+	IssuerOrganization []string `protobuf:"bytes,11,rep,name=issuer_organization,json=issuerOrganization,proto3" json:"issuer_organization,omitempty"`
+	IssuerCommonName   string   `protobuf:"bytes,12,opt,name=issuer_common_name,json=issuerCommonName,proto3" json:"issuer_common_name,omitempty"`
+	// Whether the entry is a precertificate rather than a final certificate.
+	Precert bool `protobuf:"varint,13,opt,name=precert,proto3" json:"precert,omitempty"`
+	// The -label of the certtail instance that emitted the event.
+	Label         string `protobuf:"bytes,14,opt,name=label,proto3" json:"label,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CertEvent) Reset() {
+	*x = CertEvent{}
+	mi := &file_certtail_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CertEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CertEvent) ProtoMessage() {}
+
+func (x *CertEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_certtail_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CertEvent.ProtoReflect.Descriptor instead.
+func (*CertEvent) Descriptor() ([]byte, []int) {
+	return file_certtail_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *CertEvent) GetTimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Timestamp
+	}
+	return nil
+}
+
+func (x *CertEvent) GetIssuer() string {
+	if x != nil {
+		return x.Issuer
+	}
+	return ""
+}
+
+func (x *CertEvent) GetNames() []string {
+	if x != nil {
+		return x.Names
+	}
+	return nil
+}
+
+func (x *CertEvent) GetSerial() string {
+	if x != nil {
+		return x.Serial
+	}
+	return ""
+}
+
+func (x *CertEvent) GetNotBefore() *timestamppb.Timestamp {
+	if x != nil {
+		return x.NotBefore
+	}
+	return nil
+}
+
+func (x *CertEvent) GetNotAfter() *timestamppb.Timestamp {
+	if x != nil {
+		return x.NotAfter
+	}
+	return nil
+}
+
+func (x *CertEvent) GetLogUrl() string {
+	if x != nil {
+		return x.LogUrl
+	}
+	return ""
+}
+
+func (x *CertEvent) GetLogDescription() string {
+	if x != nil {
+		return x.LogDescription
+	}
+	return ""
+}
+
+func (x *CertEvent) GetOperator() string {
+	if x != nil {
+		return x.Operator
+	}
+	return ""
+}
+
+func (x *CertEvent) GetDer() []byte {
+	if x != nil {
+		return x.Der
+	}
+	return nil
+}
+
+func (x *CertEvent) GetIssuerOrganization() []string {
+	if x != nil {
+		return x.IssuerOrganization
+	}
+	return nil
+}
+
+func (x *CertEvent) GetIssuerCommonName() string {
+	if x != nil {
+		return x.IssuerCommonName
+	}
+	return ""
+}
+
+func (x *CertEvent) GetPrecert() bool {
+	if x != nil {
+		return x.Precert
+	}
+	return false
+}
+
+func (x *CertEvent) GetLabel() string {
+	if x != nil {
+		return x.Label
+	}
+	return ""
+}
+
+var File_certtail_proto protoreflect.FileDescriptor
+
+const file_certtail_proto_rawDesc = "" +
+	"\n" +
+	"\x0ecerttail.proto\x12\vcerttail.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\x15\n" +
+	"\x13StreamEventsRequest\"\xfe\x03\n" +
+	"\tCertEvent\x128\n" +
+	"\ttimestamp\x18\x01 \x01(\v2\x1a.google.protobuf.TimestampR\ttimestamp\x12\x16\n" +
+	"\x06issuer\x18\x02 \x01(\tR\x06issuer\x12\x14\n" +
+	"\x05names\x18\x03 \x03(\tR\x05names\x12\x16\n" +
+	"\x06serial\x18\x04 \x01(\tR\x06serial\x129\n" +
+	"\n" +
+	"not_before\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\tnotBefore\x127\n" +
+	"\tnot_after\x18\x06 \x01(\v2\x1a.google.protobuf.TimestampR\bnotAfter\x12\x17\n" +
+	"\alog_url\x18\a \x01(\tR\x06logUrl\x12'\n" +
+	"\x0flog_description\x18\b \x01(\tR\x0elogDescription\x12\x1a\n" +
+	"\boperator\x18\t \x01(\tR\boperator\x12\x10\n" +
+	"\x03der\x18\n" +
+	" \x01(\fR\x03der\x12/\n" +
+	"\x13issuer_organization\x18\v \x03(\tR\x12issuerOrganization\x12,\n" +
+	"\x12issuer_common_name\x18\f \x01(\tR\x10issuerCommonName\x12\x18\n" +
+	"\aprecert\x18\r \x01(\bR\aprecert\x12\x14\n" +
+	"\x05label\x18\x0e \x01(\tR\x05label2V\n" +
+	"\bCertTail\x12J\n" +
+	"\fStreamEvents\x12 .certtail.v1.StreamEventsRequest\x1a\x16.certtail.v1.CertEvent0\x01B(Z&github.com/artooro/certtail/certtailpbb\x06proto3"
+
+var (
+	file_certtail_proto_rawDescOnce sync.Once
+	file_certtail_proto_rawDescData []byte
+)
+
+func file_certtail_proto_rawDescGZIP() []byte {
+	file_certtail_proto_rawDescOnce.Do(func() {
+		file_certtail_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_certtail_proto_rawDesc), len(file_certtail_proto_rawDesc)))
+	})
+	return file_certtail_proto_rawDescData
+}
+
+var file_certtail_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_certtail_proto_goTypes = []any{
+	(*StreamEventsRequest)(nil),   // 0: certtail.v1.StreamEventsRequest
+	(*CertEvent)(nil),             // 1: certtail.v1.CertEvent
+	(*timestamppb.Timestamp)(nil), // 2: google.protobuf.Timestamp
+}
+var file_certtail_proto_depIdxs = []int32{
+	2, // 0: certtail.v1.CertEvent.timestamp:type_name -> google.protobuf.Timestamp
+	2, // 1: certtail.v1.CertEvent.not_before:type_name -> google.protobuf.Timestamp
+	2, // 2: certtail.v1.CertEvent.not_after:type_name -> google.protobuf.Timestamp
+	0, // 3: certtail.v1.CertTail.StreamEvents:input_type -> certtail.v1.StreamEventsRequest
+	1, // 4: certtail.v1.CertTail.StreamEvents:output_type -> certtail.v1.CertEvent
+	4, // [4:5] is the sub-list for method output_type
+	3, // [3:4] is the sub-list for method input_type
+	3, // [3:3] is the sub-list for extension type_name
+	3, // [3:3] is the sub-list for extension extendee
+	0, // [0:3] is the sub-list for field type_name
+}
+
+func init() { file_certtail_proto_init() }
+func file_certtail_proto_init() {
+	if File_certtail_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_certtail_proto_rawDesc), len(file_certtail_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   2,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_certtail_proto_goTypes,
+		DependencyIndexes: file_certtail_proto_depIdxs,
+		MessageInfos:      file_certtail_proto_msgTypes,
+	}.Build()
+	File_certtail_proto = out.File
+	file_certtail_proto_goTypes = nil
+	file_certtail_proto_depIdxs = nil
+}
@@ -0,0 +1,134 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.29.3
+// source: certtail.proto
+
+package certtailpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	CertTail_StreamEvents_FullMethodName = "/certtail.v1.CertTail/StreamEvents"
+)
+
+// CertTailClient is the client API for CertTail service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// CertTail streams the certificates certtail observes in CT logs.
+type CertTailClient interface {
+	// StreamEvents sends every certificate event emitted from the time the
+	// stream is opened until the client disconnects or certtail shuts down.
+	// Events are dropped for clients that fall too far behind.
+	StreamEvents(ctx context.Context, in *StreamEventsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[CertEvent], error)
+}
+
+type certTailClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewCertTailClient(cc grpc.ClientConnInterface) CertTailClient {
+	return &certTailClient{cc}
+}
+
+func (c *certTailClient) StreamEvents(ctx context.Context, in *StreamEventsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[CertEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &CertTail_ServiceDesc.Streams[0], CertTail_StreamEvents_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[StreamEventsRequest, CertEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type CertTail_StreamEventsClient = grpc.ServerStreamingClient[CertEvent]
+
+// CertTailServer is the server API for CertTail service.
+// All implementations must embed UnimplementedCertTailServer
+// for forward compatibility.
+//
+// CertTail streams the certificates certtail observes in CT logs.
+type CertTailServer interface {
+	// StreamEvents sends every certificate event emitted from the time the
+	// stream is opened until the client disconnects or certtail shuts down.
+	// Events are dropped for clients that fall too far behind.
+	StreamEvents(*StreamEventsRequest, grpc.ServerStreamingServer[CertEvent]) error
+	mustEmbedUnimplementedCertTailServer()
+}
+
+// UnimplementedCertTailServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedCertTailServer struct{}
+
+func (UnimplementedCertTailServer) StreamEvents(*StreamEventsRequest, grpc.ServerStreamingServer[CertEvent]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamEvents not implemented")
+}
+func (UnimplementedCertTailServer) mustEmbedUnimplementedCertTailServer() {}
+func (UnimplementedCertTailServer) testEmbeddedByValue()                  {}
+
+// UnsafeCertTailServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to CertTailServer will
+// result in compilation errors.
+type UnsafeCertTailServer interface {
+	mustEmbedUnimplementedCertTailServer()
+}
+
+func RegisterCertTailServer(s grpc.ServiceRegistrar, srv CertTailServer) {
+	// If the following call pancis, it indicates UnimplementedCertTailServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&CertTail_ServiceDesc, srv)
+}
+
+func _CertTail_StreamEvents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamEventsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CertTailServer).StreamEvents(m, &grpc.GenericServerStream[StreamEventsRequest, CertEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type CertTail_StreamEventsServer = grpc.ServerStreamingServer[CertEvent]
+
+// CertTail_ServiceDesc is the grpc.ServiceDesc for CertTail service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var CertTail_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "certtail.v1.CertTail",
+	HandlerType: (*CertTailServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamEvents",
+			Handler:       _CertTail_StreamEvents_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "certtail.proto",
+}
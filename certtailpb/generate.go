@@ -0,0 +1,5 @@
+// Package certtailpb contains the protobuf and gRPC definitions of the
+// certtail event stream.
+package certtailpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative certtail.proto
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/google/certificate-transparency-go/x509"
+)
+
+// parseChain parses the issuing chain of a log entry, for -chain. A
+// certificate that fails to parse ends the chain, with the error.
+func parseChain(ders [][]byte) ([]*x509.Certificate, error) {
+	chain := make([]*x509.Certificate, 0, len(ders))
+	for i, der := range ders {
+		cert, err := x509.ParseCertificate(der)
+		if x509.IsFatal(err) {
+			return chain, fmt.Errorf("chain certificate %d: %w", i+1, err)
+		}
+		chain = append(chain, cert)
+	}
+	return chain, nil
+}
+
+// chainSubjects returns the subject DNs of a chain.
+func chainSubjects(chain []*x509.Certificate) []string {
+	subjects := make([]string, len(chain))
+	for i, cert := range chain {
+		subjects[i] = cert.Subject.String()
+	}
+	return subjects
+}
+
+// writeChain appends the subject DNs of a chain to buf, separated by "; "
+// since DNs contain commas.
+func writeChain(buf *bytes.Buffer, chain []*x509.Certificate) {
+	for i, cert := range chain {
+		if i > 0 {
+			buf.WriteString("; ")
+		}
+		buf.WriteString(cert.Subject.String())
+	}
+}
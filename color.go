@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"os"
+)
+
+// ANSI SGR sequences used by -color.
+const (
+	ansiReset  = "\x1b[0m"
+	ansiDim    = "\x1b[2m"
+	ansiRed    = "\x1b[31m"
+	ansiGreen  = "\x1b[32m"
+	ansiYellow = "\x1b[33m"
+	ansiCyan   = "\x1b[36m"
+)
+
+// colorEnabled decides whether -color output should actually be colored:
+// only when stdout is a terminal and the NO_COLOR convention
+// (https://no-color.org) is not in effect.
+func colorEnabled(requested bool) bool {
+	if !requested || os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	fi, err := os.Stdout.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// startColor and endColor wrap a field in an ANSI color when enabled.
+func startColor(buf *bytes.Buffer, cfg *config, color string) {
+	if cfg.colorize {
+		buf.WriteString(color)
+	}
+}
+
+func endColor(buf *bytes.Buffer, cfg *config) {
+	if cfg.colorize {
+		buf.WriteString(ansiReset)
+	}
+}
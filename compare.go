@@ -0,0 +1,149 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// comparedCert is a certificate seen in at least one of the compared logs
+// and waiting for the others.
+type comparedCert struct {
+	first   time.Time
+	seen    map[string]bool // compared log URLs
+	names   []string
+	precert bool
+}
+
+// logComparison tracks, for -compare-logs, which of a set of logs each
+// certificate has been seen in.
+type logComparison struct {
+	logs   []string          // normalized URLs
+	titles map[string]string // URL -> description, once seen
+	window time.Duration
+
+	pending map[[sha256.Size]byte]*comparedCert
+}
+
+func newLogComparison(urls []string, window time.Duration) *logComparison {
+	c := &logComparison{
+		titles:  make(map[string]string),
+		window:  window,
+		pending: make(map[[sha256.Size]byte]*comparedCert),
+	}
+	for _, url := range urls {
+		c.logs = append(c.logs, strings.TrimSuffix(url, "/"))
+	}
+	return c
+}
+
+// observe records ev. Certificates seen in every compared log are done
+// with; the others wait for sweep.
+func (c *logComparison) observe(ev *certEvent, now time.Time) {
+	url := strings.TrimSuffix(ev.Log.URL, "/")
+	compared := false
+	for _, l := range c.logs {
+		compared = compared || l == url
+	}
+	if !compared {
+		return
+	}
+	c.titles[url] = ev.Log.Description
+	fp := sha256.Sum256(ev.Cert.Raw)
+	p, ok := c.pending[fp]
+	if !ok {
+		p = &comparedCert{first: now, seen: make(map[string]bool), names: certNames(ev.Cert), precert: ev.Precert}
+		c.pending[fp] = p
+	}
+	p.seen[url] = true
+	if len(p.seen) == len(c.logs) {
+		delete(c.pending, fp)
+	}
+}
+
+// sweep reports and forgets the certificates that are still missing from
+// some of the logs a window after they were first seen.
+func (c *logComparison) sweep(now time.Time) {
+	for fp, p := range c.pending {
+		if now.Sub(p.first) < c.window {
+			continue
+		}
+		delete(c.pending, fp)
+		var seen, missing []string
+		for _, l := range c.logs {
+			if p.seen[l] {
+				seen = append(seen, c.title(l))
+			} else {
+				missing = append(missing, c.title(l))
+				metrics.count(metricCompareMissing, 1, c.title(l))
+			}
+		}
+		sort.Strings(seen)
+		sort.Strings(missing)
+		what := "Certificate"
+		if p.precert {
+			what = "Precertificate"
+		}
+		log.Printf("Log comparison: %s %s for %s is in %s but not in %s within %s", what, hex.EncodeToString(fp[:]), strings.Join(p.names, ", "), strings.Join(seen, ", "), strings.Join(missing, ", "), c.window)
+	}
+}
+
+func (c *logComparison) title(url string) string {
+	if title, ok := c.titles[url]; ok {
+		return title
+	}
+	return url
+}
+
+// checkCompareLogs checks that the logs to compare are monitored and that
+// nothing else drops some of their certificates and not others.
+func checkCompareLogs(cfg *config, logs []LogInfo) error {
+	monitored := make(map[string]bool)
+	for _, l := range logs {
+		monitored[strings.TrimSuffix(l.URL, "/")] = true
+	}
+	for _, url := range cfg.CompareLogs {
+		if !monitored[strings.TrimSuffix(url, "/")] {
+			return fmt.Errorf("-compare-logs: %s is not one of the monitored logs", url)
+		}
+	}
+	if cfg.Dedup {
+		return errors.New("-compare-logs cannot be combined with -dedup, which hides the copies in the other logs")
+	}
+	if cfg.SampleRate < 1 {
+		return errors.New("-compare-logs cannot be combined with -sample-rate, which samples each log differently")
+	}
+	return nil
+}
+
+// runCompareSink compares the logs in cfg.CompareLogs over the events from
+// sub until it is closed. Certificates still within their window at that
+// point are not reported.
+func runCompareSink(cfg *config, sub *subscription) {
+	c := newLogComparison(cfg.CompareLogs, cfg.CompareWindow)
+	go func() {
+		ticker := time.NewTicker(max(cfg.CompareWindow/10, time.Second))
+		defer ticker.Stop()
+		for {
+			select {
+			case ev, ok := <-sub.C:
+				if !ok {
+					if len(c.pending) > 0 {
+						log.Printf("Log comparison: %d certificates were still within -compare-window at shutdown", len(c.pending))
+					}
+					return
+				}
+				if ev.Log != nil && ev.Cert != nil {
+					c.observe(ev, time.Now())
+				}
+			case now := <-ticker.C:
+				c.sweep(now)
+			}
+		}
+	}()
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"strings"
+	"testing"
+)
+
+// parseTestFlags defines certtail's flags on a fresh flag.CommandLine,
+// parses args and checks them with normalizeConfig.
+func parseTestFlags(t testing.TB, args ...string) (*config, []string, error) {
+	t.Helper()
+	saved := flag.CommandLine
+	t.Cleanup(func() { flag.CommandLine = saved })
+	flag.CommandLine = flag.NewFlagSet("certtail", flag.ContinueOnError)
+	flag.CommandLine.SetOutput(io.Discard) // errors are returned, not printed with the usage
+	cfg := defineFlags()
+	if err := flag.CommandLine.Parse(args); err != nil {
+		return nil, nil, err
+	}
+	warnings, err := normalizeConfig(flag.CommandLine, cfg)
+	return cfg, warnings, err
+}
+
+func TestNormalizeConfig(t *testing.T) {
+	tests := []struct {
+		name         string
+		args         []string
+		wantWarnings int
+		wantErr      string
+		check        func(*config) bool
+	}{
+		{name: "defaults", check: func(cfg *config) bool { return cfg.BatchSize == 1024 && cfg.ShardCount == 1 }},
+		{name: "zero positive flag falls back to its default", args: []string{"-batch-size=0"}, wantWarnings: 1, check: func(cfg *config) bool { return cfg.BatchSize == 1024 }},
+		{name: "negative positive flags", args: []string{"-batch-size=-5", "-stall-threshold=-1m"}, wantWarnings: 2, check: func(cfg *config) bool { return cfg.BatchSize == 1024 && cfg.StallThreshold > 0 }},
+		{name: "zero non-negative flag", args: []string{"-max-names=0"}, check: func(cfg *config) bool { return cfg.MaxNames == 0 }},
+		{name: "negative non-negative flag", args: []string{"-max-names=-1"}, wantErr: "-max-names must not be negative"},
+		{name: "negative duration", args: []string{"-dedup-window=-1h"}, wantErr: "-dedup-window must not be negative"},
+		{name: "flag without its pair", args: []string{"-dedup-window=1h"}, wantErr: "-dedup-window needs -dedup"},
+		{name: "flag with its pair", args: []string{"-dedup", "-dedup-window=1h"}, check: func(cfg *config) bool { return cfg.Dedup && cfg.DedupWindow > 0 }},
+		{name: "from-now without a state file", args: []string{"-from-now"}, wantErr: "-from-now needs -state-file"},
+		{name: "from-now and start-index", args: []string{"-state-file=state.json", "-from-now", "-start-index=5"}, wantErr: "-from-now and -start-index"},
+		{name: "shard index out of range", args: []string{"-shard-count=2", "-shard-index=2"}, wantErr: "-shard-index must be between 0 and 1"},
+		{name: "shard index in range", args: []string{"-shard-count=2", "-shard-index=1"}, check: func(cfg *config) bool { return cfg.ShardIndex == 1 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, warnings, err := parseTestFlags(t, tt.args...)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(warnings) != tt.wantWarnings {
+				t.Errorf("warnings = %q, want %d", warnings, tt.wantWarnings)
+			}
+			if tt.check != nil && !tt.check(cfg) {
+				t.Errorf("unexpected settings after normalizing %q", tt.args)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	ct "github.com/google/certificate-transparency-go"
+	"github.com/transparency-dev/merkle/proof"
+	"github.com/transparency-dev/merkle/rfc6962"
+)
+
+// errInconsistent marks a failure of the log to prove that a new tree head
+// extends an older one. Unlike fetch errors this is evidence of a
+// misbehaving log, such as one presenting a split view.
+type errInconsistent struct {
+	err error
+}
+
+func (e errInconsistent) Error() string { return e.err.Error() }
+func (e errInconsistent) Unwrap() error { return e.err }
+
+// verifyConsistency fetches and checks the consistency proof between two
+// tree heads of a log. It returns an errInconsistent if the proof does not
+// verify, and a plain error if the proof could not be fetched.
+func verifyConsistency(ctx context.Context, logClient ctLog, prev, cur *ct.SignedTreeHead) error {
+	switch {
+	case cur.TreeSize < prev.TreeSize:
+		return errInconsistent{fmt.Errorf("tree size went backwards from %d to %d", prev.TreeSize, cur.TreeSize)}
+	case cur.TreeSize == prev.TreeSize:
+		if !bytes.Equal(cur.SHA256RootHash[:], prev.SHA256RootHash[:]) {
+			return errInconsistent{fmt.Errorf("two different root hashes for tree size %d", cur.TreeSize)}
+		}
+		return nil
+	case prev.TreeSize == 0:
+		// Every tree is consistent with the empty tree.
+		return nil
+	}
+
+	consistency, err := logClient.GetSTHConsistency(ctx, prev.TreeSize, cur.TreeSize)
+	if err != nil {
+		return fmt.Errorf("failed to get consistency proof: %w", err)
+	}
+	if err := proof.VerifyConsistency(rfc6962.DefaultHasher, prev.TreeSize, cur.TreeSize, consistency,
+		prev.SHA256RootHash[:], cur.SHA256RootHash[:]); err != nil {
+		return errInconsistent{fmt.Errorf("consistency proof between tree sizes %d and %d does not verify: %w", prev.TreeSize, cur.TreeSize, err)}
+	}
+	return nil
+}
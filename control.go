@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// pauseState records which monitors have been paused through the control
+// endpoint. Paused monitors skip their polls but keep their position, so
+// they pick up where they left off once resumed.
+type pauseState struct {
+	mu   sync.RWMutex
+	all  bool
+	logs map[string]bool // keyed by log URL
+}
+
+func newPauseState() *pauseState {
+	return &pauseState{logs: make(map[string]bool)}
+}
+
+// isPaused reports whether the monitor for the log at url should skip polls.
+func (p *pauseState) isPaused(url string) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.all || p.logs[url]
+}
+
+// setAll pauses or resumes every monitor. Resuming also clears any per-log
+// pauses.
+func (p *pauseState) setAll(paused bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.all = paused
+	if !paused {
+		clear(p.logs)
+	}
+}
+
+// setLog pauses or resumes a single monitor.
+func (p *pauseState) setLog(url string, paused bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if paused {
+		p.logs[url] = true
+	} else {
+		delete(p.logs, url)
+	}
+}
+
+// startControlServer serves the /pause and /resume endpoints on addr, along
+// with /status and /healthz. Pause and resume accept an optional log
+// parameter (the log's URL or description) to act on a single monitor
+// instead of all of them; logs returns the logs being monitored.
+func startControlServer(addr string, cfg *config, pause *pauseState, status *statusBoard, logs func() []LogInfo) (*http.Server, error) {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	mux := http.NewServeMux()
+	handle := func(paused bool) http.HandlerFunc {
+		action := "resumed"
+		if paused {
+			action = "paused"
+		}
+		return func(w http.ResponseWriter, r *http.Request) {
+			name := r.FormValue("log")
+			if name == "" {
+				pause.setAll(paused)
+				log.Printf("All monitors %s", action)
+				fmt.Fprintf(w, "all logs %s\n", action)
+				return
+			}
+			for _, logInfo := range logs() {
+				if logInfo.URL == name || logInfo.Description == name {
+					pause.setLog(logInfo.URL, paused)
+					log.Printf("Monitor for %s %s", logInfo.Description, action)
+					fmt.Fprintf(w, "%s %s\n", logInfo.Description, action)
+					if !paused && pause.isPaused(logInfo.URL) {
+						fmt.Fprintf(w, "all logs are still paused\n")
+					}
+					return
+				}
+			}
+			http.Error(w, fmt.Sprintf("unknown log %q", name), http.StatusNotFound)
+		}
+	}
+	mux.HandleFunc("POST /pause", handle(true))
+	mux.HandleFunc("POST /resume", handle(false))
+	serveStatus(mux, status, pause, cfg.StallThreshold)
+
+	srv := &http.Server{Handler: mux}
+	go func() {
+		if err := srv.Serve(lis); err != nil && err != http.ErrServerClosed {
+			log.Printf("Control server stopped: %v", err)
+		}
+	}()
+	log.Printf("Serving control endpoints on %s", lis.Addr())
+	return srv, nil
+}
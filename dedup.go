@@ -0,0 +1,257 @@
+package main
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/certificate-transparency-go/x509"
+)
+
+// fingerprint is the SHA-256 hash of a certificate's DER encoding.
+type fingerprint [sha256.Size]byte
+
+// dedupCounts tallies what the deduplicator did for a log.
+type dedupCounts struct {
+	Unique     uint64
+	Duplicates uint64
+}
+
+// Values of -dedup-by.
+const (
+	dedupByCert   = "cert"
+	dedupBySerial = "serial"
+)
+
+// dedupKey returns what identifies cert for -dedup: its DER encoding, or
+// with -dedup-by serial its issuer and serial, which a precertificate
+// shares with its final certificate.
+func dedupKey(cfg *config, cert *x509.Certificate) []byte {
+	if cfg.DedupBy == dedupBySerial {
+		key := serialKey(cert, false)
+		return key[:]
+	}
+	return cert.Raw
+}
+
+// dedupShards is the number of independently locked shards a
+// deduplicator's fingerprints are spread over, by their first byte, so that
+// monitors checking different certificates rarely wait for each other.
+const dedupShards = 32
+
+// deduplicator suppresses certificates that were already emitted, typically
+// because the same certificate was submitted to several logs. By default it
+// remembers the most recent size fingerprints, evicting the least recently
+// seen; with a window it instead remembers every fingerprint for that long
+// after it was last seen, however many there are.
+//
+// Every monitor checks every certificate it emits, so the fingerprints are
+// split into shards with a lock each rather than sharing one lock. SHA-256
+// fingerprints spread evenly, so each shard evicts its least recently seen
+// once it holds its share of size, which keeps the bound of size overall
+// (rounded up to a multiple of dedupShards).
+type deduplicator struct {
+	shards [dedupShards]dedupShard
+
+	countsMu sync.RWMutex
+	counts   map[string]*dedupCounters // keyed by log description
+
+	window time.Duration
+}
+
+type dedupShard struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List // of fingerprint, most recently seen first
+	entries map[fingerprint]*list.Element
+
+	expiry map[fingerprint]time.Time // with a window, instead of order/entries
+}
+
+// dedupCounters is the live form of dedupCounts, updated without a lock.
+type dedupCounters struct {
+	unique, duplicates atomic.Uint64
+}
+
+func newDeduplicator(size int) *deduplicator {
+	d := &deduplicator{counts: make(map[string]*dedupCounters)}
+	for i := range d.shards {
+		d.shards[i] = dedupShard{
+			size:    (size + dedupShards - 1) / dedupShards,
+			order:   list.New(),
+			entries: make(map[fingerprint]*list.Element),
+		}
+	}
+	return d
+}
+
+// newWindowDeduplicator returns a deduplicator that suppresses fingerprints
+// seen within the last window. Call expireEvery to free expired ones.
+func newWindowDeduplicator(window time.Duration) *deduplicator {
+	d := &deduplicator{window: window, counts: make(map[string]*dedupCounters)}
+	for i := range d.shards {
+		d.shards[i].expiry = make(map[fingerprint]time.Time)
+	}
+	return d
+}
+
+// seen records a certificate observed in logName and reports whether it had
+// already been seen.
+func (d *deduplicator) seen(logName string, der []byte) bool {
+	fp := fingerprint(sha256.Sum256(der))
+	counts := d.countsFor(logName)
+	if d.shards[fp[0]%dedupShards].seen(fp, d.window) {
+		counts.duplicates.Add(1)
+		return true
+	}
+	counts.unique.Add(1)
+	return false
+}
+
+// countsFor returns the counters of logName, which after a log's first
+// certificate only takes a read lock.
+func (d *deduplicator) countsFor(logName string) *dedupCounters {
+	d.countsMu.RLock()
+	counts := d.counts[logName]
+	d.countsMu.RUnlock()
+	if counts != nil {
+		return counts
+	}
+	d.countsMu.Lock()
+	defer d.countsMu.Unlock()
+	if counts = d.counts[logName]; counts == nil {
+		counts = &dedupCounters{}
+		d.counts[logName] = counts
+	}
+	return counts
+}
+
+func (s *dedupShard) seen(fp fingerprint, window time.Duration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if window > 0 {
+		now := time.Now()
+		exp, ok := s.expiry[fp]
+		s.expiry[fp] = now.Add(window)
+		return ok && now.Before(exp)
+	}
+
+	if elem, ok := s.entries[fp]; ok {
+		s.order.MoveToFront(elem)
+		return true
+	}
+	s.entries[fp] = s.order.PushFront(fp)
+	if s.order.Len() > s.size {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.entries, oldest.Value.(fingerprint))
+	}
+	return false
+}
+
+// trim forgets the least recently seen half of the fingerprints, or with a
+// window those last seen more than half the window ago, to free memory
+// under -max-memory. Certificates it forgot may be emitted again. The
+// maps are copied, as a map does not shrink when entries are deleted.
+func (d *deduplicator) trim() {
+	cutoff := time.Now().Add(d.window / 2)
+	for i := range d.shards {
+		s := &d.shards[i]
+		s.mu.Lock()
+		if d.window > 0 {
+			expiry := make(map[fingerprint]time.Time)
+			for fp, exp := range s.expiry {
+				if !exp.Before(cutoff) {
+					expiry[fp] = exp
+				}
+			}
+			s.expiry = expiry
+		} else {
+			for n := s.order.Len() / 2; n > 0; n-- {
+				s.order.Remove(s.order.Back())
+			}
+			s.entries = make(map[fingerprint]*list.Element, s.order.Len())
+			for elem := s.order.Front(); elem != nil; elem = elem.Next() {
+				s.entries[elem.Value.(fingerprint)] = elem
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// expireEvery drops the expired fingerprints of a windowed deduplicator
+// every interval until done is closed, locking one shard at a time.
+func (d *deduplicator) expireEvery(interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			for i := range d.shards {
+				s := &d.shards[i]
+				s.mu.Lock()
+				for fp, exp := range s.expiry {
+					if !now.Before(exp) {
+						delete(s.expiry, fp)
+					}
+				}
+				s.mu.Unlock()
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// stats returns a copy of the per-log counts.
+func (d *deduplicator) stats() map[string]dedupCounts {
+	d.countsMu.RLock()
+	defer d.countsMu.RUnlock()
+	stats := make(map[string]dedupCounts, len(d.counts))
+	for name, counts := range d.counts {
+		stats[name] = dedupCounts{Unique: counts.unique.Load(), Duplicates: counts.duplicates.Load()}
+	}
+	return stats
+}
+
+// reportDedupStats logs the deduplication counts every interval until done
+// is closed.
+func reportDedupStats(d *deduplicator, interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			logDedupStats(d.stats())
+		case <-done:
+			return
+		}
+	}
+}
+
+func logDedupStats(stats map[string]dedupCounts) {
+	names := make([]string, 0, len(stats))
+	var total dedupCounts
+	for name, counts := range stats {
+		names = append(names, name)
+		total.Unique += counts.Unique
+		total.Duplicates += counts.Duplicates
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		counts := stats[name]
+		log.Printf("Dedup stats for %s: %d unique, %d duplicates suppressed (%.1f%%)", name, counts.Unique, counts.Duplicates, counts.duplicatePercent())
+	}
+	log.Printf("Dedup stats overall: %d unique, %d duplicates suppressed (%.1f%%)", total.Unique, total.Duplicates, total.duplicatePercent())
+}
+
+func (c dedupCounts) duplicatePercent() float64 {
+	if c.Unique+c.Duplicates == 0 {
+		return 0
+	}
+	return 100 * float64(c.Duplicates) / float64(c.Unique+c.Duplicates)
+}
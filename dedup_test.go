@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"math/big"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/certificate-transparency-go/x509"
+)
+
+func TestDedupKey(t *testing.T) {
+	issuer := []byte("issuer DN")
+	precert := &x509.Certificate{Raw: []byte("precertificate"), RawIssuer: issuer, SerialNumber: big.NewInt(42)}
+	final := &x509.Certificate{Raw: []byte("final certificate"), RawIssuer: issuer, SerialNumber: big.NewInt(42)}
+	other := &x509.Certificate{Raw: []byte("other certificate"), RawIssuer: issuer, SerialNumber: big.NewInt(43)}
+
+	byCert := &config{DedupBy: dedupByCert}
+	if !bytes.Equal(dedupKey(byCert, final), final.Raw) {
+		t.Error("-dedup-by cert does not key on the DER encoding")
+	}
+	if bytes.Equal(dedupKey(byCert, precert), dedupKey(byCert, final)) {
+		t.Error("-dedup-by cert takes a precertificate and its final certificate as the same")
+	}
+
+	bySerial := &config{DedupBy: dedupBySerial}
+	if !bytes.Equal(dedupKey(bySerial, precert), dedupKey(bySerial, final)) {
+		t.Error("-dedup-by serial tells a precertificate from its final certificate")
+	}
+	if bytes.Equal(dedupKey(bySerial, final), dedupKey(bySerial, other)) {
+		t.Error("-dedup-by serial takes different serials as the same")
+	}
+}
+
+func TestDeduplicatorWindow(t *testing.T) {
+	const window = 200 * time.Millisecond
+	d := newWindowDeduplicator(window)
+	der := []byte("certificate")
+	if d.seen("A", der) {
+		t.Fatal("a new certificate was seen before")
+	}
+	if !d.seen("B", der) {
+		t.Fatal("a certificate seen within the window was not suppressed")
+	}
+	time.Sleep(window + 50*time.Millisecond)
+	if d.seen("A", der) {
+		t.Error("a certificate last seen before the window was suppressed")
+	}
+
+	stats := d.stats()
+	if got, want := stats["A"], (dedupCounts{Unique: 2}); got != want {
+		t.Errorf("counts of A = %+v, want %+v", got, want)
+	}
+	if got, want := stats["B"], (dedupCounts{Duplicates: 1}); got != want {
+		t.Errorf("counts of B = %+v, want %+v", got, want)
+	}
+}
+
+func TestDeduplicatorEvictsLeastRecentlySeen(t *testing.T) {
+	// With room for one fingerprint per shard, certificates in the same
+	// shard evict each other.
+	d := newDeduplicator(dedupShards)
+	var ders [][]byte
+	for i := 0; len(ders) < 3; i++ {
+		der := []byte{byte(i), byte(i >> 8)}
+		if sha256.Sum256(der)[0]%dedupShards == 0 {
+			ders = append(ders, der)
+		}
+	}
+	a, b, c := ders[0], ders[1], ders[2]
+
+	d.seen("log", a)
+	if !d.seen("log", a) {
+		t.Fatal("a certificate just seen was not suppressed")
+	}
+	d.seen("log", b) // evicts a
+	if d.seen("log", a) {
+		t.Error("an evicted certificate was suppressed")
+	}
+	if d.seen("log", c) { // evicts a
+		t.Error("a new certificate was suppressed")
+	}
+	if !d.seen("log", c) {
+		t.Error("the most recently seen certificate was evicted")
+	}
+}
+
+// BenchmarkDeduplicatorSeen looks up certificates from several monitors at
+// once, as a busy run with -dedup does, half of them repeats.
+func BenchmarkDeduplicatorSeen(b *testing.B) {
+	ders := make([][]byte, 1<<14)
+	for i := range ders {
+		ders[i] = []byte(fmt.Sprintf("certificate %d", i%(len(ders)/2)))
+	}
+	logs := []string{"Log A", "Log B", "Log C", "Log D"}
+	b.Run("serial", func(b *testing.B) {
+		d := newDeduplicator(len(ders))
+		for i := 0; b.Loop(); i++ {
+			d.seen(logs[i%len(logs)], ders[i%len(ders)])
+		}
+	})
+	b.Run("parallel", func(b *testing.B) {
+		d := newDeduplicator(len(ders))
+		var next atomic.Int64
+		b.RunParallel(func(pb *testing.PB) {
+			log := logs[next.Add(1)%int64(len(logs))]
+			for i := int(next.Add(1)); pb.Next(); i++ {
+				d.seen(log, ders[i%len(ders)])
+			}
+		})
+	})
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// digest summarizes the events of one -digest-interval.
+type digest struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	// Events counts the events, which with -explode-names are one per
+	// name rather than per certificate.
+	Events   int            `json:"events"`
+	Precerts int            `json:"precerts"`
+	Logs     map[string]int `json:"logs"`
+	// Sample holds the first -digest-sample distinct names of the
+	// interval.
+	Sample []string `json:"sample"`
+	Label  string   `json:"label,omitempty"`
+
+	sampled map[string]bool
+}
+
+func newDigest(cfg *config, start time.Time) *digest {
+	return &digest{Start: start, Logs: make(map[string]int), Sample: []string{}, Label: cfg.Label, sampled: make(map[string]bool)}
+}
+
+func (d *digest) add(cfg *config, ev *certEvent) {
+	d.Events++
+	if ev.Precert {
+		d.Precerts++
+	}
+	if ev.Log != nil {
+		d.Logs[ev.Log.Description]++
+	}
+	for _, name := range eventNames(cfg, ev) {
+		if len(d.Sample) >= cfg.DigestSample {
+			break
+		}
+		if !d.sampled[name] {
+			d.sampled[name] = true
+			d.Sample = append(d.Sample, name)
+		}
+	}
+}
+
+// runDigestSink collects the events from sub into a digest per
+// cfg.DigestInterval, and runs cfg.Digest for each with the digest as JSON
+// on its stdin and its event count in CERTTAIL_DIGEST_EVENTS. Intervals
+// without events are skipped. The interval under way when sub is closed is
+// sent as it is; the returned channel is closed once it has been.
+func runDigestSink(cfg *config, sub *subscription) <-chan struct{} {
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(cfg.DigestInterval)
+		defer ticker.Stop()
+		d := newDigest(cfg, time.Now())
+		send := func(now time.Time) {
+			if d.Events > 0 {
+				d.End = now
+				if err := runDigestCommand(cfg, d); err != nil {
+					log.Printf("-digest command failed: %v", err)
+				}
+			}
+			d = newDigest(cfg, now)
+		}
+		for {
+			select {
+			case ev, ok := <-sub.C:
+				if !ok {
+					send(time.Now())
+					return
+				}
+				d.add(cfg, ev)
+			case now := <-ticker.C:
+				send(now)
+			}
+		}
+	}()
+	return stopped
+}
+
+// runDigestCommand runs the -digest command once for d, killing it after
+// -exec-timeout.
+func runDigestCommand(cfg *config, d *digest) error {
+	input, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ExecTimeout)
+	defer cancel()
+	cmd := shellCommand(ctx, cfg.Digest)
+	cmd.Stdin = bytes.NewReader(append(input, '\n'))
+	cmd.Env = append(os.Environ(), "CERTTAIL_DIGEST_EVENTS="+strconv.Itoa(d.Events))
+	cmd.WaitDelay = time.Second
+	output, err := cmd.CombinedOutput()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("killed after %s", cfg.ExecTimeout)
+	}
+	if err != nil {
+		output = bytes.TrimSpace(output)
+		if len(output) > execOutputLimit {
+			output = output[len(output)-execOutputLimit:]
+		}
+		return fmt.Errorf("%v: %s", err, output)
+	}
+	return nil
+}
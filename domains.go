@@ -0,0 +1,30 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/google/certificate-transparency-go/x509"
+	"golang.org/x/net/publicsuffix"
+)
+
+// registrableDomains returns the distinct registrable domains (eTLD+1,
+// according to the public suffix list) among cert's DNS names, such as
+// example.co.uk for www.example.co.uk. A certificate bundling names of many
+// unrelated domains is a common sign of bulk or abusive issuance. Names
+// that have no registrable domain, such as a public suffix itself, count as
+// their own.
+func registrableDomains(cert *x509.Certificate) []string {
+	var domains []string
+	seen := make(map[string]bool)
+	for _, name := range cert.DNSNames {
+		name = strings.TrimPrefix(canonicalHost(name), "*.")
+		if domain, err := publicsuffix.EffectiveTLDPlusOne(name); err == nil {
+			name = domain
+		}
+		if !seen[name] {
+			seen[name] = true
+			domains = append(domains, name)
+		}
+	}
+	return domains
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/google/certificate-transparency-go/x509"
+)
+
+var keyUsageNames = []struct {
+	usage x509.KeyUsage
+	name  string
+}{
+	{x509.KeyUsageDigitalSignature, "Digital Signature"},
+	{x509.KeyUsageContentCommitment, "Content Commitment"},
+	{x509.KeyUsageKeyEncipherment, "Key Encipherment"},
+	{x509.KeyUsageDataEncipherment, "Data Encipherment"},
+	{x509.KeyUsageKeyAgreement, "Key Agreement"},
+	{x509.KeyUsageCertSign, "Certificate Sign"},
+	{x509.KeyUsageCRLSign, "CRL Sign"},
+	{x509.KeyUsageEncipherOnly, "Encipher Only"},
+	{x509.KeyUsageDecipherOnly, "Decipher Only"},
+}
+
+var extKeyUsageNames = map[x509.ExtKeyUsage]string{
+	x509.ExtKeyUsageAny:                        "Any",
+	x509.ExtKeyUsageServerAuth:                 "Server Authentication",
+	x509.ExtKeyUsageClientAuth:                 "Client Authentication",
+	x509.ExtKeyUsageCodeSigning:                "Code Signing",
+	x509.ExtKeyUsageEmailProtection:            "Email Protection",
+	x509.ExtKeyUsageIPSECEndSystem:             "IPSec End System",
+	x509.ExtKeyUsageIPSECTunnel:                "IPSec Tunnel",
+	x509.ExtKeyUsageIPSECUser:                  "IPSec User",
+	x509.ExtKeyUsageTimeStamping:               "Time Stamping",
+	x509.ExtKeyUsageOCSPSigning:                "OCSP Signing",
+	x509.ExtKeyUsageMicrosoftServerGatedCrypto: "Microsoft Server Gated Crypto",
+	x509.ExtKeyUsageNetscapeServerGatedCrypto:  "Netscape Server Gated Crypto",
+	x509.ExtKeyUsageCertificateTransparency:    "Certificate Transparency",
+}
+
+// dumpCertificate writes a readable, multi-line description of cert to w.
+func dumpCertificate(w io.Writer, cfg *config, cert *x509.Certificate) {
+	fmt.Fprintf(w, "  Serial:              %s\n", formatSerial(cert))
+	fmt.Fprintf(w, "  Subject:             %s\n", cert.Subject.String())
+	fmt.Fprintf(w, "  Issuer:              %s\n", cert.Issuer.String())
+	fmt.Fprintf(w, "  Not before:          %s\n", appendTime(nil, cfg, cert.NotBefore))
+	fmt.Fprintf(w, "  Not after:           %s\n", appendTime(nil, cfg, cert.NotAfter))
+	fmt.Fprintf(w, "  Signature algorithm: %s\n", cert.SignatureAlgorithm)
+	fmt.Fprintf(w, "  Public key:          %s\n", describePublicKey(cert))
+
+	if len(cert.DNSNames) > 0 {
+		fmt.Fprintf(w, "  DNS names:           %s\n", strings.Join(cert.DNSNames, ", "))
+	}
+	if len(cert.IPAddresses) > 0 {
+		ips := make([]string, len(cert.IPAddresses))
+		for i, ip := range cert.IPAddresses {
+			ips[i] = ip.String()
+		}
+		fmt.Fprintf(w, "  IP addresses:        %s\n", strings.Join(ips, ", "))
+	}
+	if len(cert.EmailAddresses) > 0 {
+		fmt.Fprintf(w, "  Email addresses:     %s\n", strings.Join(cert.EmailAddresses, ", "))
+	}
+	if len(cert.URIs) > 0 {
+		uris := make([]string, len(cert.URIs))
+		for i, u := range cert.URIs {
+			uris[i] = u.String()
+		}
+		fmt.Fprintf(w, "  URIs:                %s\n", strings.Join(uris, ", "))
+	}
+
+	if cert.KeyUsage != 0 {
+		var usages []string
+		for _, ku := range keyUsageNames {
+			if cert.KeyUsage&ku.usage != 0 {
+				usages = append(usages, ku.name)
+			}
+		}
+		fmt.Fprintf(w, "  Key usage:           %s\n", strings.Join(usages, ", "))
+	}
+	if len(cert.ExtKeyUsage) > 0 || len(cert.UnknownExtKeyUsage) > 0 {
+		var usages []string
+		for _, eku := range cert.ExtKeyUsage {
+			if name, ok := extKeyUsageNames[eku]; ok {
+				usages = append(usages, name)
+			} else {
+				usages = append(usages, fmt.Sprintf("Unknown (%d)", eku))
+			}
+		}
+		for _, oid := range cert.UnknownExtKeyUsage {
+			usages = append(usages, oid.String())
+		}
+		fmt.Fprintf(w, "  Extended key usage:  %s\n", strings.Join(usages, ", "))
+	}
+	if cert.BasicConstraintsValid {
+		fmt.Fprintf(w, "  CA:                  %t\n", cert.IsCA)
+	}
+	if len(cert.SubjectKeyId) > 0 {
+		fmt.Fprintf(w, "  Subject key ID:      %s\n", hex.EncodeToString(cert.SubjectKeyId))
+	}
+	if len(cert.AuthorityKeyId) > 0 {
+		fmt.Fprintf(w, "  Authority key ID:    %s\n", hex.EncodeToString(cert.AuthorityKeyId))
+	}
+	if len(cert.OCSPServer) > 0 {
+		fmt.Fprintf(w, "  OCSP servers:        %s\n", strings.Join(cert.OCSPServer, ", "))
+	}
+	if len(cert.IssuingCertificateURL) > 0 {
+		fmt.Fprintf(w, "  CA issuers:          %s\n", strings.Join(cert.IssuingCertificateURL, ", "))
+	}
+	if len(cert.CRLDistributionPoints) > 0 {
+		fmt.Fprintf(w, "  CRL distribution:    %s\n", strings.Join(cert.CRLDistributionPoints, ", "))
+	}
+
+	if len(cert.Extensions) > 0 {
+		fmt.Fprintf(w, "  Extensions:\n")
+		for _, ext := range cert.Extensions {
+			critical := ""
+			if ext.Critical {
+				critical = " (critical)"
+			}
+			fmt.Fprintf(w, "    %s%s\n", ext.Id.String(), critical)
+		}
+	}
+	fmt.Fprintln(w)
+}
+
+// formatSerial renders a certificate serial number as colon-separated hex.
+func formatSerial(cert *x509.Certificate) string {
+	if cert.SerialNumber == nil {
+		return ""
+	}
+	b := cert.SerialNumber.Bytes()
+	if len(b) == 0 {
+		return "00"
+	}
+	parts := make([]string, len(b))
+	for i, c := range b {
+		parts[i] = fmt.Sprintf("%02x", c)
+	}
+	return strings.Join(parts, ":")
+}
+
+// describePublicKey returns the key algorithm and size, e.g. "RSA 2048 bits".
+func describePublicKey(cert *x509.Certificate) string {
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA %d bits", key.N.BitLen())
+	case *ecdsa.PublicKey:
+		return fmt.Sprintf("ECDSA %s", key.Curve.Params().Name)
+	case ed25519.PublicKey:
+		return "Ed25519"
+	default:
+		return cert.PublicKeyAlgorithm.String()
+	}
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// esMaxAttempts bounds how often a batch, or the items of it the cluster
+// rejected with a retryable status, is sent before it is dropped.
+const esMaxAttempts = 5
+
+// esRequestTimeout bounds each request to the cluster.
+const esRequestTimeout = time.Minute
+
+// esMapping is the index mapping certtail installs when it creates the
+// index: names and identifiers are keywords, so they can be searched and
+// aggregated on exactly, and the times are dates.
+const esMapping = `{
+  "mappings": {
+    "properties": {
+      "@timestamp":          {"type": "date"},
+      "timestamp_source":    {"type": "keyword"},
+      "names":               {"type": "keyword"},
+      "names_omitted":       {"type": "integer"},
+      "rules":               {"type": "keyword"},
+      "issuer":              {"type": "keyword"},
+      "issuer_organization": {"type": "keyword"},
+      "issuer_common_name":  {"type": "keyword"},
+      "subject_organization":        {"type": "keyword"},
+      "subject_organizational_unit": {"type": "keyword"},
+      "subject_country":             {"type": "keyword"},
+      "seq":                 {"type": "long"},
+      "index":               {"type": "long"},
+      "subject_key_id":      {"type": "keyword"},
+      "log_id":              {"type": "keyword"},
+      "chain":               {"type": "keyword"},
+      "serial":              {"type": "keyword"},
+      "sha256":              {"type": "keyword"},
+      "not_before":          {"type": "date"},
+      "not_after":           {"type": "date"},
+      "precert":             {"type": "boolean"},
+      "log_url":             {"type": "keyword"},
+      "log_description":     {"type": "keyword"},
+      "operator":            {"type": "keyword"},
+      "label":               {"type": "keyword"},
+      "cert":                {"type": "text", "index": false}
+    }
+  }
+}`
+
+// esDocument is the document indexed for each event.
+type esDocument struct {
+	Timestamp          time.Time `json:"@timestamp"`
+	TimestampSource    string    `json:"timestamp_source"`
+	Names              []string  `json:"names"`
+	Issuer             string    `json:"issuer"`
+	IssuerOrganization []string  `json:"issuer_organization,omitempty"`
+	IssuerCommonName   string    `json:"issuer_common_name,omitempty"`
+	Serial             string    `json:"serial"`
+	SHA256             string    `json:"sha256"`
+	NotBefore          time.Time `json:"not_before"`
+	NotAfter           time.Time `json:"not_after"`
+	Precert            bool      `json:"precert"`
+	LogURL             string    `json:"log_url,omitempty"`
+	LogDescription     string    `json:"log_description,omitempty"`
+	Operator           string    `json:"operator,omitempty"`
+	// Index is the entry's index in the log.
+	Index int64 `json:"index"`
+
+	// The subject's organization, unit and country, set in OV and EV
+	// certificates.
+	SubjectOrganization       []string `json:"subject_organization,omitempty"`
+	SubjectOrganizationalUnit []string `json:"subject_organizational_unit,omitempty"`
+	SubjectCountry            []string `json:"subject_country,omitempty"`
+
+	// Seq is the event's sequence number within this certtail process.
+	Seq uint64 `json:"seq"`
+	// SubjectKeyID is the hex subject key identifier, computed from the
+	// public key when the certificate has none.
+	SubjectKeyID string `json:"subject_key_id,omitempty"`
+	// LogID is the base64 ID of the log, as in SCTs.
+	LogID string `json:"log_id,omitempty"`
+	// Chain holds the subject DNs of the issuing chain, with -chain.
+	Chain []string `json:"chain,omitempty"`
+	// Label is the instance's -label.
+	Label string `json:"label,omitempty"`
+	// Cert is the certificate in the -cert-encoding.
+	Cert string `json:"cert,omitempty"`
+	// NamesOmitted is how many names beyond -max-names Names leaves out.
+	NamesOmitted int `json:"names_omitted,omitempty"`
+	// Rules are the entries the certificate matched, with -match-rules.
+	Rules []string `json:"rules,omitempty"`
+}
+
+func newESDocument(cfg *config, ev *certEvent) *esDocument {
+	cert := ev.Cert
+	sum := sha256.Sum256(cert.Raw)
+	doc := &esDocument{
+		Timestamp:          ev.Timestamp.In(cfg.timeZone),
+		TimestampSource:    ev.TimestampSource,
+		Issuer:             cert.Issuer.String(),
+		IssuerOrganization: cert.Issuer.Organization,
+		IssuerCommonName:   cert.Issuer.CommonName,
+		Serial:             formatSerial(cert),
+		SHA256:             hex.EncodeToString(sum[:]),
+		NotBefore:          cert.NotBefore.In(cfg.timeZone),
+		NotAfter:           cert.NotAfter.In(cfg.timeZone),
+		Precert:            ev.Precert,
+
+		SubjectOrganization:       cert.Subject.Organization,
+		SubjectOrganizationalUnit: cert.Subject.OrganizationalUnit,
+		SubjectCountry:            cert.Subject.Country,
+
+		Index:        ev.Index,
+		Seq:          ev.Seq,
+		SubjectKeyID: hex.EncodeToString(subjectKeyID(cert)),
+		Label:        cfg.Label,
+	}
+	doc.Names, doc.NamesOmitted = limitNames(cfg, eventNames(cfg, ev))
+	if cfg.MatchRules {
+		doc.Rules = matchedRules(cfg, cert, eventNames(cfg, ev))
+	}
+	if len(ev.Chain) > 0 {
+		doc.Chain = chainSubjects(ev.Chain)
+	}
+	if ev.Log != nil {
+		doc.LogURL = ev.Log.URL
+		doc.LogDescription = ev.Log.Description
+		doc.LogID = ev.Log.id()
+	}
+	if ev.Operator != nil {
+		doc.Operator = ev.Operator.Name
+	}
+	switch cfg.CertEncoding {
+	case certEncodingPEM:
+		// A precertificate's TBSCertificate is not a certificate, and is
+		// labelled as what it is.
+		blockType := "CERTIFICATE"
+		if ev.Precert {
+			blockType = "TBS CERTIFICATE"
+		}
+		doc.Cert = string(pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: cert.Raw}))
+	case certEncodingDERBase64:
+		doc.Cert = base64.StdEncoding.EncodeToString(cert.Raw)
+	}
+	return doc
+}
+
+// esSink bulk-indexes events into an Elasticsearch or OpenSearch index.
+type esSink struct {
+	url    string // base URL of the cluster, without a trailing slash
+	index  string
+	client *http.Client
+}
+
+// runElasticsearchSink indexes every event from sub into cfg.ESIndex at
+// cfg.ESURL until the subscription is closed. Events are sent with the
+// _bulk API in batches of cfg.ESBatchSize, or of whatever arrived within
+// cfg.ESFlushInterval. The returned channel is closed once the last batch
+// has been sent after the subscription closed.
+func runElasticsearchSink(cfg *config, sub *subscription) (<-chan struct{}, error) {
+	if !strings.HasPrefix(cfg.ESURL, "http://") && !strings.HasPrefix(cfg.ESURL, "https://") {
+		return nil, fmt.Errorf("elasticsearch URL must start with http:// or https://")
+	}
+	s := &esSink{
+		url:    strings.TrimSuffix(cfg.ESURL, "/"),
+		index:  cfg.ESIndex,
+		client: &http.Client{Timeout: esRequestTimeout},
+	}
+	if err := s.createIndex(); err != nil {
+		// The cluster may be down for now, or the index managed
+		// elsewhere; indexing is still attempted.
+		log.Printf("Failed to create Elasticsearch index %s: %v", s.index, err)
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(cfg.ESFlushInterval)
+		defer ticker.Stop()
+		var batch [][]byte
+		flush := func() {
+			if len(batch) > 0 {
+				s.send(batch)
+				batch = nil
+			}
+		}
+		for {
+			select {
+			case ev, ok := <-sub.C:
+				if !ok {
+					flush()
+					return
+				}
+				doc, err := json.Marshal(newESDocument(cfg, ev))
+				if err != nil {
+					log.Printf("Failed to encode event for Elasticsearch: %v", err)
+					continue
+				}
+				batch = append(batch, doc)
+				if len(batch) >= cfg.ESBatchSize {
+					flush()
+				}
+			case <-ticker.C:
+				flush()
+			}
+		}
+	}()
+	return stopped, nil
+}
+
+// createIndex creates the index with esMapping unless it already exists.
+func (s *esSink) createIndex() error {
+	req, err := http.NewRequest(http.MethodPut, s.url+"/"+s.index, strings.NewReader(esMapping))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode == http.StatusBadRequest && bytes.Contains(body, []byte("resource_already_exists_exception")) {
+		return nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	return nil
+}
+
+// esBulkResponse is the part of a _bulk response certtail looks at.
+type esBulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int             `json:"status"`
+		Error  json.RawMessage `json:"error"`
+	} `json:"items"`
+}
+
+// send indexes docs, retrying with backoff both failed requests and the
+// items the cluster rejected with a retryable status (429 or 5xx). Items
+// rejected for other reasons, such as mapping conflicts, would fail again
+// and are dropped straight away.
+func (s *esSink) send(docs [][]byte) {
+	backoff := time.Second
+	for attempt := 1; ; attempt++ {
+		retry, err := s.bulk(docs)
+		if err == nil && len(retry) == 0 {
+			return
+		}
+		if err == nil {
+			docs = retry
+			err = fmt.Errorf("%d items rejected", len(docs))
+		}
+		if attempt == esMaxAttempts {
+			log.Printf("Failed to index %d events into Elasticsearch, dropping them: %v", len(docs), err)
+			return
+		}
+		log.Printf("Failed to index %d events into Elasticsearch, retrying in %s: %v", len(docs), backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// bulk sends one _bulk request for docs. It returns the documents that
+// should be retried, or an error if the request as a whole failed.
+func (s *esSink) bulk(docs [][]byte) ([][]byte, error) {
+	action, err := json.Marshal(map[string]any{"index": map[string]string{"_index": s.index}})
+	if err != nil {
+		return nil, err
+	}
+	var body bytes.Buffer
+	for _, doc := range docs {
+		body.Write(action)
+		body.WriteByte('\n')
+		body.Write(doc)
+		body.WriteByte('\n')
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), esRequestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url+"/_bulk", &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+		return nil, fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	var result esBulkResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode bulk response: %w", err)
+	}
+	if !result.Errors {
+		return nil, nil
+	}
+	if len(result.Items) != len(docs) {
+		return nil, fmt.Errorf("bulk response has %d items for %d documents", len(result.Items), len(docs))
+	}
+
+	var retry [][]byte
+	dropped := 0
+	var firstErr json.RawMessage
+	for i, item := range result.Items {
+		for _, r := range item {
+			switch {
+			case r.Status < 300:
+			case r.Status == http.StatusTooManyRequests || r.Status >= 500:
+				retry = append(retry, docs[i])
+			default:
+				if firstErr == nil {
+					firstErr = r.Error
+				}
+				dropped++
+			}
+		}
+	}
+	if dropped > 0 {
+		log.Printf("Elasticsearch rejected %d events, dropping them: %s", dropped, firstErr)
+	}
+	return retry, nil
+}
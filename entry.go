@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	ct "github.com/google/certificate-transparency-go"
+	"github.com/google/certificate-transparency-go/x509"
+)
+
+// This file is the one place that knows the shape of the CT library's log
+// entries (ct.LeafEntry, ct.RawLogEntry and ct.LogEntry), which has changed
+// between versions of the library. The rest of certtail works with
+// logEntry, so that a dependency bump only needs this file adapted.
+
+// entryType is the type of a log entry.
+type entryType int
+
+const (
+	entryUnknown entryType = iota
+	entryX509
+	entryPrecert
+)
+
+// logEntry is a log entry as certtail uses it.
+type logEntry struct {
+	Index int64
+	// Oversized is set for entries larger than -max-entry-size, which are
+	// not decoded: only their Index is set.
+	Oversized bool
+	// Skipped is set for entries newLogEntry's want rejected, which are
+	// decoded but not parsed.
+	Skipped bool
+	Type    entryType
+	// Timestamp is when the log says it logged the entry.
+	Timestamp time.Time
+	// Cert is the certificate, or for a precertificate its
+	// TBSCertificate, which is what the final certificate will contain:
+	// the log has removed the poison extension and, when the
+	// precertificate was signed by a precertificate signing certificate,
+	// replaced its issuer with the final CA's. It is nil for entries that
+	// were not parsed, or failed to parse with ParseErr.
+	Cert     *x509.Certificate
+	ParseErr error
+	// Chain is the DER of the issuing chain the log returns with a parsed
+	// certificate, starting with its issuer.
+	Chain [][]byte
+}
+
+// newLogEntry decodes the leaf at index, parsing the certificate in it
+// unless the entry is larger than maxSize bytes (when positive) or want
+// rejects its type. Decoding the leaf is cheap; parsing the certificate is
+// not. A certificate that cannot be parsed is reported in the entry's
+// ParseErr, and so is a leaf that cannot be decoded at all, such as one of
+// an entry type this version of the CT library does not know, which is
+// returned as entryUnknown without a Timestamp. Either way the entry is
+// returned with a nil error, so that callers skip it rather than fetch it
+// again forever.
+func newLogEntry(index int64, leaf *ct.LeafEntry, maxSize int, want func(entryType) bool) (logEntry, error) {
+	entry := logEntry{Index: index}
+	// An oversized entry could exhaust memory once parsed, so it is
+	// skipped unseen.
+	if maxSize > 0 && len(leaf.LeafInput)+len(leaf.ExtraData) > maxSize {
+		entry.Oversized = true
+		return entry, nil
+	}
+	rle, err := ct.RawLogEntryFromLeaf(index, leaf)
+	if err != nil {
+		entry.ParseErr = fmt.Errorf("failed to decode entry %d: %w", index, err)
+		return entry, nil
+	}
+	te := rle.Leaf.TimestampedEntry
+	entry.Timestamp = time.UnixMilli(int64(te.Timestamp))
+	switch te.EntryType {
+	case ct.X509LogEntryType:
+		entry.Type = entryX509
+	case ct.PrecertLogEntryType:
+		entry.Type = entryPrecert
+	}
+	if want != nil && !want(entry.Type) {
+		entry.Skipped = true
+		return entry, nil
+	}
+	parsed, err := rle.ToLogEntry()
+	if x509.IsFatal(err) {
+		entry.ParseErr = fmt.Errorf("failed to parse entry %d: %w", index, err)
+		return entry, nil
+	}
+	switch {
+	case parsed.X509Cert != nil:
+		// Parsed again, strictly: the library tolerates non-fatal errors.
+		entry.Cert, entry.ParseErr = x509.ParseCertificate(parsed.X509Cert.Raw)
+		if entry.ParseErr != nil {
+			entry.Cert = nil
+		}
+	case parsed.Precert != nil:
+		entry.Cert = parsed.Precert.TBSCertificate
+		if entry.Cert == nil {
+			entry.ParseErr = fmt.Errorf("precertificate %d has no TBSCertificate", index)
+		}
+	default:
+		entry.Type = entryUnknown
+	}
+	for _, c := range parsed.Chain {
+		entry.Chain = append(entry.Chain, c.Data)
+	}
+	return entry, nil
+}
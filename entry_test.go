@@ -0,0 +1,420 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	ct "github.com/google/certificate-transparency-go"
+	"github.com/google/certificate-transparency-go/jsonclient"
+	"github.com/google/certificate-transparency-go/tls"
+)
+
+// testCertDER returns a self-signed certificate for names.
+func testCertDER(t testing.TB, names ...string) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: names[0]},
+		DNSNames:     names,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+// testPrecertTBS returns the TBSCertificate of a certificate for names
+// issued by a CA named issuerCN, as a precertificate entry holds it.
+func testPrecertTBS(t testing.TB, issuerCN string, names ...string) []byte {
+	t.Helper()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: issuerCN, Organization: []string{"Test CA Inc"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(4242),
+		Subject:      pkix.Name{CommonName: names[0]},
+		DNSNames:     names,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert.RawTBSCertificate
+}
+
+// testLeaf returns the get-entries leaf of an X.509 entry holding der,
+// logged at ts.
+func testLeaf(t testing.TB, der []byte, ts time.Time) ct.LeafEntry {
+	t.Helper()
+	leaf := ct.MerkleTreeLeaf{
+		Version:  ct.V1,
+		LeafType: ct.TimestampedEntryLeafType,
+		TimestampedEntry: &ct.TimestampedEntry{
+			Timestamp: uint64(ts.UnixMilli()),
+			EntryType: ct.X509LogEntryType,
+			X509Entry: &ct.ASN1Cert{Data: der},
+		},
+	}
+	input, err := tls.Marshal(leaf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	extra, err := tls.Marshal(ct.CertificateChain{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ct.LeafEntry{LeafInput: input, ExtraData: extra}
+}
+
+// testPrecertLeaf returns the get-entries leaf of a precertificate entry
+// whose TBSCertificate is tbs.
+func testPrecertLeaf(t testing.TB, tbs []byte, ts time.Time) ct.LeafEntry {
+	t.Helper()
+	leaf := ct.MerkleTreeLeaf{
+		Version:  ct.V1,
+		LeafType: ct.TimestampedEntryLeafType,
+		TimestampedEntry: &ct.TimestampedEntry{
+			Timestamp:    uint64(ts.UnixMilli()),
+			EntryType:    ct.PrecertLogEntryType,
+			PrecertEntry: &ct.PreCert{TBSCertificate: tbs},
+		},
+	}
+	input, err := tls.Marshal(leaf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	extra, err := tls.Marshal(ct.PrecertChainEntry{PreCertificate: ct.ASN1Cert{Data: []byte{0x30, 0x00}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ct.LeafEntry{LeafInput: input, ExtraData: extra}
+}
+
+// unknownTypeLeaf returns a leaf of entry type 0x7f, which no version of
+// RFC 6962 defines.
+func unknownTypeLeaf(ts time.Time) ct.LeafEntry {
+	input := []byte{byte(ct.V1), byte(ct.TimestampedEntryLeafType)}
+	input = binary.BigEndian.AppendUint64(input, uint64(ts.UnixMilli()))
+	input = append(input, 0x00, 0x7f, 0x00, 0x00)
+	return ct.LeafEntry{LeafInput: input}
+}
+
+func TestNewLogEntry(t *testing.T) {
+	ts := time.UnixMilli(1700000000000)
+	tests := []struct {
+		name     string
+		leaf     ct.LeafEntry
+		wantType entryType
+		wantCert bool
+		wantErr  bool // in ParseErr
+		wantTime bool
+	}{
+		{"certificate", testLeaf(t, testCertDER(t, "example.com"), ts), entryX509, true, false, true},
+		{"corrupt certificate", testLeaf(t, []byte("not a certificate"), ts), entryX509, false, true, true},
+		{"precertificate", testPrecertLeaf(t, testPrecertTBS(t, "Test CA", "example.com"), ts), entryPrecert, true, false, true},
+		{"corrupt precertificate", testPrecertLeaf(t, []byte("not a TBSCertificate"), ts), entryPrecert, false, true, true},
+		{"unknown entry type", unknownTypeLeaf(ts), entryUnknown, false, true, false},
+		{"garbage", ct.LeafEntry{LeafInput: []byte{0xff}}, entryUnknown, false, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry, err := newLogEntry(7, &tt.leaf, 0, nil)
+			if err != nil {
+				t.Fatalf("newLogEntry returned an error, which would fail the whole fetch: %v", err)
+			}
+			if entry.Index != 7 {
+				t.Errorf("Index = %d, want 7", entry.Index)
+			}
+			if entry.Type != tt.wantType {
+				t.Errorf("Type = %v, want %v", entry.Type, tt.wantType)
+			}
+			if (entry.Cert != nil) != tt.wantCert {
+				t.Errorf("Cert = %v, want a certificate: %v", entry.Cert, tt.wantCert)
+			}
+			if (entry.ParseErr != nil) != tt.wantErr {
+				t.Errorf("ParseErr = %v, want an error: %v", entry.ParseErr, tt.wantErr)
+			}
+			if got := entry.Timestamp.Equal(ts); got != tt.wantTime {
+				t.Errorf("Timestamp = %v, want %v: %v", entry.Timestamp, ts, tt.wantTime)
+			}
+		})
+	}
+}
+
+func TestNewLogEntryPrecert(t *testing.T) {
+	leaf := testPrecertLeaf(t, testPrecertTBS(t, "Test CA", "www.example.com", "example.com"), time.Now())
+	entry, err := newLogEntry(0, &leaf, 0, nil)
+	if err != nil || entry.ParseErr != nil || entry.Cert == nil {
+		t.Fatalf("newLogEntry = %+v, %v; want the TBSCertificate parsed", entry, err)
+	}
+	// The issuer and names come from the TBSCertificate, not from the
+	// precertificate the log was submitted.
+	if got, want := entry.Cert.Issuer.String(), "CN=Test CA,O=Test CA Inc"; got != want {
+		t.Errorf("Issuer = %q, want %q", got, want)
+	}
+	if got, want := certNames(entry.Cert), []string{"www.example.com", "example.com"}; !slices.Equal(got, want) {
+		t.Errorf("names = %q, want %q", got, want)
+	}
+	if entry.Cert.SerialNumber.Int64() != 4242 {
+		t.Errorf("SerialNumber = %v, want 4242", entry.Cert.SerialNumber)
+	}
+}
+
+func TestNewLogEntryUnwanted(t *testing.T) {
+	leaf := testLeaf(t, []byte("not a certificate"), time.Now())
+	entry, err := newLogEntry(0, &leaf, 0, func(entryType) bool { return false })
+	if err != nil || entry.ParseErr != nil || entry.Cert != nil {
+		t.Errorf("an unwanted entry was parsed: %+v, %v", entry, err)
+	}
+	if entry.Type != entryX509 {
+		t.Errorf("Type = %v, want %v", entry.Type, entryX509)
+	}
+}
+
+// fakeLog serves get-entries from leaves, at most max at a time (all of
+// the range when zero), each response taking delay, and records the ranges
+// asked for. fail, when set, can fail a request instead.
+type fakeLog struct {
+	leaves []ct.LeafEntry
+	max    int64
+	delay  time.Duration
+	fail   func(start, end int64) error
+
+	mu       sync.Mutex
+	requests [][2]int64
+}
+
+func (f *fakeLog) GetSTH(context.Context) (*ct.SignedTreeHead, error) {
+	return &ct.SignedTreeHead{TreeSize: uint64(len(f.leaves))}, nil
+}
+
+func (f *fakeLog) GetSTHConsistency(context.Context, uint64, uint64) ([][]byte, error) {
+	return nil, nil
+}
+
+func (f *fakeLog) GetRawEntries(ctx context.Context, start, end int64) (*ct.GetEntriesResponse, error) {
+	f.mu.Lock()
+	f.requests = append(f.requests, [2]int64{start, end})
+	f.mu.Unlock()
+	if f.delay > 0 {
+		select {
+		case <-time.After(f.delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if f.fail != nil {
+		if err := f.fail(start, end); err != nil {
+			return nil, err
+		}
+	}
+	end = min(end, int64(len(f.leaves))-1)
+	if f.max > 0 {
+		end = min(end, start+f.max-1)
+	}
+	if start > end {
+		return &ct.GetEntriesResponse{}, nil
+	}
+	return &ct.GetEntriesResponse{Entries: f.leaves[start : end+1]}, nil
+}
+
+func TestFetchRangeSkipsCorruptEntries(t *testing.T) {
+	ts := time.Now()
+	good := testLeaf(t, testCertDER(t, "example.com"), ts)
+	logClient := &fakeLog{leaves: []ct.LeafEntry{
+		good,
+		testLeaf(t, []byte("not a certificate"), ts),
+		unknownTypeLeaf(ts),
+		good,
+	}}
+	entries, err := fetchRange(context.Background(), logClient, 0, 4, 0, nil, nil)
+	if err != nil {
+		t.Fatalf("fetchRange failed on corrupt entries: %v", err)
+	}
+	if len(entries) != 4 {
+		t.Fatalf("got %d entries, want 4", len(entries))
+	}
+	for i, wantErr := range []bool{false, true, true, false} {
+		if (entries[i].ParseErr != nil) != wantErr {
+			t.Errorf("entry %d: ParseErr = %v, want an error: %v", i, entries[i].ParseErr, wantErr)
+		}
+	}
+}
+
+// failFrom fails the get-entries requests of a fakeLog that start at index
+// or after.
+func failFrom(index int64) func(start, end int64) error {
+	return func(start, end int64) error {
+		if start >= index {
+			return errors.New("connection reset by peer")
+		}
+		return nil
+	}
+}
+
+// rspError returns a fakeLog fail function that answers requests reaching
+// index or beyond with an HTTP error.
+func rspError(index int64, status int, body string) func(start, end int64) error {
+	return func(start, end int64) error {
+		if end >= index {
+			return jsonclient.RspError{Err: errors.New(http.StatusText(status)), StatusCode: status, Body: []byte(body)}
+		}
+		return nil
+	}
+}
+
+func TestFetchEntries(t *testing.T) {
+	good := testLeaf(t, testCertDER(t, "example.com"), time.Now())
+	leaves := make([]ct.LeafEntry, 8)
+	for i := range leaves {
+		leaves[i] = good
+	}
+	var names []string
+	for i := range 100 {
+		names = append(names, fmt.Sprintf("host%d.example.com", i))
+	}
+	oversized := slices.Clone(leaves)
+	oversized[2] = testLeaf(t, testCertDER(t, names...), time.Now())
+	const maxSize = 2048
+	if size := len(good.LeafInput) + len(good.ExtraData); size > maxSize {
+		t.Fatalf("a small entry is %d bytes, more than %d", size, maxSize)
+	}
+	tests := []struct {
+		name                   string
+		log                    *fakeLog // a log of the 8 leaves when nil
+		start, end             int64
+		concurrency, batchSize int
+		maxSize                int
+		wantIndexes            []int64
+		wantOversized          []int64
+		wantRequests           [][2]int64
+		wantErr                bool
+		entries404             string // -entries-404, retry when empty
+		wantNotYetServed       bool   // the error is the tree head race
+	}{
+		// Logs reject a range whose end precedes its start.
+		{name: "empty range", start: 4, end: 4, concurrency: 1, batchSize: 4},
+		{name: "end before start", start: 5, end: 4, concurrency: 1, batchSize: 4},
+		// The range is exclusive, get-entries' end inclusive: fetching up to
+		// the tree size must not ask for the entry at the tree size.
+		{name: "tail", start: 5, end: 8, concurrency: 1, batchSize: 4,
+			wantIndexes: []int64{5, 6, 7}, wantRequests: [][2]int64{{5, 7}}},
+		{name: "single entry", start: 7, end: 8, concurrency: 1, batchSize: 4,
+			wantIndexes: []int64{7}, wantRequests: [][2]int64{{7, 7}}},
+		{name: "capped responses", log: &fakeLog{leaves: leaves, max: 2}, start: 3, end: 8, concurrency: 1, batchSize: 8,
+			wantIndexes: []int64{3, 4, 5, 6, 7}, wantRequests: [][2]int64{{3, 7}, {5, 7}, {7, 7}}},
+		{name: "shards", start: 0, end: 8, concurrency: 2, batchSize: 3,
+			wantIndexes: []int64{0, 1, 2, 3, 4, 5}, wantRequests: [][2]int64{{0, 2}, {3, 5}}},
+		{name: "last shard short", start: 2, end: 8, concurrency: 2, batchSize: 4,
+			wantIndexes: []int64{2, 3, 4, 5, 6, 7}, wantRequests: [][2]int64{{2, 5}, {6, 7}}},
+		// On failure only the entries before the first one missing are
+		// returned, which are all the caller advances past.
+		{name: "failed shard", log: &fakeLog{leaves: leaves, fail: failFrom(2)}, start: 0, end: 6, concurrency: 3, batchSize: 2,
+			wantIndexes: []int64{0, 1}, wantRequests: [][2]int64{{0, 1}, {2, 3}, {4, 5}}, wantErr: true},
+		{name: "failed first shard", log: &fakeLog{leaves: leaves, fail: failFrom(0)}, start: 0, end: 4, concurrency: 2, batchSize: 2,
+			wantRequests: [][2]int64{{0, 1}, {2, 3}}, wantErr: true},
+		{name: "failure partway through a shard", log: &fakeLog{leaves: leaves, max: 2, fail: failFrom(4)}, start: 0, end: 6, concurrency: 1, batchSize: 6,
+			wantIndexes: []int64{0, 1, 2, 3}, wantRequests: [][2]int64{{0, 5}, {2, 5}, {4, 5}}, wantErr: true},
+		// An entry over -max-entry-size is returned unparsed, so that the
+		// caller skips it but still advances over it.
+		{name: "oversized entry", log: &fakeLog{leaves: oversized}, start: 0, end: 4, concurrency: 1, batchSize: 4, maxSize: maxSize,
+			wantIndexes: []int64{0, 1, 2, 3}, wantOversized: []int64{2}, wantRequests: [][2]int64{{0, 3}}},
+		{name: "no size limit", log: &fakeLog{leaves: oversized}, start: 0, end: 4, concurrency: 1, batchSize: 4,
+			wantIndexes: []int64{0, 1, 2, 3}, wantRequests: [][2]int64{{0, 3}}},
+		// A tree head may run ahead of the entries a log's frontends serve:
+		// that is retried next poll rather than reported.
+		{name: "entries not served yet", log: &fakeLog{leaves: leaves[:6]}, start: 4, end: 8, concurrency: 1, batchSize: 4,
+			wantIndexes: []int64{4, 5}, wantRequests: [][2]int64{{4, 7}, {6, 7}}, wantErr: true, wantNotYetServed: true},
+		{name: "out of range", log: &fakeLog{leaves: leaves, fail: rspError(6, http.StatusBadRequest, "need tree size: 8 to get leaves but only got: 6")}, start: 4, end: 8, concurrency: 1, batchSize: 4,
+			wantRequests: [][2]int64{{4, 7}}, wantErr: true, wantNotYetServed: true},
+		{name: "bad request", log: &fakeLog{leaves: leaves, fail: rspError(6, http.StatusBadRequest, "invalid parameters")}, start: 4, end: 8, concurrency: 1, batchSize: 4,
+			wantRequests: [][2]int64{{4, 7}}, wantErr: true},
+		// Some logs answer the race with a 404, which -entries-404 fail
+		// makes a failure.
+		{name: "not found", log: &fakeLog{leaves: leaves, fail: rspError(6, http.StatusNotFound, "")}, start: 4, end: 8, concurrency: 1, batchSize: 4,
+			wantRequests: [][2]int64{{4, 7}}, wantErr: true, wantNotYetServed: true},
+		{name: "not found with -entries-404 fail", log: &fakeLog{leaves: leaves, fail: rspError(6, http.StatusNotFound, "")}, start: 4, end: 8, concurrency: 1, batchSize: 4,
+			entries404: entries404Fail, wantRequests: [][2]int64{{4, 7}}, wantErr: true},
+		{name: "server error", log: &fakeLog{leaves: leaves, fail: rspError(6, http.StatusInternalServerError, "out of range")}, start: 4, end: 8, concurrency: 1, batchSize: 4,
+			wantRequests: [][2]int64{{4, 7}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logClient := tt.log
+			if logClient == nil {
+				logClient = &fakeLog{leaves: leaves}
+			}
+			entries, err := fetchEntries(context.Background(), logClient, tt.start, tt.end, tt.concurrency, tt.batchSize, tt.maxSize, nil, nil)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("error = %v, want an error: %v", err, tt.wantErr)
+			}
+			if got := notYetServed(err, cmp.Or(tt.entries404, entries404Retry)); got != tt.wantNotYetServed {
+				t.Errorf("notYetServed(%v) = %v, want %v", err, got, tt.wantNotYetServed)
+			}
+			var indexes, oversized []int64
+			for _, entry := range entries {
+				indexes = append(indexes, entry.Index)
+				if entry.Oversized {
+					oversized = append(oversized, entry.Index)
+					if entry.Cert != nil {
+						t.Errorf("oversized entry %d was parsed", entry.Index)
+					}
+				} else if entry.Cert == nil {
+					t.Errorf("entry %d was not parsed: %v", entry.Index, entry.ParseErr)
+				}
+			}
+			if !slices.Equal(indexes, tt.wantIndexes) {
+				t.Errorf("got entries %v, want %v", indexes, tt.wantIndexes)
+			}
+			if !slices.Equal(oversized, tt.wantOversized) {
+				t.Errorf("oversized entries %v, want %v", oversized, tt.wantOversized)
+			}
+			// Shards are fetched concurrently, in no particular order.
+			slices.SortFunc(logClient.requests, func(a, b [2]int64) int { return cmp.Compare(a[0], b[0]) })
+			if !slices.Equal(logClient.requests, tt.wantRequests) {
+				t.Errorf("asked for %v, want %v", logClient.requests, tt.wantRequests)
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// broadcaster fans certificate events out to any number of subscribers,
+// such as connected gRPC streams. Each subscriber has its own bounded
+// buffer and an overflowPolicy that decides what happens when it is full:
+// by default the subscriber misses the event rather than holding up the
+// monitors.
+type broadcaster struct {
+	// mu is held for reading while publishing, so that a publish blocked
+	// on a full subscriber does not hold up publishes from other monitors,
+	// and for writing while subscribers are added or removed.
+	mu     sync.RWMutex
+	subs   map[*subscription]struct{}
+	closed bool
+
+	// closing is closed as soon as close is called, before it waits for
+	// the write lock, to release publishes blocked on a full subscriber
+	// that would otherwise hold the read lock forever.
+	closing   chan struct{}
+	closeOnce sync.Once
+
+	// seq numbers the published events, from 1.
+	seq atomic.Uint64
+}
+
+// overflowPolicy is what publish does when a subscriber's buffer is full.
+type overflowPolicy int
+
+const (
+	overflowDropNewest overflowPolicy = iota // discard the event being published
+	overflowDropOldest                       // discard the oldest buffered event to make room
+	overflowBlock                            // wait for room, slowing down the monitors
+)
+
+var overflowPolicies = map[string]overflowPolicy{
+	"drop-newest": overflowDropNewest,
+	"drop-oldest": overflowDropOldest,
+	"block":       overflowBlock,
+}
+
+func parseOverflowPolicy(s string) (overflowPolicy, error) {
+	p, ok := overflowPolicies[s]
+	if !ok {
+		return 0, fmt.Errorf("unknown overflow policy %q (want drop-newest, drop-oldest or block)", s)
+	}
+	return p, nil
+}
+
+// subscription is a subscriber's view of a broadcaster. C is closed when the
+// broadcaster is closed.
+type subscription struct {
+	C       <-chan *certEvent
+	c       chan *certEvent
+	policy  overflowPolicy
+	quit    chan struct{}   // closed on unsubscribe, to release blocked publishes
+	closing <-chan struct{} // the broadcaster's, closed on close
+	stop    sync.Once
+	dropped atomic.Uint64
+
+	// match, when set, selects the events the subscriber gets; the others
+	// take no room in its buffer and are not counted as dropped.
+	match func(*certEvent) bool
+}
+
+// Dropped returns the number of events the subscriber missed because its
+// buffer was full.
+func (s *subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+func newBroadcaster() *broadcaster {
+	return &broadcaster{subs: make(map[*subscription]struct{}), closing: make(chan struct{})}
+}
+
+// subscribe registers a new subscriber with room for buffer pending events,
+// handling overflow according to policy.
+func (b *broadcaster) subscribe(buffer int, policy overflowPolicy) *subscription {
+	return b.subscribeMatching(buffer, policy, nil)
+}
+
+// subscribeMatching is subscribe for a subscriber that only gets the events
+// match selects, or all of them when match is nil.
+func (b *broadcaster) subscribeMatching(buffer int, policy overflowPolicy, match func(*certEvent) bool) *subscription {
+	c := make(chan *certEvent, buffer)
+	sub := &subscription{C: c, c: c, policy: policy, quit: make(chan struct{}), closing: b.closing, match: match}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(c)
+		return sub
+	}
+	b.subs[sub] = struct{}{}
+	return sub
+}
+
+// unsubscribe removes sub; it is safe to call after the broadcaster closed.
+func (b *broadcaster) unsubscribe(sub *subscription) {
+	sub.stop.Do(func() { close(sub.quit) })
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subs[sub]; ok {
+		delete(b.subs, sub)
+		close(sub.c)
+	}
+}
+
+// publish numbers ev and delivers it to every subscriber, applying each
+// subscriber's overflow policy when its buffer is full. Events published
+// concurrently by different monitors may reach a subscriber slightly out of
+// sequence order, but each monitor's events are delivered in order. A
+// subscriber with a match only sees the sequence numbers of the events it
+// selects.
+func (b *broadcaster) publish(ev *certEvent) {
+	ev.Seq = b.seq.Add(1)
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for sub := range b.subs {
+		if sub.match != nil && !sub.match(ev) {
+			continue
+		}
+		sub.send(ev)
+	}
+}
+
+func (s *subscription) send(ev *certEvent) {
+	select {
+	case s.c <- ev:
+		return
+	default:
+	}
+	switch s.policy {
+	case overflowDropNewest:
+		s.dropped.Add(1)
+	case overflowDropOldest:
+		// Make room one event at a time, trying to send first: with both
+		// in a single select, a random choice could discard more events
+		// than needed.
+		for {
+			select {
+			case s.c <- ev:
+				return
+			default:
+			}
+			select {
+			case <-s.c:
+				s.dropped.Add(1)
+			default:
+			}
+		}
+	case overflowBlock:
+		select {
+		case s.c <- ev:
+		case <-s.quit:
+			s.dropped.Add(1)
+		case <-s.closing:
+			s.dropped.Add(1)
+		}
+	}
+}
+
+// close ends all subscriptions. Later publishes are ignored. Publishes
+// blocked on a subscriber that stopped reading give up first, dropping
+// their event, so that close does not wait for the subscriber.
+func (b *broadcaster) close() {
+	b.closeOnce.Do(func() { close(b.closing) })
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.closed = true
+	for sub := range b.subs {
+		sub.stop.Do(func() { close(sub.quit) })
+		delete(b.subs, sub)
+		close(sub.c)
+	}
+}
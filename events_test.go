@@ -0,0 +1,72 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBroadcasterCloseReleasesBlockedPublish(t *testing.T) {
+	b := newBroadcaster()
+	// A sink that stopped reading, with -sink-overflow block.
+	sub := b.subscribe(1, overflowBlock)
+	b.publish(&certEvent{}) // fills the buffer
+
+	published := make(chan struct{})
+	go func() {
+		b.publish(&certEvent{})
+		close(published)
+	}()
+	select {
+	case <-published:
+		t.Fatal("publish to a full blocking subscriber did not block")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		b.close()
+		close(closed)
+	}()
+	for _, c := range []chan struct{}{published, closed} {
+		select {
+		case <-c:
+		case <-time.After(5 * time.Second):
+			t.Fatal("close waited for a subscriber that stopped reading")
+		}
+	}
+	if got := sub.Dropped(); got != 1 {
+		t.Errorf("Dropped = %d, want 1", got)
+	}
+	// The buffered event is still delivered, then the channel is closed.
+	if _, ok := <-sub.C; !ok {
+		t.Error("the buffered event was lost")
+	}
+	if _, ok := <-sub.C; ok {
+		t.Error("the subscription was not closed")
+	}
+}
+
+func TestBroadcasterOverflowPolicies(t *testing.T) {
+	b := newBroadcaster()
+	newest := b.subscribe(2, overflowDropNewest)
+	oldest := b.subscribe(2, overflowDropOldest)
+	for range 5 {
+		b.publish(&certEvent{})
+	}
+	b.close()
+
+	var seqs []uint64
+	for ev := range newest.C {
+		seqs = append(seqs, ev.Seq)
+	}
+	if len(seqs) != 2 || seqs[0] != 1 || seqs[1] != 2 || newest.Dropped() != 3 {
+		t.Errorf("drop-newest kept %v and dropped %d, want [1 2] and 3", seqs, newest.Dropped())
+	}
+	seqs = nil
+	for ev := range oldest.C {
+		seqs = append(seqs, ev.Seq)
+	}
+	if len(seqs) != 2 || seqs[0] != 4 || seqs[1] != 5 || oldest.Dropped() != 3 {
+		t.Errorf("drop-oldest kept %v and dropped %d, want [4 5] and 3", seqs, oldest.Dropped())
+	}
+}
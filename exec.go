@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// execOutputLimit bounds how much of a failed command's output is logged.
+const execOutputLimit = 512
+
+// runExecSink runs cfg.Exec for every event from sub, with the event on
+// its stdin as the same JSON document -elasticsearch indexes, and its
+// fingerprint and names in the CERTTAIL_SHA256 and CERTTAIL_NAMES
+// environment variables (the names separated by spaces). Up to
+// cfg.ExecConcurrency commands run at once; a command still running after
+// cfg.ExecTimeout is killed. Failures are logged and do not stop the sink.
+// Events only wait for a free slot in the subscription's buffer, so slow
+// commands hold up the monitors only with -sink-overflow block. The
+// returned channel is closed once the running commands have finished after
+// sub is closed.
+func runExecSink(cfg *config, sub *subscription) <-chan struct{} {
+	stopped := make(chan struct{})
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	failed := 0
+	for range max(cfg.ExecConcurrency, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ev := range sub.C {
+				if err := execForEvent(cfg, ev); err != nil {
+					// Only log the first few failures in a row, e.g. for a
+					// command that does not exist.
+					mu.Lock()
+					failed++
+					if failed <= 10 {
+						log.Printf("-exec command failed: %v", err)
+					} else if failed == 11 {
+						log.Printf("-exec command keeps failing, logging only every 1000th failure")
+					} else if failed%1000 == 0 {
+						log.Printf("-exec command failed %d times: %v", failed, err)
+					}
+					mu.Unlock()
+				} else {
+					mu.Lock()
+					failed = 0
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(stopped)
+	}()
+	return stopped
+}
+
+// execForEvent runs the command once for ev.
+func execForEvent(cfg *config, ev *certEvent) error {
+	doc := newESDocument(cfg, ev)
+	input, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ExecTimeout)
+	defer cancel()
+	cmd := shellCommand(ctx, cfg.Exec)
+	cmd.Stdin = bytes.NewReader(append(input, '\n'))
+	cmd.Env = append(os.Environ(),
+		"CERTTAIL_SHA256="+doc.SHA256,
+		"CERTTAIL_NAMES="+strings.Join(doc.Names, " "))
+	// Commands that leave children holding stdout open would otherwise
+	// keep Wait from returning after the timeout.
+	cmd.WaitDelay = time.Second
+	output, err := cmd.CombinedOutput()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%s: killed after %s", doc.SHA256, cfg.ExecTimeout)
+	}
+	if err != nil {
+		output = bytes.TrimSpace(output)
+		if len(output) > execOutputLimit {
+			output = output[len(output)-execOutputLimit:]
+		}
+		return fmt.Errorf("%s: %v: %s", doc.SHA256, err, output)
+	}
+	return nil
+}
+
+// shellCommand runs command with the system's shell, so that it may use
+// pipes, redirections and quoting.
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+	return exec.CommandContext(ctx, "/bin/sh", "-c", command)
+}
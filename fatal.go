@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+)
+
+// Stable codes for the failure classes -error-format json reports, for
+// scripts wrapping certtail.
+const (
+	errCodeConfig           = "config_parse"       // invalid flags or environment variables
+	errCodeLogListFetch     = "log_list_fetch"     // the log list could not be fetched or parsed
+	errCodeOperatorNotFound = "operator_not_found" // -operator is not in the log list
+	errCodeNoLogs           = "no_logs"            // the operator has no logs to monitor
+	errCodeStartup          = "startup"            // anything else that stops certtail from starting
+)
+
+// Values of -error-format.
+const (
+	errorFormatText = "text"
+	errorFormatJSON = "json"
+)
+
+// errorFormat is how fatal errors are written to stderr, from
+// -error-format.
+var errorFormat = errorFormatText
+
+// codedError gives an error one of the codes above, for fatal.
+type codedError struct {
+	code string
+	err  error
+}
+
+func (e codedError) Error() string { return e.err.Error() }
+func (e codedError) Unwrap() error { return e.err }
+
+// withCode returns err with code, or nil for a nil err.
+func withCode(code string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return codedError{code: code, err: err}
+}
+
+// errorCode returns the code err carries, or code when it carries none.
+func errorCode(err error, code string) string {
+	var coded codedError
+	if errors.As(err, &coded) {
+		return coded.code
+	}
+	return code
+}
+
+// fatal reports a failure that stops certtail and exits with status 1: as a
+// log line, or with -error-format json as a JSON object with the message
+// and its code:
+//
+//	{"error": "failed to get log list: ...", "code": "log_list_fetch"}
+func fatal(code, format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	if errorFormat != errorFormatJSON {
+		log.Fatal(msg)
+	}
+	json.NewEncoder(os.Stderr).Encode(struct {
+		Error string `json:"error"`
+		Code  string `json:"code"`
+	}{msg, code})
+	os.Exit(1)
+}
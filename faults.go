@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+
+	ct "github.com/google/certificate-transparency-go"
+)
+
+// injectFault, when set, is consulted before every request a monitor makes
+// to a log, so that tests can exercise retries, backoff and the circuit
+// breaker deterministically rather than by simulating a flaky network. A
+// non-nil error fails the request without it reaching the log; to delay a
+// request the hook sleeps, returning ctx.Err() if ctx ends first. call is
+// the RFC 6962 endpoint the request is for, such as "get-sth", and start and
+// end the range of entries for get-entries. It is nil outside tests.
+var injectFault func(ctx context.Context, logInfo LogInfo, call string, start, end int64) error
+
+// faultyLog passes a monitor's requests to a log through injectFault.
+type faultyLog struct {
+	ctLog
+	logInfo LogInfo
+}
+
+// withFaults returns c, wrapped in a faultyLog when injectFault is set.
+func withFaults(c ctLog, logInfo LogInfo) ctLog {
+	if injectFault == nil {
+		return c
+	}
+	return &faultyLog{ctLog: c, logInfo: logInfo}
+}
+
+func (f *faultyLog) GetSTH(ctx context.Context) (*ct.SignedTreeHead, error) {
+	if err := injectFault(ctx, f.logInfo, "get-sth", 0, 0); err != nil {
+		return nil, err
+	}
+	return f.ctLog.GetSTH(ctx)
+}
+
+func (f *faultyLog) GetSTHConsistency(ctx context.Context, first, second uint64) ([][]byte, error) {
+	if err := injectFault(ctx, f.logInfo, "get-sth-consistency", int64(first), int64(second)); err != nil {
+		return nil, err
+	}
+	return f.ctLog.GetSTHConsistency(ctx, first, second)
+}
+
+func (f *faultyLog) GetRawEntries(ctx context.Context, start, end int64) (*ct.GetEntriesResponse, error) {
+	if err := injectFault(ctx, f.logInfo, "get-entries", start, end); err != nil {
+		return nil, err
+	}
+	return f.ctLog.GetRawEntries(ctx, start, end)
+}
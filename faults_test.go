@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/certificate-transparency-go/jsonclient"
+)
+
+// faultScript is an injectFault hook that records every call and fails the
+// ones fail picks.
+type faultScript struct {
+	mu    sync.Mutex
+	calls []faultCall
+	fail  func(call faultCall, n int) error // n counts calls to the same endpoint, from 1
+}
+
+type faultCall struct {
+	call       string
+	start, end int64
+	at         time.Time
+}
+
+// injectFaults installs s as injectFault for the rest of the test.
+func injectFaults(t *testing.T, s *faultScript) {
+	injectFault = func(ctx context.Context, logInfo LogInfo, call string, start, end int64) error {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		c := faultCall{call, start, end, time.Now()}
+		s.calls = append(s.calls, c)
+		n := 0
+		for _, prev := range s.calls {
+			if prev.call == call {
+				n++
+			}
+		}
+		return s.fail(c, n)
+	}
+	t.Cleanup(func() { injectFault = nil })
+}
+
+// made returns the calls to endpoint so far.
+func (s *faultScript) made(endpoint string) []faultCall {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var calls []faultCall
+	for _, c := range s.calls {
+		if c.call == endpoint {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+// waitFor polls cond until it holds, failing the test after a few seconds.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); !cond(); time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
+
+func breakerOf(sh *shared) string {
+	for _, st := range sh.status.snapshot() {
+		return st.Breaker
+	}
+	return ""
+}
+
+func TestMonitorRetriesFailedFetch(t *testing.T) {
+	faults := &faultScript{fail: func(c faultCall, n int) error {
+		if c.call == "get-entries" && n <= 2 {
+			return errors.New("connection reset by peer")
+		}
+		return nil
+	}}
+	injectFaults(t, faults)
+	mock := newMockLog(t, mockLeaves(t, 6), 2)
+	cfg, _, err := parseTestFlags(t, "-poll=continuous", "-poll-delay=10ms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sh := newTestShared(t, cfg)
+	sub := sh.events.subscribe(16, overflowBlock)
+	var out bytes.Buffer
+	stop := startMonitor(t, sh, mock.logInfo(), &out)
+	// The log grows only once the monitor has started at its initial size.
+	waitFor(t, "the first poll", func() bool { return len(faults.made("get-sth")) >= 2 })
+	mock.setSize(6)
+	events := receive(t, sub, 4)
+	stop()
+
+	for i, ev := range events {
+		if ev.Index != int64(i+2) {
+			t.Errorf("event %d is entry %d, want %d", i, ev.Index, i+2)
+		}
+	}
+	select {
+	case ev := <-sub.C:
+		t.Errorf("entry %d emitted twice", ev.Index)
+	default:
+	}
+	calls := faults.made("get-entries")
+	if len(calls) < 3 {
+		t.Fatalf("get-entries asked for %d times, want the two failures retried", len(calls))
+	}
+	for _, c := range calls[:3] {
+		if c.start != 2 {
+			t.Errorf("get-entries asked for %d-%d, want the failed range retried from 2", c.start, c.end)
+		}
+	}
+}
+
+func TestMonitorBacksOffWhenOverloaded(t *testing.T) {
+	faults := &faultScript{fail: func(c faultCall, n int) error {
+		if c.call == "get-sth" && n == 2 {
+			return jsonclient.RspError{Err: errors.New("503 Service Unavailable"), StatusCode: http.StatusServiceUnavailable}
+		}
+		return nil
+	}}
+	injectFaults(t, faults)
+	mock := newMockLog(t, mockLeaves(t, 1), 1)
+	cfg, _, err := parseTestFlags(t, "-poll=continuous", "-poll-delay=10ms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sh := newTestShared(t, cfg)
+	var out bytes.Buffer
+	stop := startMonitor(t, sh, mock.logInfo(), &out)
+	waitFor(t, "the poll after the backoff", func() bool { return len(faults.made("get-sth")) >= 4 })
+	stop()
+
+	calls := faults.made("get-sth")
+	// The 503 answered the second get-sth; the next waits at least half of
+	// pollBackoff(1), while polls otherwise follow -poll-delay apart.
+	if gap := calls[2].at.Sub(calls[1].at); gap < pollBackoffMin/2 {
+		t.Errorf("polled again %s after a 503, want a backoff of at least %s", gap, pollBackoffMin/2)
+	}
+	if gap := calls[3].at.Sub(calls[2].at); gap >= pollBackoffMin/2 {
+		t.Errorf("still backing off %s after a successful poll", gap)
+	}
+}
+
+func TestMonitorBreakerOpensAndCloses(t *testing.T) {
+	var mu sync.Mutex
+	healed := false
+	faults := &faultScript{fail: func(c faultCall, n int) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if c.call == "get-sth" && n > 1 && !healed {
+			return errors.New("connection refused")
+		}
+		return nil
+	}}
+	injectFaults(t, faults)
+	mock := newMockLog(t, mockLeaves(t, 1), 1)
+	const cooldown = 300 * time.Millisecond
+	cfg, _, err := parseTestFlags(t, "-poll=continuous", "-poll-delay=10ms", "-breaker-failures=3", "-breaker-cooldown="+cooldown.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sh := newTestShared(t, cfg)
+	var out bytes.Buffer
+	stop := startMonitor(t, sh, mock.logInfo(), &out)
+	defer stop()
+
+	waitFor(t, "the breaker to open", func() bool { return breakerOf(sh) == "open" })
+	opened := len(faults.made("get-sth"))
+	if opened != 4 { // the initial get-sth and three failures
+		t.Errorf("breaker opened after %d get-sth requests, want 4", opened)
+	}
+	time.Sleep(cooldown / 2)
+	if n := len(faults.made("get-sth")); n != opened {
+		t.Errorf("%d polls made while the breaker was open", n-opened)
+	}
+
+	mu.Lock()
+	healed = true
+	mu.Unlock()
+	waitFor(t, "the breaker to close", func() bool { return breakerOf(sh) == "closed" })
+	calls := faults.made("get-sth")
+	if gap := calls[opened].at.Sub(calls[opened-1].at); gap < cooldown {
+		t.Errorf("probed the log %s after the breaker opened, want the cooldown of %s", gap, cooldown)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	ct "github.com/google/certificate-transparency-go"
+	"github.com/google/certificate-transparency-go/jsonclient"
+)
+
+// fetchEntries fetches entries [start, end) of a log, splitting busy ranges
+// into shards of batchSize entries fetched by up to concurrency goroutines
+// and reassembling them in index order. No get-entries request asks for
+// more than batchSize entries; logs cap their responses (often at 256 or
+// 1000 entries), so a fetcher issues as many requests as it needs to fill
+// its shard. At most concurrency*batchSize entries are fetched per call;
+// the caller picks up the rest next time.
+//
+// An empty range (start >= end) returns immediately without a request; logs
+// reject get-entries calls whose end precedes their start.
+//
+// If a shard fails, the entries of the shards before it are still returned
+// together with the error, so callers can process the contiguous prefix and
+// retry from there. The same goes for entries whose indices do not follow
+// on from the previous ones, which return an errIndexGap.
+//
+// Entries whose leaf and extra data together exceed maxSize bytes (when
+// maxSize is positive) are not parsed either: they are returned marked
+// Oversized, for callers to skip.
+//
+// When want is non-nil, entries of the types it rejects are not parsed: they
+// are returned without their certificate, so that callers still advance
+// over them. When raw is non-nil, it is handed the leaves of every
+// get-entries response before they are parsed. It may be called
+// concurrently.
+func fetchEntries(ctx context.Context, logClient ctLog, start, end int64, concurrency, batchSize, maxSize int, want func(entryType) bool, raw func(start int64, leaves []ct.LeafEntry)) ([]logEntry, error) {
+	if start >= end {
+		return nil, nil
+	}
+	concurrency, batchSize = max(concurrency, 1), max(batchSize, 1)
+	end = min(end, start+int64(concurrency)*int64(batchSize))
+
+	shards := int((end - start + int64(batchSize) - 1) / int64(batchSize))
+	results := make([][]logEntry, shards)
+	errs := make([]error, shards)
+	var wg sync.WaitGroup
+	for i := range shards {
+		lo := start + int64(i)*int64(batchSize)
+		hi := min(lo+int64(batchSize), end)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = fetchRange(ctx, logClient, lo, hi, maxSize, want, raw)
+		}()
+	}
+	wg.Wait()
+
+	var entries []logEntry
+	for i := range results {
+		// Callers advance their position by one per entry returned, so
+		// the entries must be exactly start, start+1, ... A gap would
+		// silently shift every later index; stop before it instead, so
+		// that the caller retries from the first missing index.
+		for j := range results[i] {
+			if expected := start + int64(len(entries)); results[i][j].Index != expected {
+				return entries, errIndexGap{want: expected, got: results[i][j].Index}
+			}
+			entries = append(entries, results[i][j])
+		}
+		if errs[i] != nil {
+			return entries, errs[i]
+		}
+	}
+	return entries, nil
+}
+
+// errIndexGap reports fetched entries that do not follow on from the ones
+// before them.
+type errIndexGap struct {
+	want, got int64
+}
+
+func (e errIndexGap) Error() string {
+	return fmt.Sprintf("entries are not contiguous: expected index %d, got %d; resyncing from %d", e.want, e.got, e.want)
+}
+
+// errNotYetServed reports entries below the size of a tree head the log
+// published but which it does not serve yet.
+var errNotYetServed = errors.New("the log does not serve them yet")
+
+// Values of -entries-404.
+const (
+	entries404Retry = "retry" // a 404 on get-entries is the tree head race
+	entries404Fail  = "fail"  // a 404 on get-entries is a failed poll
+)
+
+// notYetServed reports whether a get-entries error is the benign race
+// between a log's tree head and its entries: the log's frontends do not all
+// catch up with a new tree head at once, so one may publish tree size N
+// while another still rejects entries near N as out of range, or returns
+// none. Retrying on the next poll is all it takes. Some logs answer the
+// race with a 404, which counts unless notFound is entries404Fail.
+func notYetServed(err error, notFound string) bool {
+	if errors.Is(err, errNotYetServed) {
+		return true
+	}
+	var rspErr jsonclient.RspError
+	if !errors.As(err, &rspErr) {
+		return false
+	}
+	if rspErr.StatusCode == http.StatusNotFound {
+		return notFound != entries404Fail
+	}
+	if rspErr.StatusCode != http.StatusBadRequest {
+		return false
+	}
+	// Trillian-based logs answer "need tree size: N to get leaves but only
+	// got: M"; others say the range is out of bounds.
+	body := strings.ToLower(string(rspErr.Body))
+	for _, s := range []string{"tree size", "tree_size", "out of range", "out of bounds", "beyond"} {
+		if strings.Contains(body, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchRange sequentially fetches entries [start, end), issuing follow-up
+// requests when the log returns fewer entries than asked for. On error the
+// entries fetched so far are returned with it.
+func fetchRange(ctx context.Context, logClient ctLog, start, end int64, maxSize int, want func(entryType) bool, raw func(start int64, leaves []ct.LeafEntry)) ([]logEntry, error) {
+	var entries []logEntry
+	for next := start; next < end; {
+		// get-entries takes an inclusive end index, so asking for end
+		// itself would over-request past the tree at the tail.
+		resp, err := logClient.GetRawEntries(ctx, next, end-1)
+		if err != nil {
+			return entries, err
+		}
+		leaves := resp.Entries
+		if len(leaves) == 0 {
+			return entries, fmt.Errorf("log returned no entries for range [%d, %d]: %w", next, end-1, errNotYetServed)
+		}
+		if n := end - next; int64(len(leaves)) > n {
+			leaves = leaves[:n]
+		}
+		if raw != nil {
+			raw(next, leaves)
+		}
+		for i := range leaves {
+			entry, err := newLogEntry(next+int64(i), &leaves[i], maxSize, want)
+			if err != nil {
+				return entries, err
+			}
+			entries = append(entries, entry)
+		}
+		next += int64(len(leaves))
+	}
+	return entries, nil
+}
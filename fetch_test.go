@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	ct "github.com/google/certificate-transparency-go"
+)
+
+// BenchmarkFetchEntries fetches a backlog of 2048 entries from a log that
+// serves 256 per response in 5ms, serially and sharded across fetchers.
+func BenchmarkFetchEntries(b *testing.B) {
+	const backlog, perResponse = 2048, 256
+	leaf := mockLeaves(b, 1)[0]
+	leaves := make([]ct.LeafEntry, backlog)
+	for i := range leaves {
+		leaves[i] = leaf
+	}
+	logClient := &fakeLog{leaves: leaves, max: perResponse, delay: 5 * time.Millisecond}
+	for _, concurrency := range []int{1, 4, 8} {
+		b.Run(fmt.Sprintf("concurrency=%d", concurrency), func(b *testing.B) {
+			for b.Loop() {
+				for next := int64(0); next < backlog; {
+					entries, err := fetchEntries(context.Background(), logClient, next, backlog, concurrency, perResponse, 0, nil, nil)
+					if err != nil {
+						b.Fatal(err)
+					}
+					next += int64(len(entries))
+				}
+			}
+			b.ReportMetric(float64(b.N*backlog)/b.Elapsed().Seconds(), "entries/s")
+		})
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/certificate-transparency-go/x509"
+)
+
+// Values of -only.
+const (
+	onlyX509    = "x509"
+	onlyPrecert = "precert"
+)
+
+// wantsEntry reports whether log entries of type t should be parsed and
+// emitted. Unknown types are let through so that they get reported.
+func (cfg *config) wantsEntry(t entryType) bool {
+	switch t {
+	case entryX509:
+		return cfg.Only != onlyPrecert
+	case entryPrecert:
+		return cfg.Only != onlyX509 && cfg.Precerts
+	}
+	return true
+}
+
+// sampleEntry reports whether to parse and emit a log entry of type t: one
+// of a type wantsEntry wants, if -sample-rate picks it. It is the want of
+// newLogEntry, so that the entries sampling leaves out are not parsed.
+func (cfg *config) sampleEntry(t entryType) bool {
+	return cfg.wantsEntry(t) && (cfg.SampleRate >= 1 || rand.Float64() < cfg.SampleRate)
+}
+
+// certFilter reports whether a certificate should be emitted.
+type certFilter func(cert *x509.Certificate) bool
+
+// buildFilters returns the filters selected on the command line. A
+// certificate is emitted only if it passes all of them.
+func buildFilters(cfg *config) []certFilter {
+	var filters []certFilter
+	if cfg.IPOnly {
+		filters = append(filters, ipOnly)
+	}
+	if cfg.SkipNameless {
+		filters = append(filters, hasNames)
+	}
+	if len(cfg.IncludeIssuers) > 0 {
+		filters = append(filters, func(cert *x509.Certificate) bool {
+			return cfg.IncludeIssuers.matches(cert)
+		})
+	}
+	if len(cfg.ExcludeIssuers) > 0 {
+		filters = append(filters, func(cert *x509.Certificate) bool {
+			return !cfg.ExcludeIssuers.matches(cert)
+		})
+	}
+	if cfg.MinDomains > 0 {
+		filters = append(filters, func(cert *x509.Certificate) bool {
+			return len(registrableDomains(cert)) >= cfg.MinDomains
+		})
+	}
+	if len(cfg.SubjectKeyIDs) > 0 {
+		filters = append(filters, cfg.SubjectKeyIDs.matches)
+	}
+	if len(cfg.Policies) > 0 {
+		filters = append(filters, cfg.Policies.matches)
+	}
+	if cfg.TrustedCAs != nil {
+		filters = append(filters, func(cert *x509.Certificate) bool {
+			return !cfg.TrustedCAs.trusts(cert)
+		})
+	}
+	if cfg.Match != nil {
+		filters = append(filters, func(cert *x509.Certificate) bool {
+			return anyName(cfg, cert, cfg.Match.MatchString)
+		})
+	}
+	if cfg.MatchFile != nil {
+		filters = append(filters, func(cert *x509.Certificate) bool {
+			return anyName(cfg, cert, cfg.MatchFile.matches)
+		})
+	}
+	if cfg.Watch.set() {
+		filters = append(filters, func(cert *x509.Certificate) bool {
+			return cfg.Watch.watches(cfg, cert)
+		})
+	}
+	if cfg.FutureOnly {
+		filters = append(filters, func(cert *x509.Certificate) bool {
+			return notYetValid(cert, time.Now(), cfg.ClockSkew)
+		})
+	}
+	if cfg.SkipExpired {
+		filters = append(filters, func(cert *x509.Certificate) bool {
+			return !expired(cert, time.Now(), cfg.ClockSkew)
+		})
+	}
+	if cfg.Allowlist != nil {
+		filters = append(filters, func(cert *x509.Certificate) bool {
+			return cfg.Allowlist.hasUnauthorizedName(cert)
+		})
+	}
+	return filters
+}
+
+// passes reports whether cert passes every filter.
+func passes(filters []certFilter, cert *x509.Certificate) bool {
+	for _, f := range filters {
+		if !f(cert) {
+			return false
+		}
+	}
+	return true
+}
+
+// ipOnly selects certificates issued purely to IP addresses: IP address
+// SANs and no DNS names. These are rare and worth a closer look.
+func ipOnly(cert *x509.Certificate) bool {
+	return len(cert.IPAddresses) > 0 && len(cert.DNSNames) == 0
+}
+
+// notYetValid reports whether cert's notBefore is more than skew after now.
+// CAs backdate notBefore, if anything, so a certificate logged before it
+// becomes valid is anomalous.
+func notYetValid(cert *x509.Certificate, now time.Time, skew time.Duration) bool {
+	return cert.NotBefore.After(now.Add(skew))
+}
+
+// expired reports whether cert's notAfter is more than skew before now.
+func expired(cert *x509.Certificate, now time.Time, skew time.Duration) bool {
+	return cert.NotAfter.Before(now.Add(-skew))
+}
+
+// matchedNames returns the names that match re.
+func matchedNames(re *regexp.Regexp, names []string) []string {
+	var matched []string
+	for _, name := range names {
+		if re.MatchString(name) {
+			matched = append(matched, name)
+		}
+	}
+	return matched
+}
+
+// selectNames returns the normalized names to emit for a certificate: all
+// of them, or with -matched-names-only just those matching -match and
+// -match-file and -watch.
+func selectNames(cfg *config, names []string) []string {
+	if !cfg.MatchedNamesOnly || cfg.Match == nil && cfg.MatchFile == nil && !cfg.Watch.set() {
+		return names
+	}
+	if cfg.Match != nil {
+		names = matchedNames(cfg.Match, names)
+	}
+	if cfg.MatchFile != nil {
+		var matched []string
+		for _, name := range names {
+			if cfg.MatchFile.matches(name) {
+				matched = append(matched, name)
+			}
+		}
+		names = matched
+	}
+	if cfg.Watch.set() {
+		var matched []string
+		for _, name := range names {
+			if cfg.Watch.matches(name) {
+				matched = append(matched, name)
+			}
+		}
+		names = matched
+	}
+	return names
+}
+
+// issuerList is a repeatable flag of substrings of issuer distinguished
+// names, such as "O=Cloudflare" or "Fastly", matched case-insensitively.
+type issuerList []string
+
+func (l *issuerList) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, "; ")
+}
+
+func (l *issuerList) Set(v string) error {
+	if v = strings.TrimSpace(v); v == "" {
+		return fmt.Errorf("issuer substring must not be empty")
+	}
+	*l = append(*l, strings.ToLower(v))
+	return nil
+}
+
+// matches reports whether cert's issuer contains any of the substrings.
+func (l issuerList) matches(cert *x509.Certificate) bool {
+	issuer := strings.ToLower(cert.Issuer.String())
+	for _, sub := range l {
+		if strings.Contains(issuer, sub) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/certificate-transparency-go/x509"
+	"github.com/google/certificate-transparency-go/x509/pkix"
+)
+
+func TestIPOnlyFilter(t *testing.T) {
+	ip := net.ParseIP("192.0.2.1")
+	tests := []struct {
+		name string
+		args []string
+		cert *x509.Certificate
+		want bool
+	}{
+		{"IP address only", nil, &x509.Certificate{IPAddresses: []net.IP{ip}}, true},
+		{"IP address and common name", nil, &x509.Certificate{Subject: pkix.Name{CommonName: "192.0.2.1"}, IPAddresses: []net.IP{ip}}, true},
+		{"IP address and DNS name", nil, &x509.Certificate{DNSNames: []string{"example.com"}, IPAddresses: []net.IP{ip}}, false},
+		{"DNS name only", nil, &x509.Certificate{DNSNames: []string{"example.com"}}, false},
+		{"no names", nil, &x509.Certificate{}, false},
+		// The other filters still apply, to the common name.
+		{"with -skip-nameless", []string{"-skip-nameless"}, &x509.Certificate{IPAddresses: []net.IP{ip}}, true},
+		{"with a matching -match", []string{"-match=^192\\.0\\.2\\."}, &x509.Certificate{Subject: pkix.Name{CommonName: "192.0.2.1"}, IPAddresses: []net.IP{ip}}, true},
+		{"with -match and no common name", []string{"-match=^192\\.0\\.2\\."}, &x509.Certificate{IPAddresses: []net.IP{ip}}, false},
+		{"with another issuer", []string{"-include-issuer=Example CA"}, &x509.Certificate{Issuer: pkix.Name{CommonName: "Other CA"}, IPAddresses: []net.IP{ip}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _, err := parseTestFlags(t, append([]string{"-ip-only"}, tt.args...)...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := passes(buildFilters(cfg), tt.cert); got != tt.want {
+				t.Errorf("passes = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+	"unicode"
+)
+
+// filterWarnings returns the problems found in the configured filters that
+// would make them match nothing, or everything, without failing outright:
+// patterns that cannot match a name as it appears in a certificate,
+// allowlist entries that cover nothing, and contradictory issuer filters.
+func filterWarnings(cfg *config) []string {
+	var warnings []string
+	for _, f := range []struct {
+		flag string
+		re   *regexp.Regexp
+	}{{"-match", cfg.Match}, {"-alert-match", cfg.AlertMatch}} {
+		if f.re != nil {
+			warnings = append(warnings, regexpWarnings(cfg, f.flag, f.re)...)
+		}
+	}
+	if cfg.Allowlist != nil {
+		for entry := range *cfg.Allowlist.list.Load() {
+			switch {
+			case strings.HasPrefix(entry, "."):
+				warnings = append(warnings, fmt.Sprintf("-allowlist entry %q has a leading dot and covers nothing; list %q, which covers its subdomains too", entry, strings.TrimLeft(entry, ".")))
+			case strings.Contains(entry, "://") || strings.Contains(entry, "/"):
+				warnings = append(warnings, fmt.Sprintf("-allowlist entry %q is not a hostname and covers nothing", entry))
+			case strings.Contains(strings.TrimPrefix(entry, "*."), "*"):
+				warnings = append(warnings, fmt.Sprintf("-allowlist entry %q has a wildcard that is not a leading *. and covers nothing", entry))
+			}
+		}
+	}
+	for _, sub := range cfg.IncludeIssuers {
+		for _, excluded := range cfg.ExcludeIssuers {
+			if strings.Contains(sub, excluded) {
+				warnings = append(warnings, fmt.Sprintf("every issuer selected by -include-issuer %q is dropped by -exclude-issuer %q", sub, excluded))
+			}
+		}
+	}
+	return warnings
+}
+
+// regexpWarnings checks a name pattern for the usual ways of getting it
+// subtly wrong.
+func regexpWarnings(cfg *config, flag string, re *regexp.Regexp) []string {
+	var warnings []string
+	if re.MatchString("") {
+		warnings = append(warnings, fmt.Sprintf("%s %q matches the empty string, so it matches every name", flag, re))
+	}
+	parsed, err := syntax.Parse(re.String(), syntax.Perl)
+	if err != nil {
+		return warnings
+	}
+	if hasUpperLiteral(parsed) {
+		why := "names in certificates are almost always lower case"
+		if cfg.LowercaseNames {
+			why = "-lowercase lowercases every name before matching"
+		}
+		warnings = append(warnings, fmt.Sprintf("%s %q has upper-case letters but %s; add (?i) to ignore case", flag, re, why))
+	}
+	if suffix, ok := anchoredSuffix(parsed); ok {
+		switch {
+		case strings.HasSuffix(suffix, "."):
+			warnings = append(warnings, fmt.Sprintf("%s %q requires a trailing dot, which names in certificates never have", flag, re))
+		case strings.HasPrefix(suffix, ".") && len(suffix) > 1 && !re.MatchString(suffix[1:]):
+			apex := suffix[1:]
+			warnings = append(warnings, fmt.Sprintf("%s %q matches names below %s but not %s itself; use '(^|\\.)%s$' to match both", flag, re, apex, apex, regexp.QuoteMeta(apex)))
+		}
+	}
+	return warnings
+}
+
+// hasUpperLiteral reports whether re contains a case-sensitive literal with
+// an upper-case letter.
+func hasUpperLiteral(re *syntax.Regexp) bool {
+	if re.Op == syntax.OpLiteral && re.Flags&syntax.FoldCase == 0 {
+		for _, r := range re.Rune {
+			if unicode.IsUpper(r) {
+				return true
+			}
+		}
+	}
+	for _, sub := range re.Sub {
+		if hasUpperLiteral(sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// anchoredSuffix returns the literal text a pattern ending in $ requires
+// names to end with, such as ".example.com" for `\.example\.com$`.
+func anchoredSuffix(re *syntax.Regexp) (string, bool) {
+	if re.Op != syntax.OpConcat || len(re.Sub) < 2 {
+		return "", false
+	}
+	last := re.Sub[len(re.Sub)-1]
+	if last.Op != syntax.OpEndText && last.Op != syntax.OpEndLine {
+		return "", false
+	}
+	lit := re.Sub[len(re.Sub)-2]
+	if lit.Op != syntax.OpLiteral || lit.Flags&syntax.FoldCase != 0 {
+		return "", false
+	}
+	return string(lit.Rune), true
+}
+
+// explainFilters prints, for -explain-filters, how the name-based filters
+// classify each of names, or of the names read from in, one per line, when
+// none are given. Filters on other certificate fields, such as the issuer,
+// cannot be judged from a name and are only listed.
+func explainFilters(cfg *config, names []string, in io.Reader, out io.Writer) error {
+	if len(names) == 0 {
+		scanner := bufio.NewScanner(in)
+		for scanner.Scan() {
+			if name := strings.TrimSpace(scanner.Text()); name != "" && !strings.HasPrefix(name, "#") {
+				names = append(names, name)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+	}
+
+	var other []string
+	if len(cfg.IncludeIssuers) > 0 {
+		other = append(other, "-include-issuer")
+	}
+	if len(cfg.ExcludeIssuers) > 0 {
+		other = append(other, "-exclude-issuer")
+	}
+	if cfg.MinDomains > 0 {
+		other = append(other, "-min-domains")
+	}
+	if len(cfg.SubjectKeyIDs) > 0 {
+		other = append(other, "-ski")
+	}
+	if len(cfg.Policies) > 0 {
+		other = append(other, "-policy")
+	}
+	if cfg.TrustedCAs != nil {
+		other = append(other, "-trusted-cas")
+	}
+	if cfg.IPOnly {
+		other = append(other, "-ip-only")
+	}
+	if cfg.FutureOnly {
+		other = append(other, "-future-only")
+	}
+	if cfg.SkipExpired {
+		other = append(other, "-skip-expired")
+	}
+	if len(other) > 0 {
+		fmt.Fprintf(out, "Not judged from names: %s\n", strings.Join(other, ", "))
+	}
+	if cfg.Match == nil && cfg.MatchFile == nil && !cfg.Watch.set() && cfg.Allowlist == nil && cfg.AlertMatch == nil {
+		fmt.Fprintln(out, "No name filters are set: every name is emitted")
+	}
+
+	for _, name := range names {
+		normalized := normalizeName(cfg, name)
+		emitted := true
+		var verdicts []string
+		if cfg.Match != nil {
+			if cfg.Match.MatchString(normalized) {
+				verdicts = append(verdicts, "-match: matches")
+			} else {
+				verdicts = append(verdicts, "-match: no match")
+				emitted = false
+			}
+		}
+		if cfg.MatchFile != nil {
+			if rule := cfg.MatchFile.rule(normalized); rule != "" {
+				verdicts = append(verdicts, "-match-file: matches "+rule)
+			} else {
+				verdicts = append(verdicts, "-match-file: no match")
+				emitted = false
+			}
+		}
+		if cfg.Watch.set() {
+			if rule := cfg.Watch.rule(normalized); rule != "" {
+				verdicts = append(verdicts, "-watch: matches "+rule)
+			} else {
+				verdicts = append(verdicts, "-watch: no match")
+				emitted = false
+			}
+		}
+		if cfg.Allowlist != nil {
+			status := cfg.Allowlist.list.Load().status(name)
+			verdicts = append(verdicts, "-allowlist: "+status)
+			emitted = emitted && status == "unauthorized"
+		}
+		if cfg.AlertMatch != nil {
+			if cfg.AlertMatch.MatchString(normalized) {
+				verdicts = append(verdicts, "-alert-match: counted")
+			} else {
+				verdicts = append(verdicts, "-alert-match: not counted")
+			}
+		}
+		verdict := "dropped"
+		if emitted {
+			verdict = "emitted"
+		}
+		if normalized != name {
+			name += " (" + normalized + ")"
+		}
+		if len(verdicts) > 0 {
+			verdict += " (" + strings.Join(verdicts, "; ") + ")"
+		}
+		fmt.Fprintf(out, "%s: %s\n", name, verdict)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+
+	"github.com/artooro/certtail/certtailpb"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// grpcServer implements the certtail.v1.CertTail service on top of the
+// event broadcaster.
+type grpcServer struct {
+	certtailpb.UnimplementedCertTailServer
+
+	cfg    *config
+	events *broadcaster
+}
+
+// startGRPCServer listens on addr and serves event streams until the
+// returned server is stopped.
+func startGRPCServer(addr string, cfg *config, events *broadcaster) (*grpc.Server, error) {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	srv := grpc.NewServer()
+	certtailpb.RegisterCertTailServer(srv, &grpcServer{cfg: cfg, events: events})
+	go func() {
+		if err := srv.Serve(lis); err != nil {
+			log.Printf("gRPC server stopped: %v", err)
+		}
+	}()
+	log.Printf("Serving gRPC event stream on %s", lis.Addr())
+	return srv, nil
+}
+
+func (s *grpcServer) StreamEvents(_ *certtailpb.StreamEventsRequest, stream grpc.ServerStreamingServer[certtailpb.CertEvent]) error {
+	sub := s.events.subscribeMatching(s.cfg.GRPCBuffer, overflowDropNewest, s.cfg.SinkMatch.matcher(s.cfg, "grpc"))
+	defer func() {
+		s.events.unsubscribe(sub)
+		if n := sub.Dropped(); n > 0 {
+			log.Printf("gRPC client fell behind and missed %d events", n)
+		}
+	}()
+
+	for {
+		select {
+		case ev, ok := <-sub.C:
+			if !ok {
+				return nil
+			}
+			if err := stream.Send(eventToProto(s.cfg, ev)); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+// eventToProto converts an event to its protobuf form, shared by the gRPC
+// stream and -proto-out.
+func eventToProto(cfg *config, ev *certEvent) *certtailpb.CertEvent {
+	cert := ev.Cert
+	pb := &certtailpb.CertEvent{
+		Timestamp:          timestamppb.New(ev.Timestamp),
+		Issuer:             cert.Issuer.String(),
+		IssuerOrganization: cert.Issuer.Organization,
+		IssuerCommonName:   cert.Issuer.CommonName,
+		Serial:             formatSerial(cert),
+		NotBefore:          timestamppb.New(cert.NotBefore),
+		NotAfter:           timestamppb.New(cert.NotAfter),
+		Der:                cert.Raw,
+		Precert:            ev.Precert,
+		Label:              cfg.Label,
+	}
+	pb.Names, _ = limitNames(cfg, eventNames(cfg, ev))
+	if ev.Log != nil {
+		pb.LogUrl = ev.Log.URL
+		pb.LogDescription = ev.Log.Description
+	}
+	if ev.Operator != nil {
+		pb.Operator = ev.Operator.Name
+	}
+	return pb
+}
@@ -0,0 +1,8 @@
+//go:build !plan9
+
+package main
+
+import "syscall"
+
+// hangupSignal is the signal that makes certtail reload its files.
+var hangupSignal = syscall.SIGHUP
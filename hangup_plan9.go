@@ -0,0 +1,6 @@
+package main
+
+import "syscall"
+
+// hangupSignal is the note that makes certtail reload its files.
+var hangupSignal = syscall.Note("hangup")
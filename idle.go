@@ -0,0 +1,34 @@
+package main
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// idleTracker records when the monitors last processed a log entry, for
+// -exit-after-idle.
+type idleTracker struct {
+	last atomic.Int64 // UnixNano
+}
+
+func newIdleTracker(now time.Time) *idleTracker {
+	t := &idleTracker{}
+	t.touch(now)
+	return t
+}
+
+// touch records that entries were processed at now.
+func (t *idleTracker) touch(now time.Time) {
+	t.last.Store(now.UnixNano())
+}
+
+// idleFor returns how long before now entries were last processed.
+func (t *idleTracker) idleFor(now time.Time) time.Duration {
+	return now.Sub(time.Unix(0, t.last.Load()))
+}
+
+// idleCheckInterval is how often the idle time is checked against d: often
+// enough to exit within a tenth of it, but at most once a second.
+func idleCheckInterval(d time.Duration) time.Duration {
+	return max(d/10, time.Second)
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	ct "github.com/google/certificate-transparency-go"
+	"github.com/google/certificate-transparency-go/client"
+	"github.com/google/certificate-transparency-go/jsonclient"
+	"github.com/google/certificate-transparency-go/tls"
+	"github.com/google/certificate-transparency-go/x509"
+	"github.com/transparency-dev/merkle/proof"
+	"github.com/transparency-dev/merkle/rfc6962"
+)
+
+// inclusionCheck is one leaf to look up in one log.
+type inclusionCheck struct {
+	log  LogInfo
+	leaf *ct.MerkleTreeLeaf
+	what string // which entry the leaf is, for the report
+}
+
+// checkInclusion checks that the certificate in cfg.CheckInclusion is in
+// the logs it claims to be in, by computing its leaf hash and asking each
+// log for an inclusion proof by hash against its current tree head. It
+// returns the process exit code: 0 if every check found the entry and
+// verified its proof, 1 otherwise.
+func checkInclusion(cfg *config, logList *LogList) int {
+	chain, err := readCertChain(cfg.CheckInclusion)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", cfg.CheckInclusion, err)
+		return 1
+	}
+	checks, err := inclusionChecks(cfg, logList, chain)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", cfg.CheckInclusion, err)
+		return 1
+	}
+
+	code := 0
+	for _, check := range checks {
+		index, err := proveInclusion(cfg, check)
+		if err != nil {
+			fmt.Printf("%s: %s: %v\n", check.log.Description, check.what, err)
+			code = 1
+			continue
+		}
+		fmt.Printf("%s: %s included at index %d\n", check.log.Description, check.what, index)
+	}
+	return code
+}
+
+// inclusionChecks works out which leaves to look up in which logs. A
+// certificate with embedded SCTs was logged as a precertificate to the
+// logs that issued them, each with its SCT's timestamp; that needs the
+// issuer, which must follow the certificate in the file. Otherwise the
+// entry's timestamp comes from -check-timestamp and the log from
+// -check-log.
+func inclusionChecks(cfg *config, logList *LogList, chain []*x509.Certificate) ([]inclusionCheck, error) {
+	logsByID := make(map[string]LogInfo)
+	var checkLog *LogInfo
+	for _, op := range logList.Operators {
+		for _, l := range op.Logs {
+			if id := l.id(); id != "" {
+				logsByID[id] = l
+			}
+			if cfg.CheckLog != "" && strings.TrimSuffix(l.URL, "/") == strings.TrimSuffix(cfg.CheckLog, "/") {
+				checkLog = &l
+			}
+		}
+	}
+	if cfg.CheckLog != "" && checkLog == nil {
+		checkLog = &LogInfo{URL: cfg.CheckLog, Description: cfg.CheckLog}
+	}
+
+	cert := chain[0]
+	if cfg.CheckTimestamp > 0 {
+		if checkLog == nil {
+			return nil, errors.New("-check-timestamp needs -check-log")
+		}
+		etype, what := ct.X509LogEntryType, "certificate"
+		if cert.IsPrecertificate() {
+			etype, what = ct.PrecertLogEntryType, "precertificate"
+		}
+		leaf, err := ct.MerkleTreeLeafFromChain(chain, etype, cfg.CheckTimestamp)
+		if err != nil {
+			return nil, err
+		}
+		return []inclusionCheck{{log: *checkLog, leaf: leaf, what: what}}, nil
+	}
+
+	if len(cert.SCTList.SCTList) == 0 {
+		return nil, errors.New("certificate has no embedded SCTs; give the timestamp of its SCT with -check-timestamp and the log with -check-log")
+	}
+	if len(chain) < 2 {
+		return nil, errors.New("checking embedded SCTs needs the issuer certificate after the certificate in the file")
+	}
+	var checks []inclusionCheck
+	for _, serialized := range cert.SCTList.SCTList {
+		var sct ct.SignedCertificateTimestamp
+		if rest, err := tls.Unmarshal(serialized.Val, &sct); err != nil || len(rest) > 0 {
+			continue
+		}
+		id := base64.StdEncoding.EncodeToString(sct.LogID.KeyID[:])
+		logInfo, known := logsByID[id]
+		switch {
+		case checkLog != nil && checkLog.id() != "" && checkLog.id() != id:
+			continue
+		case checkLog != nil:
+			// A log missing from the log list has no known ID to match,
+			// so every SCT is tried against it.
+			logInfo = *checkLog
+		case !known:
+			fmt.Printf("%s: SCT from a log that is not in the log list, skipping it\n", id)
+			continue
+		}
+		leaf, err := ct.MerkleTreeLeafForEmbeddedSCT(chain, sct.Timestamp)
+		if err != nil {
+			return nil, err
+		}
+		checks = append(checks, inclusionCheck{log: logInfo, leaf: leaf, what: "precertificate of SCT issued " + time.UnixMilli(int64(sct.Timestamp)).UTC().Format(time.RFC3339)})
+	}
+	if len(checks) == 0 {
+		return nil, errors.New("none of the embedded SCTs is from a log to check")
+	}
+	return checks, nil
+}
+
+// proveInclusion fetches and verifies the inclusion proof of check's leaf
+// against the log's current tree head, returning the leaf's index.
+func proveInclusion(cfg *config, check inclusionCheck) (int64, error) {
+	logClient, _, err := newLogClient(cfg, check.log)
+	if err != nil {
+		return 0, err
+	}
+	hash, err := ct.LeafHashForLeaf(check.leaf)
+	if err != nil {
+		return 0, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+	sth, err := logClient.GetSTH(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get STH: %w", err)
+	}
+	return leafIndex(ctx, logClient, hash[:], sth)
+}
+
+// errLeafNotFound is returned by leafIndex for a leaf the log does not
+// have within the tree head.
+var errLeafNotFound = errors.New("leaf not found")
+
+// leafIndex returns the index of the leaf with the Merkle leaf hash in the
+// tree of sth, looked up with get-proof-by-hash, after verifying its
+// inclusion proof against the tree head.
+func leafIndex(ctx context.Context, logClient *client.LogClient, hash []byte, sth *ct.SignedTreeHead) (int64, error) {
+	resp, err := logClient.GetProofByHash(ctx, hash, sth.TreeSize)
+	if err != nil {
+		// Logs answer 400 or 404 for hashes they do not have (or not yet
+		// within this tree head).
+		var rspErr jsonclient.RspError
+		if errors.As(err, &rspErr) && (rspErr.StatusCode == http.StatusNotFound || rspErr.StatusCode == http.StatusBadRequest) {
+			return 0, fmt.Errorf("%w in tree size %d", errLeafNotFound, sth.TreeSize)
+		}
+		return 0, fmt.Errorf("failed to get inclusion proof: %w", err)
+	}
+	if err := proof.VerifyInclusion(rfc6962.DefaultHasher, uint64(resp.LeafIndex), sth.TreeSize, hash, resp.AuditPath, sth.SHA256RootHash[:]); err != nil {
+		return 0, fmt.Errorf("ALERT: inclusion proof for index %d does not verify against tree size %d: %w", resp.LeafIndex, sth.TreeSize, err)
+	}
+	return resp.LeafIndex, nil
+}
+
+// readCertChain reads a certificate, optionally followed by its issuer
+// chain, from a PEM file, or a single certificate from a DER file.
+func readCertChain(path string) ([]*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var ders [][]byte
+	for rest := data; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type == "CERTIFICATE" {
+			ders = append(ders, block.Bytes)
+		}
+	}
+	if len(ders) == 0 {
+		ders = [][]byte{data}
+	}
+	chain := make([]*x509.Certificate, 0, len(ders))
+	for _, der := range ders {
+		cert, err := x509.ParseCertificate(der)
+		if x509.IsFatal(err) {
+			return nil, fmt.Errorf("failed to parse certificate: %w", err)
+		}
+		chain = append(chain, cert)
+	}
+	return chain, nil
+}
+
+// startLeafIndex looks up the index of the entry a log's start_leaf_hash
+// override pins its monitor's start to, in the tree of sth.
+func startLeafIndex(ctx context.Context, cfg *config, logInfo LogInfo, sth *ct.SignedTreeHead) (int64, error) {
+	if logInfo.tiled() {
+		return 0, errors.New("tiled logs do not serve get-proof-by-hash")
+	}
+	logClient, _, err := newLogClient(cfg, logInfo)
+	if err != nil {
+		return 0, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	return leafIndex(ctx, logClient, cfg.StartLeafHash, sth)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"sync"
+
+	"github.com/google/certificate-transparency-go/x509"
+)
+
+// keyReuseTracker counts the distinct certificates each public key is seen
+// on, by the SHA-256 of its SubjectPublicKeyInfo, remembering the most
+// recent size keys. A key on many certificates points to automated
+// issuance reusing keys, or to a key shared, or stolen, beyond its owner.
+// A precertificate and its final certificate, which share issuer and
+// serial, count as one certificate.
+type keyReuseTracker struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List // of *keyReuseEntry, most recently seen first
+	entries map[fingerprint]*list.Element
+	// reused counts the tracked keys seen on more than one certificate.
+	reused int
+}
+
+type keyReuseEntry struct {
+	key   fingerprint // of the SubjectPublicKeyInfo
+	last  fingerprint // serialKey of the last certificate seen with it
+	certs int
+}
+
+func newKeyReuseTracker(size int) *keyReuseTracker {
+	return &keyReuseTracker{size: size, order: list.New(), entries: make(map[fingerprint]*list.Element)}
+}
+
+// observe records cert and reports whether its key was seen on another
+// certificate before, returning the number of certificates seen with it
+// and the number of tracked keys seen on more than one. Only a change from
+// the last certificate seen with the key is counted, which keeps the
+// tracker bounded but counts a certificate again when it turns up after
+// another one with the same key, as in another log.
+func (t *keyReuseTracker) observe(cert *x509.Certificate) (certs, reusedKeys int, reused bool) {
+	key := fingerprint(sha256.Sum256(cert.RawSubjectPublicKeyInfo))
+	last := serialKey(cert, false)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if elem, ok := t.entries[key]; ok {
+		t.order.MoveToFront(elem)
+		entry := elem.Value.(*keyReuseEntry)
+		if entry.last == last {
+			return entry.certs, t.reused, false
+		}
+		entry.last = last
+		entry.certs++
+		if entry.certs == 2 {
+			t.reused++
+		}
+		return entry.certs, t.reused, true
+	}
+	t.entries[key] = t.order.PushFront(&keyReuseEntry{key: key, last: last, certs: 1})
+	if t.order.Len() > t.size {
+		oldest := t.order.Back()
+		t.order.Remove(oldest)
+		entry := oldest.Value.(*keyReuseEntry)
+		delete(t.entries, entry.key)
+		if entry.certs > 1 {
+			t.reused--
+		}
+	}
+	return 1, t.reused, false
+}
+
+// writeKeyReuseAlert appends the alert line for a public key seen on
+// certs certificates, the latest of which is ev's.
+func writeKeyReuseAlert(buf *bytes.Buffer, cfg *config, ev *certEvent, certs int) {
+	sum := sha256.Sum256(ev.Cert.RawSubjectPublicKeyInfo)
+	buf.WriteString("Alert: ")
+	startColor(buf, cfg, ansiRed)
+	buf.WriteString("public key ")
+	buf.WriteString(hex.EncodeToString(sum[:]))
+	buf.WriteString(" seen on ")
+	buf.Write(strconv.AppendInt(buf.AvailableBuffer(), int64(certs), 10))
+	buf.WriteString(" certificates")
+	endColor(buf, cfg)
+	buf.WriteString(", Latest: ")
+	writeLimitedNames(buf, cfg, normalizeNames(cfg, certNames(ev.Cert)))
+	buf.WriteString(", Issuer: ")
+	buf.WriteString(ev.Cert.Issuer.String())
+	buf.WriteString(", Log: ")
+	buf.WriteString(ev.Log.Description)
+	buf.WriteByte('\n')
+}
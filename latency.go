@@ -0,0 +1,43 @@
+package main
+
+import (
+	"slices"
+	"time"
+)
+
+// latencySamples is the number of recent detection latencies each monitor
+// keeps to compute percentiles from.
+const latencySamples = 1024
+
+// latencyTracker keeps a monitor's most recent detection latencies: the
+// time from an entry's log timestamp to certtail emitting it, made up of
+// the log's merge delay, the poll interval and processing. It is owned by
+// a single monitor goroutine and is not safe for concurrent use.
+type latencyTracker struct {
+	samples []time.Duration
+	next    int // where the next sample goes once samples is full
+
+	// alerting is set while the p99 is above -latency-alert.
+	alerting bool
+}
+
+func (t *latencyTracker) observe(d time.Duration) {
+	if len(t.samples) < latencySamples {
+		t.samples = append(t.samples, d)
+		return
+	}
+	t.samples[t.next] = d
+	t.next = (t.next + 1) % latencySamples
+}
+
+// percentile returns the p-th percentile (0-100) of the recent latencies,
+// or 0 if there are none.
+func (t *latencyTracker) percentile(p float64) time.Duration {
+	if len(t.samples) == 0 {
+		return 0
+	}
+	sorted := slices.Clone(t.samples)
+	slices.Sort(sorted)
+	i := int(p / 100 * float64(len(sorted)-1))
+	return sorted[i]
+}
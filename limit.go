@@ -0,0 +1,29 @@
+package main
+
+import (
+	"sync/atomic"
+)
+
+// emitLimit counts down the certificates certtail may still emit, across
+// all logs, for -limit.
+type emitLimit struct {
+	remaining atomic.Int64
+	// reached is closed once the last certificate allowed is taken.
+	reached chan struct{}
+}
+
+func newEmitLimit(n int64) *emitLimit {
+	l := &emitLimit{reached: make(chan struct{})}
+	l.remaining.Store(n)
+	return l
+}
+
+// take reports whether one more certificate may be emitted, and closes
+// reached when it is the last one.
+func (l *emitLimit) take() bool {
+	n := l.remaining.Add(-1)
+	if n == 0 {
+		close(l.reached)
+	}
+	return n >= 0
+}
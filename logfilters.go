@@ -0,0 +1,202 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/artooro/certtail/match"
+)
+
+// filterOverride replaces some of the global filter settings, or the
+// request timeout, for the logs of an operator or for a single log, in the
+// -log-filters file. Fields left out keep the global setting; an empty
+// issuer list clears it.
+type filterOverride struct {
+	// Exactly one of Log (a log URL or description) and Operator selects
+	// the logs the override applies to.
+	Log      string `json:"log,omitempty"`
+	Operator string `json:"operator,omitempty"`
+
+	Match         *string  `json:"match,omitempty"`
+	IncludeIssuer []string `json:"include_issuer,omitempty"`
+	ExcludeIssuer []string `json:"exclude_issuer,omitempty"`
+	IPOnly        *bool    `json:"ip_only,omitempty"`
+	SkipNameless  *bool    `json:"skip_nameless,omitempty"`
+	FutureOnly    *bool    `json:"future_only,omitempty"`
+
+	// Timeout replaces -request-timeout, as a duration such as "90s".
+	Timeout *string `json:"timeout,omitempty"`
+	// StartIndex pins the index a log's monitor starts at (see
+	// config.StartIndex); only a log's override can set it.
+	StartIndex *int64 `json:"start_index,omitempty"`
+	// StartLeafHash pins the start to an entry by its leaf hash, in base64
+	// as the CT API gives it or in hex, instead of by index.
+	StartLeafHash string `json:"start_leaf_hash,omitempty"`
+
+	timeout          time.Duration
+	leafHash         []byte
+	match            *regexp.Regexp
+	include, exclude issuerList
+}
+
+// loadFilterOverrides reads a -log-filters file: a JSON array of
+// overrides, such as
+//
+//	[{"operator": "Cloudflare", "match": "(^|\\.)example\\.com$"},
+//	 {"log": "https://ct.example.com/2025h1/", "exclude_issuer": ["Fastly"]}]
+func loadFilterOverrides(path string) ([]filterOverride, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var overrides []filterOverride
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for i := range overrides {
+		o := &overrides[i]
+		if (o.Log == "") == (o.Operator == "") {
+			return nil, fmt.Errorf("%s: override %d must have either a log or an operator", path, i+1)
+		}
+		if o.Match != nil {
+			if o.match, err = match.CompileRegexp(*o.Match); err != nil {
+				return nil, fmt.Errorf("%s: override %d: %w", path, i+1, err)
+			}
+		}
+		if o.StartIndex != nil && (o.Log == "" || *o.StartIndex < 0) {
+			return nil, fmt.Errorf("%s: override %d: start_index must be a log's and not negative", path, i+1)
+		}
+		if o.StartLeafHash != "" {
+			if o.Log == "" || o.StartIndex != nil {
+				return nil, fmt.Errorf("%s: override %d: start_leaf_hash must be a log's and cannot go with start_index", path, i+1)
+			}
+			if o.leafHash, err = parseLeafHash(o.StartLeafHash); err != nil {
+				return nil, fmt.Errorf("%s: override %d: %w", path, i+1, err)
+			}
+		}
+		if o.Timeout != nil {
+			if o.timeout, err = time.ParseDuration(*o.Timeout); err != nil || o.timeout < 0 {
+				return nil, fmt.Errorf("%s: override %d: invalid timeout %q", path, i+1, *o.Timeout)
+			}
+		}
+		for _, lists := range []struct {
+			from []string
+			to   *issuerList
+		}{{o.IncludeIssuer, &o.include}, {o.ExcludeIssuer, &o.exclude}} {
+			if lists.from == nil {
+				continue
+			}
+			*lists.to = issuerList{}
+			for _, v := range lists.from {
+				if err := lists.to.Set(v); err != nil {
+					return nil, fmt.Errorf("%s: override %d: %w", path, i+1, err)
+				}
+			}
+		}
+	}
+	return overrides, nil
+}
+
+// appliesTo reports whether the override selects logInfo of operator.
+func (o *filterOverride) appliesTo(operator *Operator, logInfo LogInfo) bool {
+	if o.Operator != "" {
+		return operator != nil && strings.EqualFold(strings.TrimSpace(operator.Name), strings.TrimSpace(o.Operator))
+	}
+	return strings.TrimSuffix(o.Log, "/") == strings.TrimSuffix(logInfo.URL, "/") || o.Log == logInfo.Description
+}
+
+// apply replaces the settings of cfg the override sets.
+func (o *filterOverride) apply(cfg *config) {
+	if o.Match != nil {
+		cfg.Match = o.match
+		if *o.Match == "" {
+			cfg.Match = nil
+		}
+	}
+	if o.IncludeIssuer != nil {
+		cfg.IncludeIssuers = o.include
+	}
+	if o.ExcludeIssuer != nil {
+		cfg.ExcludeIssuers = o.exclude
+	}
+	if o.IPOnly != nil {
+		cfg.IPOnly = *o.IPOnly
+	}
+	if o.SkipNameless != nil {
+		cfg.SkipNameless = *o.SkipNameless
+	}
+	if o.FutureOnly != nil {
+		cfg.FutureOnly = *o.FutureOnly
+	}
+	if o.Timeout != nil {
+		cfg.RequestTimeout = o.timeout
+	}
+	if o.StartIndex != nil {
+		cfg.StartIndex = o.StartIndex
+	}
+	if o.leafHash != nil {
+		cfg.StartLeafHash = o.leafHash
+	}
+}
+
+// parseLeafHash decodes a SHA-256 Merkle leaf hash given in base64 or hex.
+func parseLeafHash(s string) ([]byte, error) {
+	hash, err := hex.DecodeString(s)
+	if err != nil {
+		hash, err = base64.StdEncoding.DecodeString(s)
+	}
+	if err != nil || len(hash) != sha256.Size {
+		return nil, fmt.Errorf("%q is not a SHA-256 leaf hash in base64 or hex", s)
+	}
+	return hash, nil
+}
+
+// forLog returns the configuration a monitor of logInfo runs with: cfg
+// itself, or when -log-filters overrides apply to the log, a copy with
+// them applied. The operator's overrides are applied first, then the
+// log's, each in file order, so that the most specific wins.
+func (cfg *config) forLog(operator *Operator, logInfo LogInfo) *config {
+	effective := cfg
+	for _, operatorLevel := range []bool{true, false} {
+		for i := range cfg.filterOverrides {
+			o := &cfg.filterOverrides[i]
+			if (o.Operator != "") != operatorLevel || !o.appliesTo(operator, logInfo) {
+				continue
+			}
+			if effective == cfg {
+				c := *cfg
+				effective = &c
+			}
+			o.apply(effective)
+		}
+	}
+	return effective
+}
+
+// unusedFilterOverrides returns a warning for each override that applies
+// to none of logs, which is probably misspelled.
+func unusedFilterOverrides(cfg *config, operatorOf map[string]*Operator, logs []LogInfo) []string {
+	var warnings []string
+	for i := range cfg.filterOverrides {
+		o := &cfg.filterOverrides[i]
+		used := false
+		for _, l := range logs {
+			used = used || o.appliesTo(operatorOf[l.URL], l)
+		}
+		if !used {
+			what := "log " + o.Log
+			if o.Operator != "" {
+				what = "operator " + o.Operator
+			}
+			warnings = append(warnings, fmt.Sprintf("the -log-filters override for %s applies to none of the monitored logs", what))
+		}
+	}
+	return warnings
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+)
+
+// id returns the log's ID, the SHA-256 hash of its public key as used in
+// SCTs, base64 encoded as in the log list. It is computed from the key the
+// list gives, falling back to the list's log_id; logs given by URL alone
+// have neither, and an empty ID.
+func (l *LogInfo) id() string {
+	if key, err := base64.StdEncoding.DecodeString(l.Key); err == nil && len(key) > 0 {
+		sum := sha256.Sum256(key)
+		return base64.StdEncoding.EncodeToString(sum[:])
+	}
+	return l.LogID
+}
+
+// logIDList is a repeatable flag of base64 log IDs, each flag a
+// comma-separated list.
+type logIDList []string
+
+func (l *logIDList) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, ", ")
+}
+
+func (l *logIDList) Set(v string) error {
+	for _, id := range strings.Split(v, ",") {
+		id = strings.TrimSpace(id)
+		if raw, err := base64.StdEncoding.DecodeString(id); err != nil || len(raw) != sha256.Size {
+			return fmt.Errorf("%q is not a log ID (the base64 SHA-256 of the log's key)", id)
+		}
+		*l = append(*l, id)
+	}
+	return nil
+}
+
+// selectLogIDs returns the logs of operators with the given IDs. An ID that
+// is not one of their logs is an error, naming the operator it belongs to
+// if it is in the log list.
+func selectLogIDs(logList *LogList, operators []*Operator, ids []string) ([]LogInfo, error) {
+	var selected []LogInfo
+	for _, id := range ids {
+		found := false
+		for _, operator := range operators {
+			for _, l := range operator.Logs {
+				if l.id() == id && !found {
+					selected = append(selected, l)
+					found = true
+				}
+			}
+		}
+		if found {
+			continue
+		}
+		for _, op := range logList.Operators {
+			for _, l := range op.Logs {
+				if l.id() == id {
+					return nil, withCode(errCodeNoLogs, fmt.Errorf("log ID %s is %s, a log of the %s operator rather than %s; select its operator with -operator", id, l.Description, op.Name, operatorList(operators)))
+				}
+			}
+		}
+		return nil, withCode(errCodeNoLogs, fmt.Errorf("log ID %s is not in the log list", id))
+	}
+	return selected, nil
+}
+
+// logRefs is a repeatable flag of logs given by URL, description or ID, as
+// for -logs and -exclude-log.
+type logRefs []string
+
+func (l *logRefs) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, "; ")
+}
+
+func (l *logRefs) Set(v string) error {
+	if v = strings.TrimSpace(v); v == "" {
+		return fmt.Errorf("log must not be empty")
+	}
+	*l = append(*l, v)
+	return nil
+}
+
+// refersTo reports whether v, a URL, description or ID, names logInfo. URLs
+// match with or without a trailing slash and descriptions ignoring case.
+func refersTo(v string, logInfo LogInfo) bool {
+	return strings.TrimSuffix(v, "/") == strings.TrimSuffix(logInfo.URL, "/") || strings.EqualFold(v, logInfo.Description) || v == logInfo.id()
+}
+
+// has reports whether logInfo is one of the logs.
+func (l logRefs) has(logInfo LogInfo) bool {
+	for _, v := range l {
+		if refersTo(v, logInfo) {
+			return true
+		}
+	}
+	return false
+}
+
+// exclude returns logs without the ones in l, logging each it leaves out.
+func (l logRefs) exclude(logs []LogInfo) []LogInfo {
+	var kept []LogInfo
+	for _, logInfo := range logs {
+		if l.has(logInfo) {
+			log.Printf("Skipping %s: excluded by -exclude-log", logInfo.Description)
+			continue
+		}
+		kept = append(kept, logInfo)
+	}
+	return kept
+}
+
+// selectLogs returns the logs of operators that refs name, as for -logs. A
+// log that is not one of theirs is an error, naming the operator it belongs
+// to if it is in the log list.
+func selectLogs(logList *LogList, operators []*Operator, refs logRefs) ([]LogInfo, error) {
+	var selected []LogInfo
+	for _, v := range refs {
+		found := false
+		for _, operator := range operators {
+			for _, l := range operator.Logs {
+				if !refersTo(v, l) {
+					continue
+				}
+				found = true
+				if !slices.ContainsFunc(selected, func(s LogInfo) bool { return s.URL == l.URL }) {
+					selected = append(selected, l)
+				}
+			}
+		}
+		if found {
+			continue
+		}
+		for _, op := range logList.Operators {
+			for _, l := range op.Logs {
+				if refersTo(v, l) {
+					return nil, withCode(errCodeNoLogs, fmt.Errorf("-logs %s is %s, a log of the %s operator rather than %s; select its operator with -operator", v, l.Description, op.Name, operatorList(operators)))
+				}
+			}
+		}
+		return nil, withCode(errCodeNoLogs, fmt.Errorf("-logs %s is not in the log list", v))
+	}
+	return selected, nil
+}
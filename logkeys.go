@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log"
+
+	ct "github.com/google/certificate-transparency-go"
+	"github.com/google/certificate-transparency-go/x509"
+)
+
+// sthVerifyingLog checks the signature of every tree head a log returns
+// against the log's key from the log list. A tree head that does not verify
+// was not signed by the log: the connection may be intercepted, or the log
+// list tampered with. It fails the request, so that no entries are read
+// on the strength of it.
+type sthVerifyingLog struct {
+	ctLog
+	verifier *ct.SignatureVerifier
+}
+
+// withSTHVerification returns c, wrapped in an sthVerifyingLog when the log
+// list gives logInfo's key. Tiled logs sign checkpoints rather than RFC 6962
+// tree heads, which are not verified yet.
+func withSTHVerification(c ctLog, logInfo LogInfo) ctLog {
+	if logInfo.Key == "" || logInfo.tiled() {
+		return c
+	}
+	der, err := base64.StdEncoding.DecodeString(logInfo.Key)
+	if err != nil {
+		log.Printf("Warning: the key of %s in the log list is not valid base64, not verifying its tree heads: %v", logInfo.Description, err)
+		return c
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		log.Printf("Warning: the key of %s in the log list cannot be parsed, not verifying its tree heads: %v", logInfo.Description, err)
+		return c
+	}
+	verifier, err := ct.NewSignatureVerifier(key)
+	if err != nil {
+		log.Printf("Warning: the key of %s in the log list is not usable, not verifying its tree heads: %v", logInfo.Description, err)
+		return c
+	}
+	return &sthVerifyingLog{ctLog: c, verifier: verifier}
+}
+
+func (l *sthVerifyingLog) GetSTH(ctx context.Context) (*ct.SignedTreeHead, error) {
+	sth, err := l.ctLog.GetSTH(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := l.verifier.VerifySTHSignature(*sth); err != nil {
+		return nil, fmt.Errorf("SECURITY WARNING: the tree head of size %d is not signed with the log's key from the log list; the connection to the log may be intercepted or the log list tampered with: %w", sth.TreeSize, err)
+	}
+	return sth, nil
+}
+
+// checkLogKey compares the ID of logInfo's key in the log list with the
+// one the previous run saw, logging a warning when it changed, and
+// remembers it in state for the next run. Logs do not change their keys,
+// so a change means the log list was edited or tampered with.
+func checkLogKey(state *stateStore, logInfo LogInfo) {
+	id := logInfo.id()
+	if state == nil || id == "" {
+		return
+	}
+	if previous, changed := state.setLogID(logInfo.URL, id); changed {
+		log.Printf("SECURITY WARNING: the key of %s in the log list has changed since a previous run: its log ID is now %s, was %s. Unless the log list was deliberately changed, it may have been tampered with.", logInfo.Description, id, previous)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// getLogLists fetches several log lists (e.g. Google's and Apple's) and
+// merges them with mergeLogLists.
+func getLogLists(urls []string) (*LogList, error) {
+	var lists []*LogList
+	for _, url := range urls {
+		logList, err := getLogList(url)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", url, err)
+		}
+		lists = append(lists, logList)
+	}
+	return mergeLogLists(lists...), nil
+}
+
+// mergeLogLists combines log lists into one. Operators are matched by name
+// and logs by URL; the first list a log appears in wins.
+func mergeLogLists(lists ...*LogList) *LogList {
+	merged := &LogList{}
+	operators := make(map[string]int) // name -> index into merged.Operators
+	seen := make(map[string]bool)     // normalized log URLs
+	for _, logList := range lists {
+		for _, operator := range logList.Operators {
+			i, ok := operators[operator.Name]
+			if !ok {
+				i = len(merged.Operators)
+				operators[operator.Name] = i
+				merged.Operators = append(merged.Operators, Operator{Name: operator.Name, Email: operator.Email})
+			}
+			for _, logInfo := range operator.Logs {
+				key := strings.TrimSuffix(logInfo.URL, "/")
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+				merged.Operators[i].Logs = append(merged.Operators[i].Logs, logInfo)
+			}
+		}
+	}
+	return merged
+}
@@ -1,8 +1,12 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -13,9 +17,12 @@ import (
 	"sync"
 	"time"
 
+	ct "github.com/google/certificate-transparency-go"
 	"github.com/google/certificate-transparency-go/client"
 	"github.com/google/certificate-transparency-go/jsonclient"
-	"github.com/google/certificate-transparency-go/x509"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
@@ -29,142 +36,1162 @@ type LogList struct {
 
 type Operator struct {
 	Name  string    `json:"name"`
-	Email []string  `json:"email"` // Changed from string to []string
+	Email emailList `json:"email"`
 	Logs  []LogInfo `json:"logs"`
+	// TiledLogs serve the static CT API; getLogList moves them into Logs.
+	TiledLogs []LogInfo `json:"tiled_logs,omitempty"`
+}
+
+// emailList is an operator's contact addresses. The v3 schema has an array;
+// older log lists have a single string, which is accepted too.
+type emailList []string
+
+func (e *emailList) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*e = nil
+		if one != "" {
+			*e = emailList{one}
+		}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return fmt.Errorf("email must be a string or an array of strings: %w", err)
+	}
+	*e = many
+	return nil
 }
 
 type LogInfo struct {
-	URL         string `json:"url"`
-	Description string `json:"description"`
+	URL              string            `json:"url"`
+	Description      string            `json:"description"`
+	LogID            string            `json:"log_id,omitempty"`
+	TemporalInterval *TemporalInterval `json:"temporal_interval,omitempty"`
+	// MMD is the log's maximum merge delay in seconds, if the list has it.
+	MMD int `json:"mmd,omitempty"`
+	// State has a single key naming the log's state, e.g. "usable".
+	State map[string]json.RawMessage `json:"state,omitempty"`
+	// SubmissionURL and MonitoringURL replace URL for tiled logs.
+	SubmissionURL string `json:"submission_url,omitempty"`
+	MonitoringURL string `json:"monitoring_url,omitempty"`
+	// Key is the log's base64 DER public key, from which its ID is
+	// computed (see id).
+	Key string `json:"key,omitempty"`
 }
 
 func main() {
-	// Get the list of logs
-	logList, err := getLogList(logListURL)
-	if err != nil {
-		log.Fatalf("Failed to get log list: %v", err)
+	cfg := parseFlags()
+
+	if cfg.Version {
+		if err := printVersion(os.Stdout, cfg, cfg.VersionJSON); err != nil {
+			fatal(errCodeStartup, "Failed to print the version: %v", err)
+		}
+		return
+	}
+	if cfg.Healthcheck {
+		addr := cfg.ControlAddr
+		if addr == "" {
+			addr = cfg.MetricsAddr
+		}
+		os.Exit(runHealthcheck(addr))
 	}
 
-	var googleLogs []LogInfo
-	foundOperator := false
-	for _, operator := range logList.Operators {
-		if operator.Name == "Google" {
-			googleLogs = operator.Logs
-			foundOperator = true
-			break
+	for _, warning := range filterWarnings(cfg) {
+		log.Printf("Warning: %s", warning)
+	}
+	if cfg.ExplainFilters {
+		if err := explainFilters(cfg, flag.Args(), os.Stdin, os.Stdout); err != nil {
+			fatal(errCodeStartup, "Failed to read names: %v", err)
+		}
+		return
+	}
+
+	if cfg.OTLPEndpoint != "" {
+		shutdownTracing, err := setupTracing(context.Background(), cfg.OTLPEndpoint)
+		if err != nil {
+			fatal(errCodeStartup, "Failed to set up tracing: %v", err)
+		}
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := shutdownTracing(ctx); err != nil {
+				log.Printf("Failed to flush traces: %v", err)
+			}
+		}()
+	}
+
+	// Get the list of logs. A -replay reads its logs from the archive
+	// instead, without a network.
+	logList := &LogList{}
+	var err error
+	var replayLogs []replayLog
+	if cfg.Replay != "" {
+		if replayLogs, err = archivedLogs(cfg.Replay); err != nil {
+			fatal(errCodeNoLogs, "Failed to read -replay: %v", err)
+		}
+	} else {
+		startupStep(cfg, "get log list", func() (err error) {
+			logList, err = getConfiguredLogList(cfg)
+			return err
+		})
+	}
+
+	if cfg.ListOperators {
+		listOperators(logList)
+		return
+	}
+
+	cfg.logNames = newLogNameTable(logList)
+	if cfg.CheckInclusion != "" {
+		os.Exit(checkInclusion(cfg, logList))
+	}
+	if cfg.MaxRequestsPerMinute > 0 {
+		cfg.budget = newRequestBudget(cfg.MaxRequestsPerMinute)
+	}
+
+	if cfg.ConnStatsInterval > 0 {
+		cfg.connStats = newConnStats()
+	}
+
+	var state *stateStore
+	if cfg.StateFile != "" {
+		state, err = loadState(cfg.StateFile)
+		if err != nil {
+			fatal(errCodeStartup, "Failed to load state: %v", err)
+		}
+	}
+	if cfg.ShowState {
+		if state == nil {
+			fatal(errCodeConfig, "-show-state needs -state-file")
+		}
+		os.Exit(showState(cfg, logList, state))
+	}
+
+	// A log list without the logs we are after may be fixed upstream, so
+	// with -no-fatal each retry fetches it again.
+	var operatorOf map[string]*Operator
+	var selectedLogs []LogInfo
+	var fromStart map[string]bool
+	refetch := false
+	if cfg.Replay == "" {
+		startupStep(cfg, "select logs", func() (err error) {
+			if refetch {
+				if logList, err = getConfiguredLogList(cfg); err != nil {
+					return err
+				}
+				cfg.logNames.set(logList)
+			}
+			refetch = true
+			operatorOf, selectedLogs, fromStart, err = selectOperatorLogs(cfg, logList, state)
+			return err
+		})
+	}
+
+	if cfg.Replay == "" {
+		for _, warning := range unusedFilterOverrides(cfg, operatorOf, selectedLogs) {
+			log.Printf("Warning: %s", warning)
+		}
+	}
+
+	if cfg.ShardCount > 1 {
+		selectedLogs = partitionLogs(selectedLogs, cfg.ShardIndex, cfg.ShardCount)
+		log.Printf("Instance %d of %d: monitoring %d logs", cfg.ShardIndex, cfg.ShardCount, len(selectedLogs))
+		// With more instances than logs some have nothing to do; they stay
+		// up rather than exiting so that replicas are not restarted in a
+		// loop.
+	}
+	if n := len(selectedLogs); n > 0 {
+		if selectedLogs = applyCheckMMD(cfg, selectedLogs); len(selectedLogs) == 0 {
+			fatal(errCodeNoLogs, "None of the %d logs has an STH within its maximum merge delay", n)
+		}
+	}
+	selectedLogs = applyMaxLogs(cfg, selectedLogs)
+
+	if len(cfg.CompareLogs) > 0 {
+		if err := checkCompareLogs(cfg, selectedLogs); err != nil {
+			fatal(errCodeConfig, "%v", err)
+		}
+	}
+
+	if cfg.ProbeLogs {
+		os.Exit(probeLogs(cfg, selectedLogs))
+	}
+	if cfg.ListRoots {
+		os.Exit(listRoots(cfg, selectedLogs))
+	}
+
+	if cfg.PIDFile != "" {
+		if err := writePIDFile(cfg.PIDFile); err != nil {
+			fatal(errCodeStartup, "Failed to write -pidfile: %v", err)
+		}
+		defer removePIDFile(cfg.PIDFile)
+	}
+
+	events := newBroadcaster()
+	if cfg.GRPCAddr != "" {
+		srv, err := startGRPCServer(cfg.GRPCAddr, cfg, events)
+		if err != nil {
+			fatal(errCodeStartup, "Failed to start gRPC server: %v", err)
+		}
+		defer srv.Stop()
+	}
+
+	var syslogSub *subscription
+	if cfg.Syslog != "" {
+		syslogSub = events.subscribeMatching(cfg.SinkBuffer, cfg.SinkOverflow, cfg.SinkMatch.matcher(cfg, "syslog"))
+		if err := runSyslogSink(cfg, syslogSub); err != nil {
+			fatal(errCodeStartup, "Failed to set up syslog: %v", err)
+		}
+	}
+
+	var certDirSub *subscription
+	if cfg.CertDir != "" {
+		certDirSub = events.subscribeMatching(cfg.SinkBuffer, cfg.SinkOverflow, cfg.SinkMatch.matcher(cfg, "cert-dir"))
+		if err := runCertDirSink(cfg.CertDir, certDirSub); err != nil {
+			fatal(errCodeStartup, "Failed to set up -cert-dir: %v", err)
+		}
+	}
+
+	if len(cfg.CompareLogs) > 0 {
+		// A dropped event would be reported as a missing certificate, so
+		// the comparison holds up the monitors instead.
+		runCompareSink(cfg, events.subscribe(cfg.SinkBuffer, overflowBlock))
+	}
+
+	var natsSub *subscription
+	var natsStopped <-chan struct{}
+	if cfg.NATSURL != "" {
+		natsSub = events.subscribeMatching(cfg.SinkBuffer, cfg.SinkOverflow, cfg.SinkMatch.matcher(cfg, "nats"))
+		if natsStopped, err = runNATSSink(cfg, natsSub); err != nil {
+			fatal(errCodeStartup, "Failed to set up NATS: %v", err)
 		}
 	}
 
-	if !foundOperator {
-		log.Fatal("Google operator not found in the log list.")
+	var execSub *subscription
+	var execStopped <-chan struct{}
+	if cfg.Exec != "" {
+		execSub = events.subscribeMatching(cfg.SinkBuffer, cfg.SinkOverflow, cfg.SinkMatch.matcher(cfg, "exec"))
+		execStopped = runExecSink(cfg, execSub)
 	}
 
-	if len(googleLogs) == 0 {
-		log.Fatal("No logs found for the Google operator.")
+	var digestSub *subscription
+	var digestStopped <-chan struct{}
+	if cfg.Digest != "" {
+		digestSub = events.subscribeMatching(cfg.SinkBuffer, cfg.SinkOverflow, cfg.SinkMatch.matcher(cfg, "digest"))
+		digestStopped = runDigestSink(cfg, digestSub)
 	}
 
-	var wg sync.WaitGroup
+	// done is closed on shutdown, to stop the monitors and whatever else
+	// runs until then.
 	done := make(chan struct{})
 
-	for _, logInfo := range googleLogs {
-		wg.Add(1)
-		go monitorLog(logInfo, &wg, done)
+	var esSub *subscription
+	var esStopped <-chan struct{}
+	if cfg.ESURL != "" {
+		esSub = events.subscribeMatching(cfg.SinkBuffer, cfg.SinkOverflow, cfg.SinkMatch.matcher(cfg, "elasticsearch"))
+		if esStopped, err = runElasticsearchSink(cfg, esSub); err != nil {
+			fatal(errCodeStartup, "Failed to set up Elasticsearch: %v", err)
+		}
+	}
+
+	var webhookSub *subscription
+	var webhookStopped <-chan struct{}
+	if cfg.Webhook != "" {
+		webhookSub = events.subscribeMatching(cfg.SinkBuffer, cfg.SinkOverflow, cfg.SinkMatch.matcher(cfg, "webhook"))
+		if webhookStopped, err = runWebhookSink(cfg, webhookSub, done); err != nil {
+			fatal(errCodeStartup, "Failed to set up -webhook: %v", err)
+		}
+	}
+
+	var objectSub *subscription
+	var objectStopped <-chan struct{}
+	if cfg.ObjectStore != "" {
+		objectSub = events.subscribeMatching(cfg.SinkBuffer, cfg.SinkOverflow, cfg.SinkMatch.matcher(cfg, "object-store"))
+		if objectStopped, err = runObjectStoreSink(cfg, objectSub); err != nil {
+			fatal(errCodeStartup, "Failed to set up -object-store: %v", err)
+		}
 	}
 
-	// Wait for a signal to gracefully shut down
+	var protoSub *subscription
+	var protoStopped <-chan struct{}
+	if cfg.ProtoOut != "" {
+		protoSub = events.subscribeMatching(cfg.SinkBuffer, cfg.SinkOverflow, cfg.SinkMatch.matcher(cfg, "proto-out"))
+		if protoStopped, err = runProtoSink(cfg, cfg.ProtoOut, protoSub); err != nil {
+			fatal(errCodeStartup, "Failed to set up -proto-out: %v", err)
+		}
+	}
+
+	pause := newPauseState()
+	status := newStatusBoard(cfg.budget)
+	var validity *validityHistogram
+	if cfg.ValidityStatsInterval > 0 {
+		validity = newValidityHistogram()
+		status.validity = validity
+	}
+
+	sh := &shared{cfg: cfg, events: events, pause: pause, status: status, filters: buildFilters(cfg), validity: validity}
+	monitors := newMonitorSet(sh, done)
+	if cfg.ControlAddr != "" {
+		srv, err := startControlServer(cfg.ControlAddr, cfg, pause, status, monitors.logs)
+		if err != nil {
+			fatal(errCodeStartup, "Failed to start control server: %v", err)
+		}
+		defer srv.Close()
+	}
+
+	if cfg.FlushInterval > 0 {
+		go stdout.flushEvery(cfg.FlushInterval, done)
+	}
+	if cfg.MaxOutputRate > 0 {
+		sh.throttle = newOutputThrottle(cfg.MaxOutputRate)
+		go sh.throttle.reportEvery(throttleReportInterval, done)
+	}
+	if cfg.ReorderWindow > 0 {
+		sh.reorder = newReorderBuffer(cfg.ReorderWindow, cfg.ReorderMax)
+		go sh.reorder.run(done)
+	}
+	if cfg.ExitAfterIdle > 0 {
+		sh.idle = newIdleTracker(time.Now())
+	}
+	var limitReached <-chan struct{}
+	if cfg.Limit > 0 {
+		sh.limit = newEmitLimit(cfg.Limit)
+		limitReached = sh.limit.reached
+	}
+
+	var statsd *statsdRecorder
+	if cfg.StatsdAddr != "" {
+		statsd, err = newStatsdRecorder(cfg.StatsdAddr, cfg.StatsdTags)
+		if err != nil {
+			fatal(errCodeStartup, "Failed to set up statsd: %v", err)
+		}
+		metrics = statsd
+		go statsd.flushEvery(statsdFlushInterval, done)
+	}
+	if cfg.MetricsAddr != "" {
+		prom := newPromRecorder(metrics)
+		metrics = prom
+		srv, err := startMetricsServer(cfg.MetricsAddr, cfg, prom, pause, status)
+		if err != nil {
+			fatal(errCodeStartup, "Failed to start metrics server: %v", err)
+		}
+		defer srv.Close()
+	}
+	if statsd != nil || cfg.MetricsAddr != "" {
+		go status.recordGaugesEvery(statsdFlushInterval, done)
+	}
+	var summary *runSummary
+	if cfg.Summary {
+		summary = newRunSummary(metrics)
+		metrics = summary
+	}
+
+	if validity != nil {
+		go validity.reportEvery(cfg.ValidityStatsInterval, done)
+	}
+
+	if cfg.connStats != nil {
+		go cfg.connStats.reportEvery(cfg.ConnStatsInterval, done)
+	}
+
+	if cfg.Dedup {
+		newDedup := func() *deduplicator {
+			if cfg.DedupWindow > 0 {
+				d := newWindowDeduplicator(cfg.DedupWindow)
+				go d.expireEvery(min(cfg.DedupWindow, time.Minute), done)
+				return d
+			}
+			return newDeduplicator(cfg.DedupSize)
+		}
+		sh.dedup = newDedup()
+		if cfg.Format == formatNames {
+			sh.nameDedup = newDedup()
+		}
+		if cfg.DedupStatsInterval > 0 {
+			go reportDedupStats(sh.dedup, cfg.DedupStatsInterval, done)
+		}
+	}
+
+	if state != nil {
+		sh.state = state
+		go sh.state.saveEvery(stateSaveInterval, done)
+	}
+
+	if cfg.ArchiveDir != "" {
+		sh.archive, err = newRawArchive(cfg.ArchiveDir, cfg.ArchiveMaxBytes)
+		if err != nil {
+			fatal(errCodeStartup, "Failed to set up -archive-dir: %v", err)
+		}
+	}
+
+	if cfg.KeyReuse {
+		sh.keys = newKeyReuseTracker(cfg.KeyReuseSize)
+	}
+	if cfg.SerialReuse {
+		sh.serials = newSerialTracker(cfg.SerialReuseSize)
+		if cfg.SerialReuseFile != "" {
+			if err := sh.serials.load(cfg.SerialReuseFile); err != nil {
+				fatal(errCodeStartup, "Failed to load serial numbers: %v", err)
+			}
+			go sh.serials.saveEvery(cfg.SerialReuseFile, stateSaveInterval, done)
+		}
+	}
+
+	if cfg.AlertThreshold > 0 {
+		sh.alert = newRateAlert(cfg.AlertMatch, cfg.AlertWindow, cfg.AlertThreshold)
+	}
+
+	if cfg.LinkPrecerts > 0 {
+		sh.links = newPrecertLinker(cfg.LinkPrecerts)
+		go sh.links.expireEvery(max(cfg.LinkPrecerts/10, time.Second), done)
+	}
+
+	if cfg.Resolve {
+		sh.resolver = newNameResolver(cfg.ResolveConcurrency)
+	}
+
+	if cfg.MaxMemory > 0 {
+		sh.memory = newMemoryBudget(cfg.MaxMemory, func() {
+			if sh.dedup != nil {
+				sh.dedup.trim()
+			}
+			if sh.nameDedup != nil {
+				sh.nameDedup.trim()
+			}
+			if sh.reorder != nil {
+				sh.reorder.flush()
+			}
+		})
+		go sh.memory.watch(done)
+	}
+
+	for _, logInfo := range selectedLogs {
+		monitors.start(operatorOf[logInfo.URL], logInfo, fromStart[logInfo.URL])
+	}
+	var replayed <-chan struct{}
+	if cfg.Replay != "" {
+		replayed = startReplay(sh, replayLogs, &monitors.wg, done)
+	}
+
+	// Wait for a signal, the end of -max-runtime or -exit-after-idle, the
+	// -limit or the end of a -replay, to gracefully shut down. All take the same shutdown path.
+	// SIGHUP reloads in the meantime, except during a -replay, which has no
+	// log list to reload.
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt)
-	<-sigChan
+	hup := make(chan os.Signal, 1)
+	if cfg.Replay == "" {
+		signal.Notify(hup, hangupSignal)
+	}
+	var runtimeExpired <-chan time.Time
+	if cfg.MaxRuntime > 0 {
+		timer := time.NewTimer(cfg.MaxRuntime)
+		defer timer.Stop()
+		runtimeExpired = timer.C
+	}
+	var idleCheck <-chan time.Time
+	if sh.idle != nil {
+		ticker := time.NewTicker(idleCheckInterval(cfg.ExitAfterIdle))
+		defer ticker.Stop()
+		idleCheck = ticker.C
+	}
+	// With -current-shard the monitors move on to the next shard when the
+	// current one's interval ends.
+	var shardBoundary <-chan time.Time
+	if cfg.CurrentShard && cfg.Replay == "" {
+		shardBoundary = time.After(untilShardBoundary(monitors.logs(), time.Now()))
+	}
+	var logListRefresh <-chan time.Time
+	if cfg.LogListRefresh > 0 && cfg.Replay == "" {
+		ticker := time.NewTicker(cfg.LogListRefresh)
+		defer ticker.Stop()
+		logListRefresh = ticker.C
+	}
+wait:
+	for {
+		select {
+		case <-hup:
+			reloadConfig(cfg, monitors, state)
+			if cfg.CurrentShard {
+				shardBoundary = time.After(untilShardBoundary(monitors.logs(), time.Now()))
+			}
+		case <-shardBoundary:
+			log.Printf("Looking for the current shard of each log")
+			reselectLogs(cfg, monitors, state)
+			shardBoundary = time.After(untilShardBoundary(monitors.logs(), time.Now()))
+		case <-logListRefresh:
+			log.Printf("Refreshing the log list")
+			reselectLogs(cfg, monitors, state)
+			if cfg.CurrentShard {
+				shardBoundary = time.After(untilShardBoundary(monitors.logs(), time.Now()))
+			}
+		case <-sigChan:
+			break wait
+		case <-runtimeExpired:
+			log.Printf("Maximum runtime of %s reached", cfg.MaxRuntime)
+			break wait
+		case <-replayed:
+			log.Printf("Replay finished")
+			break wait
+		case <-limitReached:
+			log.Printf("Emitted the -limit of %d certificates", cfg.Limit)
+			break wait
+		case now := <-idleCheck:
+			if idle := sh.idle.idleFor(now); idle >= cfg.ExitAfterIdle {
+				log.Printf("No new entries in any log for %s, exiting", idle.Round(time.Second))
+				break wait
+			}
+		}
+	}
 
 	log.Println("Shutting down...")
 	close(done)
-	wg.Wait()
+	// -shutdown-timeout bounds the whole shutdown, not each step of it.
+	shutdownCtx, cancelShutdown := context.Background(), context.CancelFunc(func() {})
+	if cfg.ShutdownTimeout > 0 {
+		shutdownCtx, cancelShutdown = context.WithTimeout(shutdownCtx, cfg.ShutdownTimeout)
+	}
+	defer cancelShutdown()
+	if !waitTimeout(&monitors.wg, cfg.ShutdownTimeout) {
+		var stuck []string
+		for _, st := range status.snapshot() {
+			if st.Running {
+				stuck = append(stuck, st.Description)
+			}
+		}
+		log.Printf("Warning: monitors still running after %s, exiting without them: %s", cfg.ShutdownTimeout, strings.Join(stuck, ", "))
+	}
+	events.close()
+	if sh.archive != nil {
+		sh.archive.close()
+	}
+	if syslogSub != nil && syslogSub.Dropped() > 0 {
+		log.Printf("Syslog sink fell behind and missed %d events", syslogSub.Dropped())
+	}
+	if certDirSub != nil && certDirSub.Dropped() > 0 {
+		log.Printf("Certificate directory sink fell behind and missed %d events", certDirSub.Dropped())
+	}
+	if sh.reorder != nil {
+		sh.reorder.flush()
+	}
+	// The sinks drain what the monitors published, all within what is left
+	// of the one -shutdown-timeout.
+	type pending struct {
+		name string
+		done <-chan struct{}
+		sub  *subscription // nil for the -resolve lookups
+	}
+	var waits []pending
+	for _, p := range []pending{
+		{"Elasticsearch sink", esStopped, esSub},
+		{"-webhook sink", webhookStopped, webhookSub},
+		{"NATS sink", natsStopped, natsSub},
+		{"-exec sink", execStopped, execSub},
+		{"-digest sink", digestStopped, digestSub},
+		{"-object-store sink", objectStopped, objectSub},
+		{"-proto-out sink", protoStopped, protoSub},
+	} {
+		if p.sub != nil {
+			waits = append(waits, p)
+		}
+	}
+	if sh.resolver != nil {
+		waits = append(waits, pending{name: "-resolve lookups", done: sh.resolver.close()})
+	}
+	for _, p := range waits {
+		select {
+		case <-p.done:
+		default:
+			select {
+			case <-p.done:
+			case <-shutdownCtx.Done():
+				log.Printf("Warning: %s still busy %s into shutdown, exiting without waiting for it", p.name, cfg.ShutdownTimeout)
+			}
+		}
+		if p.sub != nil && p.sub.Dropped() > 0 {
+			log.Printf("%s fell behind and missed %d events", p.name, p.sub.Dropped())
+		}
+	}
+	if err := stdout.Flush(); err != nil {
+		log.Printf("Failed to flush output: %v", err)
+	}
+	if statsd != nil {
+		statsd.flush()
+	}
+	if sh.state != nil {
+		if err := sh.state.save(); err != nil {
+			log.Printf("Failed to save state: %v", err)
+		}
+	}
+	if sh.serials != nil && cfg.SerialReuseFile != "" {
+		if err := sh.serials.save(cfg.SerialReuseFile); err != nil {
+			log.Printf("Failed to save serial numbers: %v", err)
+		}
+	}
+	if sh.dedup != nil && cfg.DedupStatsInterval > 0 {
+		logDedupStats(sh.dedup.stats())
+	}
+	if cfg.connStats != nil {
+		cfg.connStats.report()
+	}
+	if validity != nil {
+		validity.report()
+	}
+	if summary != nil {
+		summary.report()
+	}
 	log.Println("All monitors stopped.")
 }
 
-func monitorLog(logInfo LogInfo, wg *sync.WaitGroup, done <-chan struct{}) {
+// shared holds the state shared by all monitors.
+type shared struct {
+	cfg    *config
+	events *broadcaster
+	pause  *pauseState
+	status *statusBoard
+	dedup  *deduplicator // nil unless -dedup is set
+
+	// nameDedup remembers the names already printed by -format=names when
+	// -dedup is set.
+	nameDedup *deduplicator
+
+	// alert is the issuance rate alert; nil unless -alert-threshold is set.
+	alert *rateAlert
+
+	// state persists resume positions; nil unless -state-file is set.
+	state *stateStore
+
+	// filters select the certificates to emit.
+	filters []certFilter
+
+	// serials spots reused serial numbers; nil unless -serial-reuse is set.
+	serials *serialTracker
+
+	// keys counts reused public keys; nil unless -key-reuse is set.
+	keys *keyReuseTracker
+
+	// memory applies -max-memory; nil without a budget.
+	memory *memoryBudget
+
+	// links pairs precertificates with their final certificates; nil unless
+	// -link-precerts is set.
+	links *precertLinker
+
+	// resolver looks up printed names in DNS; nil unless -resolve is set.
+	resolver *nameResolver
+
+	// archive stores the raw entries; nil unless -archive-dir is set.
+	archive *rawArchive
+
+	// validity counts certificate lifetimes; nil unless -validity-stats is
+	// set.
+	validity *validityHistogram
+
+	// throttle caps the certificates printed on stdout; nil unless
+	// -max-output-rate is set.
+	throttle *outputThrottle
+
+	// reorder sorts stdout output by timestamp; nil unless
+	// -reorder-window is set.
+	reorder *reorderBuffer
+
+	// idle records when entries were last processed; nil unless
+	// -exit-after-idle is set.
+	idle *idleTracker
+
+	// limit counts down -limit; nil without one.
+	limit *emitLimit
+}
+
+// waitTimeout waits for wg, giving up after timeout (if positive). It
+// reports whether wg finished.
+func waitTimeout(wg *sync.WaitGroup, timeout time.Duration) bool {
+	if timeout <= 0 {
+		wg.Wait()
+		return true
+	}
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-finished:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// newLogClient creates a CT client for logInfo. Each log gets its own
+// connection pool, capped at -max-conns-per-log, so a slow or very busy log
+// cannot tie up connections needed by the others. The returned transport
+// records any Retry-After the log sends so that rate-limited monitors wait
+// as long as they are asked to. For a tiled log the client talks to its
+// submission URL, which serves the RFC 6962 write API and get-roots.
+func newLogClient(cfg *config, logInfo LogInfo) (*client.LogClient, *retryAfterTransport, error) {
+	transport := newLogRoundTripper(cfg, logInfo)
+	rawURL := logInfo.URL
+	if logInfo.tiled() && logInfo.SubmissionURL != "" {
+		rawURL = logInfo.SubmissionURL
+	}
+	baseURL, err := logBaseURL(rawURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	logClient, err := client.New(baseURL, &http.Client{Transport: transport}, jsonclient.Options{Authorization: cfg.Authorization})
+	if err != nil {
+		return nil, nil, err
+	}
+	return logClient, transport, nil
+}
+
+// newLogRoundTripper returns the transport stack requests to logInfo go
+// through.
+func newLogRoundTripper(cfg *config, logInfo LogInfo) *retryAfterTransport {
+	var base http.RoundTripper = &jsonOnlyTransport{base: newLogTransport(cfg)}
+	if cfg.RequestTimeout > 0 {
+		base = &timeoutTransport{base: base, timeout: cfg.RequestTimeout, adaptive: cfg.AdaptiveTimeout}
+	}
+	if len(cfg.Headers) > 0 {
+		base = &headerTransport{base: base, headers: cfg.Headers}
+	}
+	if cfg.budget != nil {
+		base = &budgetTransport{base: base, budget: cfg.budget}
+	}
+	if cfg.RateLimit > 0 {
+		base = &rateLimitTransport{base: base, limiter: newRateLimiter(cfg.RateLimit)}
+	}
+	if cfg.connStats != nil {
+		base = &connStatsTransport{base: base, counts: cfg.connStats.forLog(logInfo.Description)}
+	}
+	return newRetryAfterTransport(base)
+}
+
+// monitorLog tails logInfo until done is closed. fromStart reads the log
+// from its first entry rather than its current end, for a shard that
+// appeared since the last run (see planRollover).
+func monitorLog(sh *shared, operator *Operator, logInfo LogInfo, fromStart bool, wg *sync.WaitGroup, done <-chan struct{}) {
 	defer wg.Done()
-	// Create a new CT client
-	logClient, err := client.New(logInfo.URL, http.DefaultClient, jsonclient.Options{})
+	cfg := sh.cfg.forLog(operator, logInfo)
+	filters := sh.filters
+	if cfg != sh.cfg {
+		filters = buildFilters(cfg)
+		log.Printf("Using the -log-filters overrides for %s", logInfo.Description)
+	}
+	sh.status.update(logInfo, func(st *logStatus) { st.Running = true })
+	defer sh.status.update(logInfo, func(st *logStatus) { st.Running = false })
+	checkLogKey(sh.state, logInfo)
+	logClient, transport, err := newMonitorClient(cfg, logInfo)
 	if err != nil {
 		log.Printf("Failed to create CT client for %s: %v", logInfo.Description, err)
 		return
 	}
 
+	// monitorCtx is cancelled on shutdown, so that requests waiting for the
+	// request budget or a slow log do not hold it up.
+	monitorCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-done:
+			cancel()
+		case <-monitorCtx.Done():
+		}
+	}()
+
 	// Get the initial STH (Signed Tree Head)
-	sth, err := logClient.GetSTH(context.Background())
+	sth, err := logClient.GetSTH(monitorCtx)
 	if err != nil {
+		metrics.count(metricSTHErrors, 1, logInfo.Description)
 		log.Printf("Failed to get initial STH for %s: %v", logInfo.Description, err)
 		return
 	}
 
 	log.Printf("Monitoring log: %s", logInfo.Description)
+	if cfg.VerifyConsistency && logInfo.tiled() {
+		log.Printf("%s is a tiled log, whose consistency -verify-consistency cannot check yet", logInfo.Description)
+	}
 	log.Printf("Initial tree size: %d", sth.TreeSize)
 
-	ticker := time.NewTicker(10 * time.Second)
+	// With -poll ticker the log is polled every pollInterval. With -poll
+	// continuous each poll waits only -poll-delay after the previous one
+	// finished: the select below asks for a fresh timer every time round
+	// the loop.
+	ticker := time.NewTicker(pollInterval)
 	defer ticker.Stop()
+	// behind is set when a poll stopped short of the tree head, as
+	// fetchEntries fetches a bounded number of entries at a time: the next
+	// poll follows straight away, so that a backfill runs at full speed and
+	// the monitor settles into polling on schedule once it has caught up.
+	behind := false
+	nextPoll := func() <-chan time.Time {
+		if behind {
+			now := make(chan time.Time, 1)
+			now <- time.Now()
+			return now
+		}
+		if cfg.Poll == pollContinuous {
+			return time.After(cfg.PollDelay)
+		}
+		return ticker.C
+	}
 
 	var nextIndex int64 = int64(sth.TreeSize)
 
+	// Detection latency is only measured for entries logged after the
+	// monitor started: for a backfill it would be the age of the backfill.
+	liveFrom := nextIndex
+
+	// With -reverse, -since is handled by walking backwards from the initial
+	// tree size (backIndex) while tailing forwards from it as usual.
+	var backIndex int64
+	var backCutoff time.Time
+	// A pinned start index takes precedence over a position saved by a
+	// previous run, which takes precedence over -since.
+	startIndex := cfg.StartIndex
+	if cfg.StartLeafHash != nil {
+		if index, err := startLeafIndex(monitorCtx, cfg, logInfo, sth); err != nil {
+			log.Printf("Warning: cannot start %s at its start_leaf_hash, starting as without it: %v", logInfo.Description, err)
+		} else {
+			startIndex = &index
+		}
+	}
+	resumed, pinned := false, startIndex != nil
+	if pinned {
+		nextIndex = *startIndex
+		if nextIndex > liveFrom {
+			log.Printf("Starting %s at its pinned start index %d, waiting for its tree size %d to reach it", logInfo.Description, nextIndex, liveFrom)
+		} else {
+			log.Printf("Starting %s at its pinned start index %d (%d entries behind)", logInfo.Description, nextIndex, liveFrom-nextIndex)
+		}
+	} else if cfg.FromNow {
+		log.Printf("Starting %s at its end, as -from-now ignores saved positions", logInfo.Description)
+	} else if sh.state != nil {
+		if saved, ok := sh.state.get(logInfo.URL); ok {
+			if saved.NextIndex <= nextIndex {
+				log.Printf("Resuming %s at index %d (%d entries behind), saved %s", logInfo.Description, saved.NextIndex, nextIndex-saved.NextIndex, saved.Updated.Format(time.RFC3339))
+				nextIndex = saved.NextIndex
+				resumed = true
+			} else {
+				log.Printf("Saved index %d of %s is beyond its tree size %d, ignoring it", saved.NextIndex, logInfo.Description, nextIndex)
+			}
+		}
+	}
+	if resumed || pinned || cfg.FromNow {
+		// Nothing to backfill.
+	} else if fromStart {
+		log.Printf("%s is a new shard following one read by the previous run, reading it from the start (%d entries)", logInfo.Description, nextIndex)
+		nextIndex = 0
+	} else if cfg.Since > 0 && cfg.Reverse {
+		backIndex = nextIndex
+		backCutoff = time.Now().Add(-cfg.Since)
+		log.Printf("Walking back through %s to entries logged at %s", logInfo.Description, backCutoff.Format(time.RFC3339))
+	} else if cfg.Since > 0 {
+		since := time.Now().Add(-cfg.Since)
+		index, err := findIndexByTime(monitorCtx, logClient, sth.TreeSize, since)
+		if err != nil {
+			log.Printf("Failed to find entries since %s in %s, starting at the end of the log: %v", since.Format(time.RFC3339), logInfo.Description, err)
+		} else {
+			log.Printf("Backfilling %d entries of %s logged since %s", nextIndex-index, logInfo.Description, since.Format(time.RFC3339))
+			nextIndex = index
+		}
+	} else if cfg.Lag > 0 {
+		lag := min(cfg.Lag, nextIndex)
+		log.Printf("Starting %d entries before the end of %s", lag, logInfo.Description)
+		nextIndex -= lag
+	}
+	// Downloading hundreds of millions of entries is more likely the result
+	// of a mistake, such as a lost or hand-edited state file, than intended.
+	// A pinned start index is deliberate.
+	if behindBy := liveFrom - nextIndex; !pinned && cfg.MaxBackfill > 0 && behindBy > cfg.MaxBackfill {
+		log.Printf("Warning: starting %s at index %d would backfill %d entries, more than -max-backfill %d; starting at the end of the log instead", logInfo.Description, nextIndex, behindBy, cfg.MaxBackfill)
+		nextIndex = liveFrom
+	}
+	// backfilling is set until the monitor has caught up with the tree
+	// size it started at; from there on it reads entries as they are logged.
+	// Both are read by the same loop from nextIndex on, so the handoff has
+	// neither a gap nor an overlap.
+	backfilling := nextIndex < liveFrom
+	sh.status.update(logInfo, func(st *logStatus) {
+		st.TreeSize = sth.TreeSize
+		st.NextIndex = nextIndex
+	})
+
+	// verifiedSTH is the latest tree head that has been proven consistent
+	// with its predecessors, for -verify-consistency. The monitor starts
+	// from the one a previous run saved, wherever it starts reading, so
+	// that what the log did while certtail was down is proven too.
+	verifiedSTH := sth
+	if prev := sh.state.verifiedSTH(logInfo.URL); prev != nil {
+		verifiedSTH = prev
+	}
+
+	breaker := newCircuitBreaker(cfg.BreakerFailures, cfg.BreakerCooldown)
+	// Failures repeated every tick are summarized once per -warn-interval.
+	warnings := newWarnCoalescer(cfg.WarnInterval)
+
+	// overloaded counts the polls in a row that failed with 429 or 5xx.
+	overloaded := 0
+
+	// pollFailed records a failed poll with the circuit breaker and then
+	// blocks for the duration of an announced Retry-After, if any, or of a
+	// backoff with jitter when the log answered 429 or 5xx. It returns false
+	// if the monitor was stopped while waiting.
+	pollFailed := func(err error) bool {
+		metrics.count(metricErrors, 1, logInfo.Description)
+		// An HTML page instead of JSON will not go away by retrying: the
+		// log is behind a proxy or login page that needs fixing.
+		var notJSON errNotJSON
+		if errors.As(err, &notJSON) && breaker.trip(time.Now()) {
+			log.Printf("Circuit breaker for %s is open because it returned an HTML page instead of JSON, pausing polls for %s; check for a proxy or authentication issue", logInfo.Description, cfg.BreakerCooldown)
+		} else if breaker.failure(time.Now()) {
+			log.Printf("Circuit breaker for %s is open after %d consecutive failures, pausing polls for %s", logInfo.Description, breaker.failures, cfg.BreakerCooldown)
+		}
+		sh.status.update(logInfo, func(st *logStatus) { st.Breaker = breaker.state.String() })
+
+		retryAfter := transport.retryAfter()
+		wait := retryAfter
+		if isOverloaded(err) {
+			overloaded++
+			wait = max(wait, pollBackoff(overloaded))
+		}
+		if wait == 0 {
+			return true
+		}
+		switch {
+		case wait > retryAfter:
+			log.Printf("%s is overloaded, backing off for %s", logInfo.Description, wait.Round(100*time.Millisecond))
+		case isRateLimited(err):
+			log.Printf("%s is rate limiting us, retrying after %s", logInfo.Description, wait.Round(time.Second))
+		default:
+			log.Printf("%s asked us to retry after %s", logInfo.Description, wait.Round(time.Second))
+		}
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			return true
+		case <-done:
+			return false
+		}
+	}
+
+	// pollSucceeded resets the circuit breaker after a successful poll.
+	pollSucceeded := func() {
+		overloaded = 0
+		if prev := breaker.success(); prev != breakerClosed {
+			log.Printf("%s is responding again, circuit breaker closed", logInfo.Description)
+		}
+		sh.status.update(logInfo, func(st *logStatus) {
+			st.LastSuccess = time.Now()
+			st.Breaker = breaker.state.String()
+		})
+	}
+
+	// archive hands fetched leaves to -archive-dir before they are parsed.
+	var archive func(start int64, leaves []ct.LeafEntry)
+	if sh.archive != nil {
+		archive = func(start int64, leaves []ct.LeafEntry) { sh.archive.write(operator, &logInfo, start, leaves) }
+	}
+
+	proc := &entryProcessor{sh: sh, cfg: cfg, filters: filters, logInfo: &logInfo, operator: operator, warnings: warnings, liveFrom: liveFrom}
+
+	// walkBack processes the next chunk of the log below backIndex, newest
+	// entry first, for -since with -reverse. It stops for good at the first
+	// entry logged before the cutoff.
+	walkBack := func(ctx context.Context) {
+		start := max(0, backIndex-int64(cfg.FetchConcurrency)*int64(cfg.BatchSize))
+		ctx, span := tracer.Start(ctx, "walkBack",
+			trace.WithAttributes(attribute.Int64("entries.start", start), attribute.Int64("entries.end", backIndex)))
+		entries, err := fetchEntries(ctx, logClient, start, backIndex, cfg.FetchConcurrency, cfg.BatchSize, cfg.MaxEntrySize, cfg.sampleEntry, archive)
+		endSpan(span, err)
+		if err != nil {
+			// Only a complete chunk can be walked newest-first; retry it.
+			warnings.warn("Failed to get entries for "+logInfo.Description+" while walking back", err, time.Now())
+			return
+		}
+		for i := len(entries) - 1; i >= 0; i-- {
+			entry := &entries[i]
+			// Entries that were not decoded have no timestamp.
+			if !entry.Timestamp.IsZero() && entry.Timestamp.Before(backCutoff) {
+				backIndex = 0
+				break
+			}
+			proc.process(entry, start+int64(i))
+			backIndex = start + int64(i)
+		}
+		if sh.idle != nil && len(entries) > 0 {
+			sh.idle.touch(time.Now())
+		}
+		proc.flush()
+		if backIndex == 0 {
+			log.Printf("Finished walking back through %s to %s", logInfo.Description, backCutoff.Format(time.RFC3339))
+		}
+	}
+
 	for {
 		select {
-		case <-ticker.C:
+		case <-nextPoll():
+			behind = false
+			warnings.flush(time.Now())
+			if sh.pause.isPaused(logInfo.URL) || !breaker.allow(time.Now()) {
+				continue
+			}
+			// Close to -max-memory, backfills wait and live tailing
+			// fetches one batch at a time.
+			concurrency := cfg.FetchConcurrency
+			if sh.memory.underPressure() {
+				metrics.count(metricMemoryThrottled, 1, logInfo.Description)
+				if backfilling {
+					continue
+				}
+				concurrency = 1
+			}
+
+			// Each tick is its own trace, with child spans per operation.
+			ctx, span := tracer.Start(monitorCtx, "tick",
+				trace.WithAttributes(attribute.String("log.description", logInfo.Description), attribute.String("log.url", logInfo.URL)))
+
 			// Fetch the current STH to get the most up-to-date tree size.
-			currentSTH, err := logClient.GetSTH(context.Background())
+			sthCtx, sthSpan := tracer.Start(ctx, "GetSTH")
+			currentSTH, err := logClient.GetSTH(sthCtx)
+			endSpan(sthSpan, err)
 			if err != nil {
-				log.Printf("Failed to get current STH for %s: %v", logInfo.Description, err)
+				metrics.count(metricSTHErrors, 1, logInfo.Description)
+				warnings.warn("Failed to get current STH for "+logInfo.Description, err, time.Now())
+				endSpan(span, err)
+				if !pollFailed(err) {
+					log.Printf("Stopping monitor for %s", logInfo.Description)
+					return
+				}
 				continue
 			}
+			span.SetAttributes(attribute.Int64("log.tree_size", int64(currentSTH.TreeSize)))
+			sh.status.update(logInfo, func(st *logStatus) { st.TreeSize = currentSTH.TreeSize })
+
+			if cfg.VerifyConsistency && !logInfo.tiled() {
+				proofCtx, proofSpan := tracer.Start(ctx, "GetSTHConsistency")
+				err := verifyConsistency(proofCtx, logClient, verifiedSTH, currentSTH)
+				endSpan(proofSpan, err)
+				var inconsistent errInconsistent
+				switch {
+				case errors.As(err, &inconsistent):
+					log.Printf("ALERT: %s is misbehaving, possibly presenting a split view: %v", logInfo.Description, err)
+				case err != nil:
+					// Try again against the same verified tree head next tick.
+					warnings.warn("Failed to verify consistency of "+logInfo.Description, err, time.Now())
+				default:
+					verifiedSTH = currentSTH
+					if sh.state != nil {
+						sh.state.setSTH(logInfo.URL, verifiedSTH)
+					}
+				}
+			}
+
+			// Walking back is a backfill too.
+			if backIndex > 0 && !sh.memory.underPressure() {
+				walkBack(ctx)
+			}
 
 			if currentSTH.TreeSize <= uint64(nextIndex) { // Cast nextIndex to uint64
 				// No new entries yet, continue waiting.
+				pollSucceeded()
+				span.End()
 				continue
 			}
 
-			// Fetch entries from nextIndex up to the current tree size.
-			entries, err := logClient.GetEntries(context.Background(), nextIndex, int64(currentSTH.TreeSize))
-			if err != nil {
-				log.Printf("Failed to get entries for %s: %v", logInfo.Description, err)
-				continue
+			// Fetch entries from nextIndex up to the current tree size,
+			// concurrently in shards when the log is far ahead of us. The
+			// last entry is at TreeSize-1: fetchEntries takes an exclusive
+			// end and converts it to get-entries' inclusive one.
+			entriesCtx, entriesSpan := tracer.Start(ctx, "GetEntries",
+				trace.WithAttributes(attribute.Int64("entries.start", nextIndex), attribute.Int64("entries.end", int64(currentSTH.TreeSize))))
+			polledFrom := nextIndex
+			entries, fetchErr := fetchEntries(entriesCtx, logClient, nextIndex, int64(currentSTH.TreeSize), concurrency, cfg.BatchSize, cfg.MaxEntrySize, cfg.sampleEntry, archive)
+			endSpan(entriesSpan, fetchErr)
+			if fetchErr != nil && notYetServed(fetchErr, cfg.Entries404) {
+				// The log's tree head is ahead of the entries it serves;
+				// process what it did serve and fetch the rest next poll.
+				fetchErr = nil
 			}
-
-			for _, entry := range entries {
-				nextIndex++
-				if entry.X509Cert != nil { // Outer check for X509Cert
-					// Parse certificate only once if it's an X509Cert entry
-					cert, err := x509.ParseCertificate(entry.X509Cert.Raw)
-					if err != nil {
-						log.Printf("Failed to parse X509 certificate from %s: %v", logInfo.Description, err)
-						continue
+			if fetchErr != nil {
+				warnings.warn("Failed to get entries for "+logInfo.Description, fetchErr, time.Now())
+				if len(entries) == 0 {
+					endSpan(span, fetchErr)
+					if !pollFailed(fetchErr) {
+						log.Printf("Stopping monitor for %s", logInfo.Description)
+						return
 					}
+					continue
+				}
+				// The entries fetched before the failure are processed
+				// below; the rest are fetched again on the next tick.
+			} else {
+				pollSucceeded()
+			}
 
-					// The timestamp is actually in the MerkleTreeLeaf, which is part of the LogEntry.
-					// For X509Cert entries, the timestamp is typically the notBefore date of the certificate
-					// or the timestamp from the SignedCertificateTransparency.
-					// However, the original request was to get the timestamp from the log entry itself.
-					// Assuming entry.Leaf.TimestampedEntry is still the source for the CT log timestamp.
-					if entry.Leaf.TimestampedEntry != nil { // Inner check for timestamp
-						timestamp := time.Unix(0, int64(entry.Leaf.TimestampedEntry.Timestamp)*int64(time.Millisecond))
-						var names string
-						if len(cert.DNSNames) > 0 {
-							names = strings.Join(cert.DNSNames, ", ")
-						} else {
-							names = cert.Subject.CommonName
-						}
-						fmt.Printf("Timestamp: %s, Issuer: %s, Names: %s\n",
-							timestamp.Format(time.RFC3339),
-							cert.Issuer.String(),
-							names,
-						)
-					} else {
-						log.Printf("Skipping X509Cert entry %d from %s: TimestampedEntry is nil", nextIndex-1, logInfo.Description)
-					}
-				} else if entry.Precert != nil { // Handle pre-certificates
-					// Precertificates are skipped
-				} else { // Handle other unknown entry types
-					log.Printf("Skipping unknown entry type %d from %s", nextIndex-1, logInfo.Description)
+			_, parseSpan := tracer.Start(ctx, "parse", trace.WithAttributes(attribute.Int("entries.count", len(entries))))
+			parseStart := time.Now()
+			// nextIndex only moves past an entry once it has been
+			// processed, and only from the entry itself, so that an error
+			// or an overlapping batch can never skip an entry or emit one
+			// twice. fetchEntries returns the contiguous run starting at
+			// nextIndex; anything else is refetched next tick.
+			for i := range entries {
+				if entries[i].Index != nextIndex {
+					log.Printf("Got entry %d of %s while expecting %d, refetching from %d", entries[i].Index, logInfo.Description, nextIndex, nextIndex)
+					break
+				}
+				proc.process(&entries[i], entries[i].Index)
+				nextIndex = entries[i].Index + 1
+			}
+			if sh.idle != nil && len(entries) > 0 {
+				sh.idle.touch(time.Now())
+			}
+			proc.flush()
+			metrics.timing(metricParseTime, time.Since(parseStart), logInfo.Description)
+			parseSpan.End()
+			p50, p99 := proc.latency.percentile(50), proc.latency.percentile(99)
+			sh.status.update(logInfo, func(st *logStatus) {
+				st.NextIndex = nextIndex
+				st.LatencyP50, st.LatencyP99 = p50.Milliseconds(), p99.Milliseconds()
+			})
+			if cfg.LatencyAlert > 0 {
+				switch {
+				case p99 > cfg.LatencyAlert && !proc.latency.alerting:
+					proc.latency.alerting = true
+					log.Printf("ALERT: detection latency of %s is %s at the 99th percentile, above %s", logInfo.Description, p99.Round(time.Second), cfg.LatencyAlert)
+				case p99 <= cfg.LatencyAlert && proc.latency.alerting:
+					proc.latency.alerting = false
+					log.Printf("Detection latency of %s is back to %s at the 99th percentile", logInfo.Description, p99.Round(time.Second))
 				}
 			}
+			// The position is saved only after the batch's output has
+			// been written, so a restart re-emits rather than skips.
+			if sh.state != nil {
+				sh.state.set(logInfo.URL, nextIndex)
+				checkLogKey(sh.state, logInfo)
+			}
+			if backfilling && nextIndex >= liveFrom {
+				backfilling = false
+				log.Printf("Caught up with %s at index %d, tailing it live", logInfo.Description, nextIndex)
+			}
+			// Without progress, as when the log returned the wrong entries,
+			// the next attempt waits for the next poll as usual.
+			behind = fetchErr == nil && nextIndex > polledFrom && nextIndex < int64(currentSTH.TreeSize)
+			if fetchErr != nil {
+				endSpan(span, fetchErr)
+				if !pollFailed(fetchErr) {
+					log.Printf("Stopping monitor for %s", logInfo.Description)
+					return
+				}
+				continue
+			}
+			span.End()
 		case <-done:
 			log.Printf("Stopping monitor for %s", logInfo.Description)
 			return
@@ -172,9 +1199,65 @@ func monitorLog(logInfo LogInfo, wg *sync.WaitGroup, done <-chan struct{}) {
 	}
 }
 
+// endSpan records err on span, if any, and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// stdinLogList reads the log list from standard input the first time it is
+// called, and returns the same list every time after: stdin can only be
+// read once, but the log list is fetched again on SIGHUP, every
+// -log-list-refresh and while retrying at startup.
+var stdinLogList = sync.OnceValues(func() ([]byte, error) {
+	return ioutil.ReadAll(os.Stdin)
+})
 
-// getLogList fetches and parses the log list from the given URL.
+// getLogList fetches and parses the log list from the given URL, or reads
+// it from standard input if url is "-".
 func getLogList(url string) (*LogList, error) { // Use local LogList struct
+	var body []byte
+	var err error
+	if url == "-" {
+		body, err = stdinLogList()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read log list from stdin: %w", err)
+		}
+	} else {
+		body, err = fetchLogList(url)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Go's transport already undoes Content-Encoding: gzip, but a log list
+	// may also be published as a gzip file in its own right (log_list.json.gz
+	// served as application/gzip). Recognize those by their magic number.
+	if isGzip(body) {
+		body, err = gunzip(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress log list: %w", err)
+		}
+	}
+
+	var logList LogList // Use local LogList struct
+	if err := json.Unmarshal(body, &logList); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal log list: %w", err)
+	}
+	addTiledLogs(&logList)
+
+	if err := validateLogList(&logList); err != nil {
+		return nil, err
+	}
+
+	return &logList, nil
+}
+
+// fetchLogList downloads the raw log list from url.
+func fetchLogList(url string) ([]byte, error) {
 	resp, err := http.Get(url)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch log list: %w", err)
@@ -189,11 +1272,46 @@ func getLogList(url string) (*LogList, error) { // Use local LogList struct
 	if err != nil {
 		return nil, fmt.Errorf("failed to read log list body: %w", err)
 	}
+	return body, nil
+}
 
-	var logList LogList // Use local LogList struct
-	if err := json.Unmarshal(body, &logList); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal log list: %w", err)
+// isGzip reports whether data starts with the gzip magic number.
+func isGzip(data []byte) bool {
+	return len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b
+}
+
+// gunzip decompresses gzip-compressed data.
+func gunzip(data []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
 	}
+	defer zr.Close()
+	return ioutil.ReadAll(zr)
+}
 
-	return &logList, nil
+// validateLogList checks that a parsed log list actually contains what we
+// expect. The JSON decoder silently ignores unknown fields, so a
+// restructured log_list.json (as happened going from v2 to v3) decodes
+// without error into an empty list; catch that here with a useful message.
+func validateLogList(logList *LogList) error {
+	if len(logList.Operators) == 0 {
+		return fmt.Errorf("log list contains no operators; the log list schema may have changed")
+	}
+	var logs, withURL int
+	for _, operator := range logList.Operators {
+		logs += len(operator.Logs)
+		for _, logInfo := range operator.Logs {
+			if logInfo.URL != "" {
+				withURL++
+			}
+		}
+	}
+	if logs == 0 {
+		return fmt.Errorf("log list has %d operators but no logs; the log list schema may have changed", len(logList.Operators))
+	}
+	if withURL == 0 {
+		return fmt.Errorf("none of the %d logs in the log list has a URL; the log list schema may have changed", logs)
+	}
+	return nil
 }
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	ct "github.com/google/certificate-transparency-go"
+)
+
+// mockLog serves the RFC 6962 get-sth and get-entries endpoints over HTTP
+// from leaves, of which the first size are in the tree.
+type mockLog struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	leaves   []ct.LeafEntry
+	size     int
+	max      int      // entries per get-entries response; all asked for when zero
+	requests []string // the paths and queries asked for, in order
+	page     string   // an HTML page answering every request instead, when set
+}
+
+func newMockLog(t testing.TB, leaves []ct.LeafEntry, size int) *mockLog {
+	m := &mockLog{leaves: leaves, size: size}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /ct/v1/get-sth", m.getSTH)
+	mux.HandleFunc("GET /ct/v1/get-entries", m.getEntries)
+	m.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.mu.Lock()
+		m.requests = append(m.requests, r.URL.RequestURI())
+		page := m.page
+		m.mu.Unlock()
+		if page != "" {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			fmt.Fprint(w, page)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(m.Close)
+	return m
+}
+
+// logInfo returns the log's entry in a log list.
+func (m *mockLog) logInfo() LogInfo {
+	return LogInfo{URL: m.URL + "/", Description: "Mock log"}
+}
+
+// setSize grows, or shrinks, the tree to the first size leaves.
+func (m *mockLog) setSize(size int) {
+	m.mu.Lock()
+	m.size = size
+	m.mu.Unlock()
+}
+
+// serveHTML has the log answer every request with page, as a log behind a
+// login page or a misconfigured proxy does.
+func (m *mockLog) serveHTML(page string) {
+	m.mu.Lock()
+	m.page = page
+	m.mu.Unlock()
+}
+
+// requested returns the requests made so far.
+func (m *mockLog) requested() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.requests...)
+}
+
+// testSignature is an ECDSA signature over nothing in particular: tree
+// heads are only verified against a log's key, which mock logs do not have.
+var testSignature = []byte{4, 3, 0, 8, 0x30, 6, 2, 1, 1, 2, 1, 1}
+
+func (m *mockLog) getSTH(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	size := m.size
+	m.mu.Unlock()
+	root := make([]byte, 32)
+	root[0] = byte(size)
+	writeJSON(w, map[string]any{
+		"tree_size":           size,
+		"timestamp":           time.Now().UnixMilli(),
+		"sha256_root_hash":    root,
+		"tree_head_signature": testSignature,
+	})
+}
+
+func (m *mockLog) getEntries(w http.ResponseWriter, r *http.Request) {
+	start, err1 := strconv.ParseInt(r.URL.Query().Get("start"), 10, 64)
+	end, err2 := strconv.ParseInt(r.URL.Query().Get("end"), 10, 64)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err1 != nil || err2 != nil || start < 0 || end < start || start >= int64(m.size) {
+		http.Error(w, fmt.Sprintf("bad range %d-%d for tree size %d", start, end, m.size), http.StatusBadRequest)
+		return
+	}
+	end = min(end, int64(m.size)-1)
+	if m.max > 0 {
+		end = min(end, start+int64(m.max)-1)
+	}
+	writeJSON(w, ct.GetEntriesResponse{Entries: m.leaves[start : end+1]})
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// newTestShared returns what monitors share, for cfg, with a state file in a
+// temporary directory.
+func newTestShared(t testing.TB, cfg *config) *shared {
+	t.Helper()
+	state, err := loadState(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &shared{cfg: cfg, events: newBroadcaster(), pause: newPauseState(), status: newStatusBoard(nil),
+		filters: buildFilters(cfg), state: state}
+}
+
+// startMonitor runs monitorLog for logInfo, with the output going to out
+// rather than stdout, until the returned function is called or the test
+// ends.
+func startMonitor(t testing.TB, sh *shared, logInfo LogInfo, out *bytes.Buffer) (stop func()) {
+	t.Helper()
+	saved := stdout
+	stdout = &outputWriter{w: bufio.NewWriter(out)}
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go monitorLog(sh, &Operator{Name: "Test"}, logInfo, false, &wg, done)
+	var once sync.Once
+	stop = func() {
+		once.Do(func() {
+			close(done)
+			wg.Wait()
+			stdout = saved
+		})
+	}
+	// A test failing before it stops the monitor still stops it.
+	t.Cleanup(stop)
+	return stop
+}
+
+// receive returns the next n events of sub, failing the test if they take
+// longer than a few seconds.
+func receive(t testing.TB, sub *subscription, n int) []*certEvent {
+	t.Helper()
+	var events []*certEvent
+	timeout := time.After(5 * time.Second)
+	for len(events) < n {
+		select {
+		case ev := <-sub.C:
+			events = append(events, ev)
+		case <-timeout:
+			t.Fatalf("got %d events, want %d", len(events), n)
+		}
+	}
+	return events
+}
+
+// mockLeaves returns the leaves of n certificates, for name0.example.com
+// and so on.
+func mockLeaves(t testing.TB, n int) []ct.LeafEntry {
+	leaves := make([]ct.LeafEntry, n)
+	for i := range leaves {
+		leaves[i] = testLeaf(t, testCertDER(t, fmt.Sprintf("name%d.example.com", i)), time.Now())
+	}
+	return leaves
+}
+
+func TestMonitorAgainstMockLog(t *testing.T) {
+	mock := newMockLog(t, mockLeaves(t, 8), 2)
+	mock.max = 2 // as logs cap get-entries responses
+	cfg, _, err := parseTestFlags(t, "-poll=continuous", "-poll-delay=10ms", "-batch-size=4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sh := newTestShared(t, cfg)
+	sub := sh.events.subscribe(16, overflowBlock)
+	var out bytes.Buffer
+	stop := startMonitor(t, sh, mock.logInfo(), &out)
+
+	// The monitor starts at the end of the tree, so the first two
+	// certificates are not emitted; the next ones are, in order, as the
+	// tree grows.
+	time.Sleep(50 * time.Millisecond)
+	mock.setSize(5)
+	events := receive(t, sub, 3)
+	mock.setSize(8)
+	events = append(events, receive(t, sub, 3)...)
+	stop()
+
+	for i, ev := range events {
+		index := int64(i + 2)
+		if ev.Index != index || ev.Cert.Subject.CommonName != fmt.Sprintf("name%d.example.com", index) {
+			t.Errorf("event %d is entry %d for %s, want entry %d", i, ev.Index, ev.Cert.Subject.CommonName, index)
+		}
+	}
+	if st, ok := sh.state.get(mock.logInfo().URL); !ok || st.NextIndex != 8 {
+		t.Errorf("saved position = %+v, %v; want next index 8", st, ok)
+	}
+	if n := bytes.Count(out.Bytes(), []byte("\n")); n != 6 {
+		t.Errorf("printed %d lines, want 6:\n%s", n, out.String())
+	}
+	for _, req := range mock.requested() {
+		u, err := url.Parse(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if start, _ := strconv.Atoi(u.Query().Get("start")); u.Path == "/ct/v1/get-entries" && start < 2 {
+			t.Errorf("fetched entries from before the monitor started: %s", req)
+		}
+	}
+}
+
+func TestInitialSTHErrorCounted(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "not today", http.StatusNotFound)
+	}))
+	defer srv.Close()
+	cfg, _, err := parseTestFlags(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prom := newPromRecorder(noopMetrics{})
+	defer func(m metricsRecorder) { metrics = m }(metrics)
+	metrics = prom
+
+	logInfo := LogInfo{URL: srv.URL + "/", Description: "Test log"}
+	sh := &shared{cfg: cfg, status: newStatusBoard(nil)}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	monitorLog(sh, &Operator{Name: "Test"}, logInfo, false, &wg, make(chan struct{}))
+
+	if got := prom.counters[statsdKey{metricSTHErrors, logInfo.Description}]; got != 1 {
+		t.Errorf("%s = %d after the initial get-sth failed, want 1", metricSTHErrors, got)
+	}
+}
+
+// BenchmarkPollLatency measures how long an entry takes from being added
+// to a log to being emitted, polling with a ticker every 100ms and
+// continuously with a -poll-delay of 10ms: ns/op is the latency.
+func BenchmarkPollLatency(b *testing.B) {
+	saved := pollInterval
+	pollInterval = 100 * time.Millisecond
+	b.Cleanup(func() { pollInterval = saved })
+	leaf := mockLeaves(b, 1)[0]
+	leaves := make([]ct.LeafEntry, 4096)
+	for i := range leaves {
+		leaves[i] = leaf
+	}
+	for _, args := range [][]string{
+		{"-poll=ticker"},
+		{"-poll=continuous", "-poll-delay=10ms"},
+	} {
+		b.Run(args[0], func(b *testing.B) {
+			mock := newMockLog(b, leaves, 1)
+			cfg, _, err := parseTestFlags(b, args...)
+			if err != nil {
+				b.Fatal(err)
+			}
+			sh := newTestShared(b, cfg)
+			sub := sh.events.subscribe(16, overflowBlock)
+			var out bytes.Buffer
+			stop := startMonitor(b, sh, mock.logInfo(), &out)
+			defer stop()
+			// Let the monitor start at the initial size.
+			time.Sleep(2 * pollInterval)
+			for size := 2; b.Loop(); size++ {
+				if size > len(leaves) {
+					b.Fatalf("ran out of the mock log's %d entries", len(leaves))
+				}
+				mock.setSize(size)
+				receive(b, sub, 1)
+			}
+		})
+	}
+}
+
+func TestOperatorEmail(t *testing.T) {
+	tests := []struct {
+		json    string
+		want    []string
+		wantErr bool
+	}{
+		{json: `"ct@example.com"`, want: []string{"ct@example.com"}},
+		{json: `["ct@example.com", "abuse@example.com"]`, want: []string{"ct@example.com", "abuse@example.com"}},
+		{json: `""`},
+		{json: `[]`, want: []string{}},
+		{json: `null`},
+		{json: `42`, wantErr: true},
+	}
+	for _, tt := range tests {
+		var operator Operator
+		err := json.Unmarshal([]byte(`{"name": "Example", "email": `+tt.json+`, "logs": []}`), &operator)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("email %s: error = %v, want an error: %v", tt.json, err, tt.wantErr)
+			continue
+		}
+		if !slices.Equal(operator.Email, tt.want) {
+			t.Errorf("email %s: got %q, want %q", tt.json, operator.Email, tt.want)
+		}
+	}
+}
+
+func TestHTMLResponseOpensBreaker(t *testing.T) {
+	mock := newMockLog(t, mockLeaves(t, 1), 1)
+	cfg, _, err := parseTestFlags(t, "-poll=continuous", "-poll-delay=10ms", "-breaker-cooldown=1h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sh := newTestShared(t, cfg)
+	var out bytes.Buffer
+	startMonitor(t, sh, mock.logInfo(), &out)
+	waitFor(t, "the first poll", func() bool { return len(mock.requested()) >= 2 })
+	if got := breakerOf(sh); got != "closed" {
+		t.Fatalf("breaker is %s before the log served HTML", got)
+	}
+
+	// One HTML page is enough: retrying will not get past a login page.
+	mock.serveHTML("<html><body>Please log in</body></html>")
+	waitFor(t, "the breaker to open", func() bool { return breakerOf(sh) == "open" })
+	requests := len(mock.requested())
+	time.Sleep(50 * time.Millisecond)
+	if n := len(mock.requested()); n != requests {
+		t.Errorf("%d requests made while the breaker was open", n-requests)
+	}
+}
+
+func TestBackfillHandoff(t *testing.T) {
+	// Entries 0-5 are in the tree when the monitor starts, logged an hour
+	// apart up to an hour ago; 6-9 are logged while it runs.
+	now := time.Now()
+	leaves := make([]ct.LeafEntry, 10)
+	for i := range leaves {
+		ts := now.Add(-time.Duration(max(6-i, 0)) * time.Hour)
+		leaves[i] = testLeaf(t, testCertDER(t, fmt.Sprintf("name%d.example.com", i)), ts)
+	}
+	for _, backfill := range []string{"-lag=3", "-since=3h30m"} {
+		t.Run(backfill, func(t *testing.T) {
+			mock := newMockLog(t, leaves, 6)
+			cfg, _, err := parseTestFlags(t, backfill, "-poll=continuous", "-poll-delay=10ms", "-batch-size=2", "-fetch-concurrency=1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			sh := newTestShared(t, cfg)
+			sub := sh.events.subscribe(16, overflowBlock)
+			var out bytes.Buffer
+			stop := startMonitor(t, sh, mock.logInfo(), &out)
+			// The log grows while the backfill is still running, a batch
+			// of two at a time.
+			events := receive(t, sub, 1)
+			mock.setSize(10)
+			events = append(events, receive(t, sub, 6)...)
+			stop()
+
+			// Entries 3-5 are backfilled, then 6-9 tailed live, each once.
+			for i, ev := range events {
+				if index := int64(i + 3); ev.Index != index {
+					t.Errorf("event %d is entry %d, want %d", i, ev.Index, index)
+				}
+			}
+			select {
+			case ev := <-sub.C:
+				t.Errorf("unexpected event for entry %d", ev.Index)
+			default:
+			}
+			if st, ok := sh.state.get(mock.logInfo().URL); !ok || st.NextIndex != 10 {
+				t.Errorf("saved position = %+v, %v; want next index 10", st, ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+// Package match matches DNS names against watch lists: domains, which
+// match themselves and every name below them, wildcard domains
+// (*.example.com), which match only the names below, and regular
+// expressions written between slashes (/^mail\d+\./). It is the matcher
+// behind certtail's -match-file and -watch.
+//
+// Domains are lowercased and looked up by walking up a name's labels, so
+// matching costs the same for thousands of domains as for one. Names are
+// matched as given: normalizing them, such as decoding punycode, is up to
+// the caller.
+package match
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// A Matcher holds watch list entries. The zero value matches nothing and
+// is ready to use. A Matcher must not be modified while it is in use.
+type Matcher struct {
+	domains   map[string]bool
+	wildcards map[string]bool // keyed by the domain below the *.
+	patterns  []pattern
+}
+
+// pattern is a regular expression entry, with its line as written.
+type pattern struct {
+	re   *regexp.Regexp
+	line string
+}
+
+// Load reads a watch list file; see Parse.
+func Load(path string) (*Matcher, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(f, path)
+}
+
+// Parse reads a watch list, one entry per line (see Add). Blank lines and
+// lines starting with # are ignored. Errors are prefixed with source and
+// the line number. A list without entries is an error.
+func Parse(r io.Reader, source string) (*Matcher, error) {
+	m := &Matcher{}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := m.Add(line); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", source, n, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if m.Empty() {
+		return nil, fmt.Errorf("%s lists no domains", source)
+	}
+	return m, nil
+}
+
+// Add adds an entry: a domain such as example.com, a wildcard domain such
+// as *.example.com, or a regular expression between slashes.
+func (m *Matcher) Add(entry string) error {
+	switch {
+	case len(entry) > 2 && strings.HasPrefix(entry, "/") && strings.HasSuffix(entry, "/"):
+		re, err := CompileRegexp(entry[1 : len(entry)-1])
+		if err != nil {
+			return err
+		}
+		m.patterns = append(m.patterns, pattern{re: re, line: entry})
+	case strings.HasPrefix(entry, "*."):
+		if m.wildcards == nil {
+			m.wildcards = make(map[string]bool)
+		}
+		m.wildcards[canonical(entry[2:])] = true
+	default:
+		m.AddDomain(strings.TrimPrefix(entry, "."))
+	}
+	return nil
+}
+
+// AddDomain adds a domain, which matches itself and every name below it.
+func (m *Matcher) AddDomain(domain string) {
+	if m.domains == nil {
+		m.domains = make(map[string]bool)
+	}
+	m.domains[canonical(domain)] = true
+}
+
+// Empty reports whether m has no entries.
+func (m *Matcher) Empty() bool {
+	return len(m.domains) == 0 && len(m.wildcards) == 0 && len(m.patterns) == 0
+}
+
+// Matches reports whether name, which may be a wildcard, matches one of
+// the entries.
+func (m *Matcher) Matches(name string) bool {
+	return m.Rule(name) != ""
+}
+
+// Rule returns the entry name matches, as written but for the case of
+// domains, or "" if none does. Regular expressions are tried first, then
+// the closest domain.
+func (m *Matcher) Rule(name string) string {
+	for _, p := range m.patterns {
+		if p.re.MatchString(name) {
+			return p.line
+		}
+	}
+	name = canonical(name)
+	// A wildcard name stands for the names below its domain.
+	below := false
+	if base, ok := strings.CutPrefix(name, "*."); ok {
+		name, below = base, true
+	}
+	for {
+		if m.domains[name] {
+			return name
+		}
+		if below && m.wildcards[name] {
+			return "*." + name
+		}
+		_, parent, found := strings.Cut(name, ".")
+		if !found {
+			return ""
+		}
+		name, below = parent, true
+	}
+}
+
+// CompileRegexp compiles a regular expression for names. A shell glob such
+// as *.example.com is a common mistake and fails with a confusing "missing
+// argument to repetition operator", so it gets a hint instead.
+func CompileRegexp(pattern string) (*regexp.Regexp, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil && strings.HasPrefix(pattern, "*") {
+		return nil, fmt.Errorf("%w (this is a regular expression, not a glob: for example.com and its subdomains use '(^|\\.)example\\.com$')", err)
+	}
+	return re, err
+}
+
+// canonical returns name lowercased and without a trailing dot.
+func canonical(name string) string {
+	return strings.TrimSuffix(strings.ToLower(name), ".")
+}
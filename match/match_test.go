@@ -0,0 +1,87 @@
+package match
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRule(t *testing.T) {
+	m, err := Parse(strings.NewReader(`
+# assets
+example.com
+.Corp.Example.NET.
+*.wild.org
+/^mail\d+\./
+`), "list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		want string
+	}{
+		// Exact domains match themselves and every name below them.
+		{"example.com", "example.com"},
+		{"EXAMPLE.COM.", "example.com"},
+		{"www.example.com", "example.com"},
+		{"a.b.example.com", "example.com"},
+		{"*.example.com", "example.com"},
+		{"notexample.com", ""},
+		{"example.com.evil.net", ""},
+		{"corp.example.net", "corp.example.net"},
+		{"vpn.corp.example.net", "corp.example.net"},
+		{"example.net", ""},
+		// Wildcard domains match only the names below them.
+		{"wild.org", ""},
+		{"www.wild.org", "*.wild.org"},
+		{"a.b.wild.org", "*.wild.org"},
+		{"*.wild.org", "*.wild.org"},
+		// Regular expressions come first and are matched as written.
+		{"mail1.example.com", `/^mail\d+\./`},
+		{"mail2.other.org", `/^mail\d+\./`},
+		{"MAIL3.other.org", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := m.Rule(tt.name); got != tt.want {
+			t.Errorf("Rule(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+		if got := m.Matches(tt.name); got != (tt.want != "") {
+			t.Errorf("Matches(%q) = %v, want %v", tt.name, got, tt.want != "")
+		}
+	}
+}
+
+func TestRuleClosestDomain(t *testing.T) {
+	var m Matcher
+	m.AddDomain("example.com")
+	m.AddDomain("shop.example.com")
+	if got := m.Rule("www.shop.example.com"); got != "shop.example.com" {
+		t.Errorf("Rule = %q, want the closest domain, shop.example.com", got)
+	}
+}
+
+func TestZeroMatcher(t *testing.T) {
+	var m Matcher
+	if !m.Empty() || m.Matches("example.com") {
+		t.Error("the zero Matcher is not empty")
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		list string
+		want string
+	}{
+		{"", "list lists no domains"},
+		{"# only a comment\n\n", "list lists no domains"},
+		{"example.com\n/(/\n", "list:2: "},
+		{"/*.example.com/", "not a glob"},
+	}
+	for _, tt := range tests {
+		_, err := Parse(strings.NewReader(tt.list), "list")
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Parse(%q) error = %v, want one containing %q", tt.list, err, tt.want)
+		}
+	}
+}
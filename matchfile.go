@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"github.com/artooro/certtail/match"
+	"github.com/google/certificate-transparency-go/x509"
+)
+
+// matchFile is the -match-file, which is read again on SIGHUP.
+type matchFile struct {
+	path    string
+	matcher atomic.Pointer[match.Matcher]
+}
+
+func openMatchFile(path string) (*matchFile, error) {
+	f := &matchFile{path: path}
+	if err := f.reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// reload reads the file again. On error the current entries stay in force.
+func (f *matchFile) reload() error {
+	m, err := match.Load(f.path)
+	if err != nil {
+		return err
+	}
+	f.matcher.Store(m)
+	return nil
+}
+
+// matches is match.Matcher.Matches for the current entries.
+func (f *matchFile) matches(name string) bool {
+	return f.matcher.Load().Matches(name)
+}
+
+// rule is match.Matcher.Rule for the current entries.
+func (f *matchFile) rule(name string) string {
+	return f.matcher.Load().Rule(name)
+}
+
+// watchList is the repeatable -watch flag: domains that, like those of a
+// -match-file, match themselves and every name below them.
+type watchList struct {
+	domains []string
+	matcher match.Matcher
+}
+
+func (l *watchList) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(l.domains, ", ")
+}
+
+func (l *watchList) Set(v string) error {
+	domain := canonicalHost(strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(v), "*"), "."))
+	if domain == "" {
+		return fmt.Errorf("domain must not be empty")
+	}
+	l.domains = append(l.domains, domain)
+	l.matcher.AddDomain(domain)
+	return nil
+}
+
+// set reports whether any domain is watched.
+func (l *watchList) set() bool {
+	return len(l.domains) > 0
+}
+
+// matches reports whether name, which may be a wildcard, is at or below a
+// watched domain.
+func (l *watchList) matches(name string) bool {
+	return l.matcher.Matches(name)
+}
+
+// rule returns the watched domain name is at or below, or "".
+func (l *watchList) rule(name string) string {
+	return l.matcher.Rule(name)
+}
+
+// watches reports whether one of cert's names, or its common name even
+// alongside DNS names, is at or below a watched domain.
+func (l *watchList) watches(cfg *config, cert *x509.Certificate) bool {
+	return anyName(cfg, cert, l.matches) || cert.Subject.CommonName != "" && l.matches(normalizeName(cfg, cert.Subject.CommonName))
+}
+
+// matchedRules returns the distinct -match-file entries and -watch domains
+// that names match, for -match-rules. A -watch domain is also looked up by
+// cert's common name, as watches does, so that a certificate selected by
+// its common name alone reports the domain that selected it.
+func matchedRules(cfg *config, cert *x509.Certificate, names []string) []string {
+	var rules []string
+	add := func(rule string) {
+		if rule != "" && !slices.Contains(rules, rule) {
+			rules = append(rules, rule)
+		}
+	}
+	for _, name := range names {
+		if cfg.MatchFile != nil {
+			add(cfg.MatchFile.rule(name))
+		}
+		if cfg.Watch.set() {
+			add(cfg.Watch.rule(name))
+		}
+	}
+	if cfg.Watch.set() && cert.Subject.CommonName != "" {
+		add(cfg.Watch.rule(normalizeName(cfg, cert.Subject.CommonName)))
+	}
+	return rules
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/google/certificate-transparency-go/x509"
+	"github.com/google/certificate-transparency-go/x509/pkix"
+)
+
+func TestMatchedRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "watchlist.txt")
+	if err := os.WriteFile(path, []byte("*.shop.example\n/^vpn\\./\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	matchFile, err := openMatchFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		matchFile bool
+		watch     []string
+		cn        string
+		dnsNames  []string
+		wantWatch bool
+		want      []string
+	}{
+		{name: "exact", watch: []string{"example.com"}, dnsNames: []string{"example.com", "other.org"}, wantWatch: true, want: []string{"example.com"}},
+		{name: "below", watch: []string{"Example.COM"}, dnsNames: []string{"www.example.com"}, wantWatch: true, want: []string{"example.com"}},
+		{name: "wildcard name", watch: []string{"example.com"}, dnsNames: []string{"*.example.com"}, wantWatch: true, want: []string{"example.com"}},
+		{name: "several domains", watch: []string{"example.com", "bank.net"}, dnsNames: []string{"a.bank.net", "b.example.com"}, wantWatch: true, want: []string{"bank.net", "example.com"}},
+		{name: "no match", watch: []string{"example.com"}, cn: "other.org", dnsNames: []string{"other.org"}},
+		{name: "common name only", watch: []string{"example.com"}, cn: "legacy.example.com", dnsNames: []string{"other.org"}, wantWatch: true, want: []string{"example.com"}},
+		{name: "common name without DNS names", watch: []string{"example.com"}, cn: "legacy.example.com", wantWatch: true, want: []string{"example.com"}},
+		{name: "match file wildcard", matchFile: true, dnsNames: []string{"www.shop.example", "shop.example"}, want: []string{"*.shop.example"}},
+		{name: "match file regexp", matchFile: true, dnsNames: []string{"vpn.example.com"}, want: []string{`/^vpn\./`}},
+		{name: "match file ignores common name", matchFile: true, cn: "vpn.example.com", dnsNames: []string{"other.org"}},
+		{name: "match file and watch", matchFile: true, watch: []string{"example.com"}, dnsNames: []string{"vpn.example.com"}, wantWatch: true, want: []string{`/^vpn\./`, "example.com"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config{}
+			if tt.matchFile {
+				cfg.MatchFile = matchFile
+			}
+			for _, domain := range tt.watch {
+				if err := cfg.Watch.Set(domain); err != nil {
+					t.Fatal(err)
+				}
+			}
+			cert := &x509.Certificate{Subject: pkix.Name{CommonName: tt.cn}, DNSNames: tt.dnsNames}
+			if cfg.Watch.set() {
+				if got := cfg.Watch.watches(cfg, cert); got != tt.wantWatch {
+					t.Errorf("watches = %v, want %v", got, tt.wantWatch)
+				}
+			}
+			if got := matchedRules(cfg, cert, normalizeNames(cfg, certNames(cert))); !slices.Equal(got, tt.want) {
+				t.Errorf("matchedRules = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"log"
+	"slices"
+)
+
+// stateRank orders log states from most to least worth monitoring, for
+// -max-logs.
+var stateRank = map[string]int{"usable": 0, "qualified": 1, "readonly": 2, "pending": 3}
+
+// capLogs returns at most limit of logs, preferring usable logs to those in
+// other states and, among them, the most recent shards, with logs that are
+// not sharded counting as the most recent. The logs kept stay in list
+// order. A limit of zero keeps them all.
+func capLogs(logs []LogInfo, limit int) (kept, skipped []LogInfo) {
+	if limit <= 0 || len(logs) <= limit {
+		return logs, nil
+	}
+	ranked := slices.Clone(logs)
+	slices.SortStableFunc(ranked, func(a, b LogInfo) int {
+		if ra, rb := rankState(a), rankState(b); ra != rb {
+			return ra - rb
+		}
+		switch {
+		case a.TemporalInterval == nil && b.TemporalInterval == nil:
+			return 0
+		case a.TemporalInterval == nil:
+			return -1
+		case b.TemporalInterval == nil:
+			return 1
+		}
+		return b.TemporalInterval.EndExclusive.Compare(a.TemporalInterval.EndExclusive)
+	})
+	keep := make(map[string]bool, limit)
+	for _, l := range ranked[:limit] {
+		keep[l.URL] = true
+	}
+	for _, l := range logs {
+		if keep[l.URL] {
+			kept = append(kept, l)
+		} else {
+			skipped = append(skipped, l)
+		}
+	}
+	return kept, skipped
+}
+
+func rankState(l LogInfo) int {
+	if rank, ok := stateRank[l.stateName()]; ok {
+		return rank
+	}
+	return len(stateRank)
+}
+
+// applyMaxLogs caps logs at -max-logs, logging the ones left out.
+func applyMaxLogs(cfg *config, logs []LogInfo) []LogInfo {
+	kept, skipped := capLogs(logs, cfg.MaxLogs)
+	for _, l := range skipped {
+		log.Printf("Skipping %s (%s): -max-logs %d reached", l.Description, l.stateName(), cfg.MaxLogs)
+	}
+	return kept
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"log"
+	"runtime"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+)
+
+// memoryCheckInterval is how often memory use is compared with
+// -max-memory.
+const memoryCheckInterval = 5 * time.Second
+
+// memoryBudget applies the advisory -max-memory budget. Once the memory
+// certtail holds from the OS reaches 90% of the budget it is under
+// pressure until it falls below 75%: monitors fetch one batch at a time and
+// backfills pause, so that live tailing carries on, and the caches given
+// to it are trimmed on the way in.
+type memoryBudget struct {
+	limit    int64
+	pressure atomic.Bool
+	// trim frees what it can from the in-memory caches.
+	trim func()
+}
+
+// newMemoryBudget returns the budget for limit bytes, which also becomes
+// the Go runtime's soft memory limit, so that the garbage collector works
+// harder before the budget is reached.
+func newMemoryBudget(limit int64, trim func()) *memoryBudget {
+	debug.SetMemoryLimit(limit)
+	return &memoryBudget{limit: limit, trim: trim}
+}
+
+// underPressure reports whether memory use is close to the budget. A nil
+// budget never is.
+func (m *memoryBudget) underPressure() bool {
+	return m != nil && m.pressure.Load()
+}
+
+// watch checks memory use every memoryCheckInterval until done is closed.
+func (m *memoryBudget) watch(done <-chan struct{}) {
+	ticker := time.NewTicker(memoryCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			m.check()
+		case <-done:
+			return
+		}
+	}
+}
+
+func (m *memoryBudget) check() {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	used := int64(ms.Sys - ms.HeapReleased)
+	metrics.gauge(metricMemory, used, "")
+	switch {
+	case !m.pressure.Load() && used >= m.limit/10*9:
+		m.pressure.Store(true)
+		log.Printf("Warning: memory use of %d MiB is close to -max-memory %d MiB: fetching one batch at a time, pausing backfills and trimming caches", used>>20, m.limit>>20)
+		if m.trim != nil {
+			m.trim()
+		}
+		debug.FreeOSMemory()
+	case m.pressure.Load() && used < m.limit/4*3:
+		m.pressure.Store(false)
+		log.Printf("Memory use of %d MiB is back below -max-memory %d MiB, resuming backfills", used>>20, m.limit>>20)
+	}
+	pressure := int64(0)
+	if m.pressure.Load() {
+		pressure = 1
+	}
+	metrics.gauge(metricMemoryPressure, pressure, "")
+}
@@ -0,0 +1,53 @@
+package main
+
+import "time"
+
+// metricsRecorder receives the counters and timings certtail records at its
+// instrumentation points. Names are short and unprefixed (e.g. "entries");
+// each implementation maps them onto its own naming scheme. logName is the
+// description of the log the measurement is for.
+type metricsRecorder interface {
+	count(name string, n int64, logName string)
+	timing(name string, d time.Duration, logName string)
+	gauge(name string, value int64, logName string)
+}
+
+// metrics is used by the monitors to record measurements. It discards them
+// unless a sink such as -statsd is configured.
+var metrics metricsRecorder = noopMetrics{}
+
+type noopMetrics struct{}
+
+func (noopMetrics) count(string, int64, string)          {}
+func (noopMetrics) timing(string, time.Duration, string) {}
+func (noopMetrics) gauge(string, int64, string)          {}
+
+// Metric names.
+const (
+	metricEntries        = "entries"          // log entries processed
+	metricCertificates   = "certificates"     // certificates emitted
+	metricParseErrors    = "parse_errors"     // entries that failed to parse
+	metricErrors         = "errors"           // failed polls (get-sth or get-entries)
+	metricSTHErrors      = "sth_errors"       // per log: failed get-sth requests
+	metricParseTime      = "parse_time"       // time to process a batch of entries
+	metricValidity       = "validity"         // certificates emitted, by lifetime bucket (validity.<bucket>)
+	metricLatency        = "latency"          // time from an entry's log timestamp to its certificate being emitted
+	metricMonitors       = "monitors"         // monitors running (gauge)
+	metricMonitorsDown   = "monitors_stopped" // monitors that have stopped (gauge)
+	metricRunning        = "running"          // per log: 1 while its monitor runs, 0 once it stopped (gauge)
+	metricLag            = "lag"              // per log: entries between its tree size and the next index to process (gauge)
+	metricLastSuccess    = "last_success"     // per log: Unix time of its last completed poll (gauge)
+	metricGoroutines     = "goroutines"       // goroutines in the process (gauge)
+	metricCompareMissing = "compare_missing"  // per log: certificates missing from it but in the other -compare-logs
+	metricOutputDropped  = "output_dropped"   // certificates not printed on stdout because of -max-output-rate
+
+	metricKeyReuse   = "key_reuse"   // certificates with a public key seen on another certificate, with -key-reuse
+	metricKeysReused = "keys_reused" // tracked public keys seen on more than one certificate (gauge)
+
+	metricMemory          = "memory"           // bytes of memory held from the OS, with -max-memory (gauge)
+	metricMemoryPressure  = "memory_pressure"  // 1 while memory use is close to -max-memory, 0 otherwise (gauge)
+	metricMemoryThrottled = "memory_throttled" // per log: polls paused or shrunk because of -max-memory
+
+	metricPrecertDelay    = "precert_delay"    // per log: time from a precertificate to its final certificate, with -link-precerts
+	metricPrecertUnlinked = "precert_unlinked" // per log: precertificates whose final certificate was not seen within -link-precerts
+)
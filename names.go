@@ -0,0 +1,103 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/google/certificate-transparency-go/x509"
+	"golang.org/x/net/idna"
+)
+
+// certNames returns the names a certificate was issued for: its DNS SANs,
+// or the subject common name when there are none.
+func certNames(cert *x509.Certificate) []string {
+	if len(cert.DNSNames) > 0 {
+		return cert.DNSNames
+	}
+	if cert.Subject.CommonName != "" {
+		return []string{cert.Subject.CommonName}
+	}
+	return nil
+}
+
+// noNamesPlaceholder stands in for the names of a certificate that has none,
+// neither DNS SANs nor a common name.
+const noNamesPlaceholder = "<no names>"
+
+// hasNames reports whether cert identifies anything at all: a DNS SAN, a
+// common name or an IP address SAN. Certificates without are rare and
+// usually malformed.
+func hasNames(cert *x509.Certificate) bool {
+	return len(certNames(cert)) > 0 || len(cert.IPAddresses) > 0
+}
+
+// anyName reports whether one of cert's names, normalized, satisfies match.
+// It stops at the first that does and normalizes no more names than it
+// needs to, as a certificate can have tens of thousands.
+func anyName(cfg *config, cert *x509.Certificate, match func(string) bool) bool {
+	for _, name := range certNames(cert) {
+		if match(normalizeName(cfg, name)) {
+			return true
+		}
+	}
+	return false
+}
+
+// distinctNames returns names without empty and repeated names, in order.
+func distinctNames(names []string) []string {
+	seen := make(map[string]bool, len(names))
+	var out []string
+	for _, name := range names {
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		out = append(out, name)
+	}
+	return out
+}
+
+// limitNames returns the first -max-names of names, and how many it left
+// out.
+func limitNames(cfg *config, names []string) ([]string, int) {
+	if cfg.MaxNames <= 0 || len(names) <= cfg.MaxNames {
+		return names, 0
+	}
+	return names[:cfg.MaxNames], len(names) - cfg.MaxNames
+}
+
+// normalizeNames applies the configured normalization to names. The input
+// slice is never modified; it is returned as-is when nothing changes.
+func normalizeNames(cfg *config, names []string) []string {
+	if !cfg.LowercaseNames && !cfg.DecodeIDN {
+		return names
+	}
+	var out []string
+	for i, name := range names {
+		n := normalizeName(cfg, name)
+		if out == nil && n != name {
+			out = make([]string, len(names))
+			copy(out, names[:i])
+		}
+		if out != nil {
+			out[i] = n
+		}
+	}
+	if out == nil {
+		return names
+	}
+	return out
+}
+
+// normalizeName lowercases and/or decodes the punycode labels of a single
+// name. Names that fail to decode are left in their ASCII form.
+func normalizeName(cfg *config, name string) string {
+	if cfg.LowercaseNames {
+		name = strings.ToLower(name)
+	}
+	if cfg.DecodeIDN && strings.Contains(name, "xn--") {
+		if u, err := idna.ToUnicode(name); err == nil {
+			name = u
+		}
+	}
+	return name
+}
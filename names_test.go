@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/certificate-transparency-go/x509"
+)
+
+func TestNamesCap(t *testing.T) {
+	names := make([]string, 20000)
+	for i := range names {
+		names[i] = fmt.Sprintf("host%d.example.com", i)
+	}
+	cert := &x509.Certificate{DNSNames: names}
+	ev := &certEvent{Cert: cert, Log: &LogInfo{Description: "Test log"}, Operator: &Operator{Name: "Test"}}
+
+	tests := []struct {
+		args        []string
+		wantShown   int
+		wantOmitted int
+	}{
+		{nil, 1000, 19000},
+		{[]string{"-max-names=3"}, 3, 19997},
+		{[]string{"-max-names=0"}, 20000, 0},
+	}
+	for _, tt := range tests {
+		cfg, _, err := parseTestFlags(t, tt.args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		writeEntry(&buf, cfg, ev)
+		out := buf.String()
+		if got := strings.Count(out, ".example.com"); got != tt.wantShown {
+			t.Errorf("%q: output has %d names, want %d", tt.args, got, tt.wantShown)
+		}
+		if more := fmt.Sprintf("(+%d more)", tt.wantOmitted); strings.Contains(out, more) != (tt.wantOmitted > 0) {
+			t.Errorf("%q: output does not say %s", tt.args, more)
+		}
+		doc := newESDocument(cfg, ev)
+		if len(doc.Names) != tt.wantShown || doc.NamesOmitted != tt.wantOmitted {
+			t.Errorf("%q: document has %d names and %d omitted, want %d and %d", tt.args, len(doc.Names), doc.NamesOmitted, tt.wantShown, tt.wantOmitted)
+		}
+	}
+}
+
+func TestFiltersSeeEveryName(t *testing.T) {
+	names := make([]string, 20000)
+	for i := range names {
+		names[i] = fmt.Sprintf("host%d.example.org", i)
+	}
+	names[len(names)-1] = "vpn.example.com"
+	cert := &x509.Certificate{DNSNames: names}
+
+	// -max-names caps what is emitted, not what is matched.
+	cfg, _, err := parseTestFlags(t, "-max-names=10", `-match=^vpn\.example\.com$`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !passes(buildFilters(cfg), cert) {
+		t.Error("a certificate whose last name matches -match was filtered out")
+	}
+
+	// Matching stops at the first name that matches.
+	calls := 0
+	anyName(cfg, cert, func(name string) bool {
+		calls++
+		return strings.HasPrefix(name, "host")
+	})
+	if calls != 1 {
+		t.Errorf("matched %d names, want only the first", calls)
+	}
+}
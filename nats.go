@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// natsMaxPending bounds the JetStream publishes awaiting their ack.
+const natsMaxPending = 256
+
+// natsAckTimeout is how long a JetStream publish waits for its ack before
+// it counts as failed.
+const natsAckTimeout = 30 * time.Second
+
+// runNATSSink publishes every event from sub to cfg.NATSSubject on the
+// NATS servers at cfg.NATSURL, as the same JSON document -elasticsearch
+// indexes. The client reconnects forever, buffering publishes made while
+// disconnected (up to nats.go's default 8 MiB) and dropping them beyond
+// that. With cfg.NATSJetStream events are published to a JetStream stream,
+// which must already capture the subject, and every publish is
+// acknowledged by the server; failed publishes are logged and not retried.
+// The returned channel is closed once the events published before sub
+// closed have been flushed, or acknowledged with JetStream.
+func runNATSSink(cfg *config, sub *subscription) (<-chan struct{}, error) {
+	opts := []nats.Option{
+		nats.Name("certtail"),
+		nats.MaxReconnects(-1),
+		nats.ReconnectWait(2 * time.Second),
+		// The first connection is retried in the background too, so that
+		// certtail can start while NATS is down.
+		nats.RetryOnFailedConnect(true),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err != nil {
+				log.Printf("Disconnected from NATS, reconnecting: %v", err)
+			}
+		}),
+		nats.ReconnectHandler(func(nc *nats.Conn) {
+			log.Printf("Reconnected to NATS at %s", nc.ConnectedUrlRedacted())
+		}),
+	}
+	if cfg.NATSCreds != "" {
+		opts = append(opts, nats.UserCredentials(cfg.NATSCreds))
+	}
+	nc, err := nats.Connect(cfg.NATSURL, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	var js jetstream.JetStream
+	if cfg.NATSJetStream {
+		js, err = jetstream.New(nc,
+			jetstream.WithPublishAsyncMaxPending(natsMaxPending),
+			jetstream.WithPublishAsyncTimeout(natsAckTimeout),
+			jetstream.WithPublishAsyncErrHandler(func(_ jetstream.JetStream, msg *nats.Msg, err error) {
+				log.Printf("JetStream did not accept an event published to %s: %v", msg.Subject, err)
+			}))
+		if err != nil {
+			nc.Close()
+			return nil, err
+		}
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		defer nc.Close()
+		var failed int
+		for ev := range sub.C {
+			data, err := json.Marshal(newESDocument(cfg, ev))
+			if err != nil {
+				log.Printf("Failed to encode event for NATS: %v", err)
+				continue
+			}
+			if js != nil {
+				// Blocks while natsMaxPending publishes await their ack.
+				_, err = js.PublishAsync(cfg.NATSSubject, data)
+			} else {
+				err = nc.Publish(cfg.NATSSubject, data)
+			}
+			if err != nil {
+				// Only log the first few failures, e.g. for a full
+				// reconnect buffer during an outage.
+				if failed++; failed <= 10 {
+					log.Printf("Failed to publish event to NATS: %v", err)
+				}
+			}
+		}
+		if js != nil {
+			<-js.PublishAsyncComplete()
+		} else if err := nc.Flush(); err != nil {
+			log.Printf("Failed to flush events to NATS: %v", err)
+		}
+	}()
+	return stopped, nil
+}
+
+// validateNATSSubject rejects subjects events cannot be published to.
+func validateNATSSubject(subject string) error {
+	if subject == "" {
+		return fmt.Errorf("NATS subject must not be empty")
+	}
+	for _, c := range subject {
+		if c == ' ' || c == '\t' || c == '*' || c == '>' {
+			return fmt.Errorf("NATS subject %q must not contain whitespace or wildcards", subject)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// objectMaxAttempts bounds how often an object upload is attempted before
+// its events are dropped.
+const objectMaxAttempts = 5
+
+// objectRequestTimeout bounds each upload.
+const objectRequestTimeout = 5 * time.Minute
+
+// objectStore uploads objects to an S3-compatible bucket: Amazon S3, or
+// Google Cloud Storage through its XML API with HMAC keys. Requests are
+// signed with AWS Signature Version 4, which both accept, so no SDK is
+// needed.
+type objectStore struct {
+	endpoint string // scheme and host, e.g. https://s3.us-east-1.amazonaws.com
+	bucket   string
+	prefix   string // key prefix without leading or trailing slashes
+	region   string
+
+	accessKey, secretKey, sessionToken string
+
+	client *http.Client
+}
+
+// newObjectStore parses an s3://bucket/prefix or gs://bucket/prefix
+// target. Credentials come from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY
+// and, for temporary credentials, AWS_SESSION_TOKEN; for GCS these are an
+// HMAC key of a service account.
+func newObjectStore(cfg *config) (*objectStore, error) {
+	scheme, rest, ok := strings.Cut(cfg.ObjectStore, "://")
+	if !ok || (scheme != "s3" && scheme != "gs") {
+		return nil, fmt.Errorf("object store must be s3://bucket/prefix or gs://bucket/prefix")
+	}
+	if cfg.ObjectMaxAge <= 0 || cfg.ObjectMaxBytes <= 0 {
+		return nil, fmt.Errorf("-object-max-age and -object-max-bytes must be positive")
+	}
+	bucket, prefix, _ := strings.Cut(rest, "/")
+	if bucket == "" {
+		return nil, fmt.Errorf("object store %q has no bucket", cfg.ObjectStore)
+	}
+	s := &objectStore{
+		bucket:       bucket,
+		prefix:       strings.Trim(prefix, "/"),
+		region:       cfg.ObjectStoreRegion,
+		accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		client:       &http.Client{Timeout: objectRequestTimeout},
+	}
+	if s.accessKey == "" || s.secretKey == "" {
+		return nil, fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set")
+	}
+	if s.region == "" {
+		s.region = os.Getenv("AWS_REGION")
+	}
+	switch {
+	case scheme == "gs":
+		// GCS ignores the region, but it is part of the signature.
+		s.endpoint = "https://storage.googleapis.com"
+		if s.region == "" {
+			s.region = "auto"
+		}
+	case s.region == "":
+		s.region = "us-east-1"
+		fallthrough
+	default:
+		s.endpoint = "https://s3." + s.region + ".amazonaws.com"
+	}
+	if cfg.ObjectStoreEndpoint != "" {
+		s.endpoint = strings.TrimSuffix(cfg.ObjectStoreEndpoint, "/")
+	}
+	return s, nil
+}
+
+// objectBatch collects the events of one log for the next object.
+type objectBatch struct {
+	logInfo *LogInfo
+	opened  time.Time
+	events  int
+	raw     int64 // uncompressed size
+	buf     bytes.Buffer
+	gz      *gzip.Writer
+}
+
+// runObjectStoreSink writes the events from sub as gzipped NDJSON objects
+// (the documents -elasticsearch indexes, one per line), one stream of
+// objects per log, under keys partitioned by date and log:
+// <prefix>/dt=2025-03-01/log=<log>/<time>.ndjson.gz. An object is uploaded
+// once it holds cfg.ObjectMaxBytes of uncompressed data or is
+// cfg.ObjectMaxAge old, and every object is uploaded when the subscription
+// closes; the returned channel is closed after that.
+func runObjectStoreSink(cfg *config, sub *subscription) (<-chan struct{}, error) {
+	s, err := newObjectStore(cfg)
+	if err != nil {
+		return nil, err
+	}
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		batches := make(map[string]*objectBatch) // keyed by log URL
+		upload := func(url string) {
+			b := batches[url]
+			delete(batches, url)
+			if err := b.gz.Close(); err != nil {
+				log.Printf("Failed to compress events for %s: %v", s.bucket, err)
+				return
+			}
+			s.upload(s.key(b), b.buf.Bytes(), b.events)
+		}
+		ticker := time.NewTicker(min(cfg.ObjectMaxAge, 10*time.Second))
+		defer ticker.Stop()
+		for {
+			select {
+			case ev, ok := <-sub.C:
+				if !ok {
+					for url := range batches {
+						upload(url)
+					}
+					return
+				}
+				if ev.Log == nil {
+					continue
+				}
+				doc, err := json.Marshal(newESDocument(cfg, ev))
+				if err != nil {
+					log.Printf("Failed to encode event for %s: %v", cfg.ObjectStore, err)
+					continue
+				}
+				b := batches[ev.Log.URL]
+				if b == nil {
+					b = &objectBatch{logInfo: ev.Log, opened: time.Now().UTC()}
+					b.gz = gzip.NewWriter(&b.buf)
+					batches[ev.Log.URL] = b
+				}
+				b.gz.Write(append(doc, '\n'))
+				b.events++
+				b.raw += int64(len(doc)) + 1
+				if b.raw >= cfg.ObjectMaxBytes {
+					upload(ev.Log.URL)
+				}
+			case now := <-ticker.C:
+				for url, b := range batches {
+					if now.Sub(b.opened) >= cfg.ObjectMaxAge {
+						upload(url)
+					}
+				}
+			}
+		}
+	}()
+	return stopped, nil
+}
+
+// key returns the object key for a batch.
+func (s *objectStore) key(b *objectBatch) string {
+	key := fmt.Sprintf("dt=%s/log=%s/%s.ndjson.gz", b.opened.Format("2006-01-02"), archiveDirName(b.logInfo.URL), b.opened.Format("20060102T150405.000000000Z"))
+	if s.prefix != "" {
+		key = s.prefix + "/" + key
+	}
+	return key
+}
+
+// upload puts an object, retrying with backoff. After objectMaxAttempts
+// failures the object, and the events in it, are dropped.
+func (s *objectStore) upload(key string, body []byte, events int) {
+	backoff := time.Second
+	for attempt := 1; ; attempt++ {
+		err := s.put(key, body)
+		if err == nil {
+			return
+		}
+		if attempt == objectMaxAttempts {
+			log.Printf("Failed to upload %d events to %s/%s, dropping them: %v", events, s.bucket, key, err)
+			return
+		}
+		log.Printf("Failed to upload %d events to %s/%s, retrying in %s: %v", events, s.bucket, key, backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// put sends one signed PUT Object request, addressing the bucket in the
+// path so that bucket names with dots work over HTTPS.
+func (s *objectStore) put(key string, body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), objectRequestTimeout)
+	defer cancel()
+	path := "/" + s.bucket + "/" + key
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	// Send the path exactly as it is signed.
+	req.URL.RawPath = awsURIEncode(path)
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	req.Header.Set("Content-Encoding", "gzip")
+	s.sign(req, body, time.Now().UTC())
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// sign adds an AWS Signature Version 4 Authorization header to req.
+func (s *objectStore) sign(req *http.Request, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256.Sum256(body)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+	if s.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name := range req.Header {
+		if lower := strings.ToLower(name); strings.HasPrefix(lower, "x-amz-") {
+			headers[lower] = strings.TrimSpace(req.Header.Get(name))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", s.accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// awsURIEncode encodes a path as Signature Version 4 expects: every byte
+// but the unreserved characters and the slashes is percent-encoded.
+func awsURIEncode(path string) string {
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		switch {
+		case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '-', c == '.', c == '_', c == '~', c == '/':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// stateName returns the log's state in the log list (usable, qualified,
+// readonly, retired, ...), or "unknown" if the list does not say.
+func (l LogInfo) stateName() string {
+	for name := range l.State {
+		return name
+	}
+	return "unknown"
+}
+
+// frozen reports whether the log list says the log no longer grows: it is
+// read-only, retired or was rejected.
+func (l LogInfo) frozen() bool {
+	switch l.stateName() {
+	case "readonly", "retired", "rejected":
+		return true
+	}
+	return false
+}
+
+// listOperators prints each operator in the log list with the number of
+// logs it runs, broken down by state.
+func listOperators(list *LogList) {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "OPERATOR\tLOGS\tSTATES")
+	for _, operator := range list.Operators {
+		counts := make(map[string]int)
+		for _, l := range operator.Logs {
+			counts[l.stateName()]++
+		}
+		states := make([]string, 0, len(counts))
+		for state, n := range counts {
+			states = append(states, fmt.Sprintf("%d %s", n, state))
+		}
+		sort.Strings(states)
+		fmt.Fprintf(tw, "%s\t%d\t%s\n", operator.Name, len(operator.Logs), strings.Join(states, ", "))
+	}
+	tw.Flush()
+}
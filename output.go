@@ -0,0 +1,446 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/certificate-transparency-go/x509"
+)
+
+// stdout serializes writes from the monitors. Each monitor formats a tick's
+// worth of lines into its own buffer and hands it over in a single Write, so
+// lines from different logs never interleave mid-line. By default every
+// Write goes straight through; with -flush-interval writes are buffered and
+// flushed periodically instead, trading latency for fewer syscalls.
+var stdout = &outputWriter{w: bufio.NewWriterSize(os.Stdout, 256<<10)}
+
+// monitorFlushThreshold is how much output a monitor accumulates before
+// handing it to stdout even though its batch is not finished, so that large
+// batches (backfills) stream out rather than appearing all at once.
+const monitorFlushThreshold = 64 << 10
+
+type outputWriter struct {
+	mu       sync.Mutex
+	w        *bufio.Writer
+	buffered bool
+}
+
+func (o *outputWriter) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	n, err := o.w.Write(p)
+	if err == nil && !o.buffered {
+		err = o.w.Flush()
+	}
+	return n, err
+}
+
+// Flush writes any buffered output.
+func (o *outputWriter) Flush() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.w.Flush()
+}
+
+// flushEvery switches the writer to buffered mode and flushes it every
+// interval until done is closed, so that events reach downstream consumers
+// promptly even when there are too few of them to fill the buffer.
+func (o *outputWriter) flushEvery(interval time.Duration, done <-chan struct{}) {
+	o.mu.Lock()
+	o.buffered = true
+	o.mu.Unlock()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := o.Flush(); err != nil {
+				log.Printf("Failed to flush output: %v", err)
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// certEvent is a certificate observed in a log, together with what is known
+// about where it was seen.
+type certEvent struct {
+	Timestamp       time.Time
+	TimestampSource string
+	Cert            *x509.Certificate
+	Precert         bool // Cert is a precertificate's TBSCertificate
+	// NotYetValid is set when the certificate's notBefore was in the
+	// future when it was observed.
+	NotYetValid bool
+	// Name, when set, restricts the event to one of the certificate's
+	// (normalized) names, for -explode-names.
+	Name     string
+	Log      *LogInfo
+	Operator *Operator
+	// Index is the entry's index in the log.
+	Index int64
+	// Chain is the certificate's issuing chain as the log returned it,
+	// starting with its issuer; only parsed with -chain.
+	Chain []*x509.Certificate
+	// Seq is the event's number among those published by this process,
+	// increasing by one from 1, so that consumers can detect lost events.
+	Seq uint64
+	// logCfg is the configuration of the log's monitor when -log-filters
+	// overrides its filters, so that the sinks select the names the log's
+	// -match matched.
+	logCfg *config
+}
+
+// writeOutput appends an event's output for -format text or json.
+func writeOutput(buf *bytes.Buffer, cfg *config, ev *certEvent) {
+	if cfg.Format != formatJSON {
+		writeEntry(buf, cfg, ev)
+		return
+	}
+	doc, err := json.Marshal(newESDocument(cfg, ev))
+	if err != nil {
+		log.Printf("Failed to encode event: %v", err)
+		return
+	}
+	buf.Write(doc)
+	buf.WriteByte('\n')
+}
+
+// Where a certEvent's Timestamp came from.
+const (
+	timestampFromLog       = "log"       // the log entry's timestamp
+	timestampFromNotBefore = "notBefore" // the certificate's notBefore, for entries without a timestamp
+)
+
+// writeEntry appends the summary line for a certificate observed in a log to
+// buf, followed by the full certificate details when -dump is set. It is on
+// the per-entry hot path, so it appends directly rather than going through
+// fmt and strings.Join.
+func writeEntry(buf *bytes.Buffer, cfg *config, ev *certEvent) {
+	cert := ev.Cert
+	rawNames := certNames(cert)
+	allNames := normalizeNames(cfg, rawNames)
+	names := selectNames(cfg, allNames)
+	if ev.Name != "" {
+		names, allNames, rawNames = []string{ev.Name}, []string{ev.Name}, []string{ev.Name}
+	}
+
+	buf.WriteString("Timestamp: ")
+	startColor(buf, cfg, ansiDim)
+	buf.Write(appendTime(buf.AvailableBuffer(), cfg, ev.Timestamp))
+	endColor(buf, cfg)
+	if cfg.IssuerDN || cfg.Verbose {
+		buf.WriteString(", Issuer: ")
+		startColor(buf, cfg, ansiCyan)
+		buf.WriteString(cert.Issuer.String())
+		endColor(buf, cfg)
+	}
+	if cfg.IssuerOrg {
+		buf.WriteString(", Issuer O: ")
+		startColor(buf, cfg, ansiCyan)
+		writeNames(buf, cert.Issuer.Organization)
+		endColor(buf, cfg)
+	}
+	if cfg.IssuerCN {
+		buf.WriteString(", Issuer CN: ")
+		startColor(buf, cfg, ansiCyan)
+		buf.WriteString(cert.Issuer.CommonName)
+		endColor(buf, cfg)
+	}
+	buf.WriteString(", Names: ")
+	startColor(buf, cfg, ansiGreen)
+	if len(names) > 0 {
+		writeLimitedNames(buf, cfg, names)
+	} else {
+		buf.WriteString(noNamesPlaceholder)
+	}
+	endColor(buf, cfg)
+	if cfg.MatchRules {
+		buf.WriteString(", Rules: ")
+		startColor(buf, cfg, ansiYellow)
+		writeNames(buf, matchedRules(cfg, cert, allNames))
+		endColor(buf, cfg)
+	}
+	if cfg.Allowlist != nil {
+		buf.WriteString(", Unauthorized: ")
+		startColor(buf, cfg, ansiRed)
+		writeLimitedNames(buf, cfg, cfg.Allowlist.unauthorizedNames(cert))
+		endColor(buf, cfg)
+	}
+	if cfg.MinDomains > 0 && ev.Name == "" {
+		buf.WriteString(", Domains: ")
+		buf.Write(strconv.AppendInt(buf.AvailableBuffer(), int64(len(registrableDomains(cert))), 10))
+	}
+	if ev.Precert {
+		buf.WriteString(", Type: precert")
+	}
+	if ev.NotYetValid {
+		buf.WriteString(", Not yet valid: ")
+		startColor(buf, cfg, ansiRed)
+		buf.Write(appendTime(buf.AvailableBuffer(), cfg, cert.NotBefore))
+		endColor(buf, cfg)
+	}
+	if len(cert.IPAddresses) > 0 {
+		buf.WriteString(", IPs: ")
+		for i, ip := range cert.IPAddresses {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			buf.WriteString(ip.String())
+		}
+	}
+	if cfg.Verbose && len(names) != len(allNames) {
+		buf.WriteString(", All names: ")
+		writeLimitedNames(buf, cfg, allNames)
+	}
+	if cfg.Verbose && !slices.Equal(allNames, rawNames) {
+		buf.WriteString(", Raw names: ")
+		writeLimitedNames(buf, cfg, rawNames)
+	}
+	if cfg.Verbose {
+		buf.WriteString(", Timestamp source: ")
+		buf.WriteString(ev.TimestampSource)
+		// The subject's organization and country, which OV and EV
+		// certificates carry, for categorizing issuance.
+		if len(cert.Subject.Organization) > 0 {
+			buf.WriteString(", Subject O: ")
+			writeNames(buf, cert.Subject.Organization)
+		}
+		if len(cert.Subject.OrganizationalUnit) > 0 {
+			buf.WriteString(", Subject OU: ")
+			writeNames(buf, cert.Subject.OrganizationalUnit)
+		}
+		if len(cert.Subject.Country) > 0 {
+			buf.WriteString(", Subject C: ")
+			writeNames(buf, cert.Subject.Country)
+		}
+		if len(cert.PolicyIdentifiers) > 0 {
+			buf.WriteString(", Policies: ")
+			writePolicies(buf, cert)
+		}
+		if ski := subjectKeyID(cert); len(ski) > 0 {
+			buf.WriteString(", SKI: ")
+			buf.WriteString(hex.EncodeToString(ski))
+		}
+		// Where revocation status can be checked, for tools following up
+		// on observed certificates.
+		if len(cert.OCSPServer) > 0 {
+			buf.WriteString(", OCSP: ")
+			writeNames(buf, cert.OCSPServer)
+		}
+		if len(cert.CRLDistributionPoints) > 0 {
+			buf.WriteString(", CRL: ")
+			writeNames(buf, cert.CRLDistributionPoints)
+		}
+		if len(ev.Chain) > 0 {
+			buf.WriteString(", Chain: ")
+			writeChain(buf, ev.Chain)
+		}
+		if ids := embeddedSCTLogIDs(cert); len(ids) > 0 {
+			buf.WriteString(", SCT logs: ")
+			for i, id := range ids {
+				if i > 0 {
+					buf.WriteString(", ")
+				}
+				if name, ok := cfg.logNames.lookup(id); ok {
+					buf.WriteString(name)
+				} else {
+					buf.WriteString(id)
+				}
+			}
+		}
+	}
+	if cfg.LogID && ev.Log != nil {
+		buf.WriteString(", Log: ")
+		buf.WriteString(ev.Log.Description)
+		if ev.Operator != nil {
+			buf.WriteString(", Operator: ")
+			buf.WriteString(ev.Operator.Name)
+		}
+		if id := ev.Log.id(); id != "" {
+			buf.WriteString(", Log ID: ")
+			buf.WriteString(id)
+		}
+	}
+	if cfg.OperatorEmail && ev.Operator != nil && len(ev.Operator.Email) > 0 {
+		buf.WriteString(", Operator contact: ")
+		writeNames(buf, ev.Operator.Email)
+	}
+	if cfg.Label != "" {
+		buf.WriteString(", Label: ")
+		buf.WriteString(cfg.Label)
+	}
+	buf.WriteByte('\n')
+
+	if cfg.Dump {
+		dumpCertificate(buf, cfg, cert)
+		for i, issuer := range ev.Chain {
+			buf.WriteString("  Chain certificate ")
+			buf.Write(strconv.AppendInt(buf.AvailableBuffer(), int64(i+1), 10))
+			buf.WriteString(":\n")
+			dumpCertificate(buf, cfg, issuer)
+		}
+	}
+}
+
+// writeNameLines appends each distinct name of a certificate, its DNS names
+// plus the subject common name, on a line of its own. When seen is non-nil,
+// names it has already seen are skipped, making the output a feed of newly
+// observed hostnames.
+func writeNameLines(buf *bytes.Buffer, cfg *config, ev *certEvent, seen *deduplicator) {
+	names := ev.Cert.DNSNames
+	if cn := ev.Cert.Subject.CommonName; cn != "" && !slices.Contains(names, cn) {
+		names = append(names[:len(names):len(names)], cn)
+	}
+	names, _ = limitNames(cfg, distinctNames(selectNames(cfg, normalizeNames(cfg, names))))
+	for _, name := range names {
+		if seen != nil && seen.seen(ev.Log.Description, []byte(name)) {
+			continue
+		}
+		buf.WriteString(name)
+		buf.WriteByte('\n')
+	}
+}
+
+// eventNames returns the normalized names an event is for.
+func eventNames(cfg *config, ev *certEvent) []string {
+	if ev.Name != "" {
+		return []string{ev.Name}
+	}
+	if ev.logCfg != nil {
+		cfg = ev.logCfg
+	}
+	return selectNames(cfg, normalizeNames(cfg, certNames(ev.Cert)))
+}
+
+// explodeNames returns an event for each distinct normalized name of ev's
+// certificate (each matched name, with -matched-names-only), sharing ev's
+// other fields.
+func explodeNames(cfg *config, ev *certEvent) []*certEvent {
+	names, _ := limitNames(cfg, distinctNames(selectNames(cfg, normalizeNames(cfg, certNames(ev.Cert)))))
+	events := make([]*certEvent, 0, len(names))
+	for _, name := range names {
+		e := *ev
+		e.Name = name
+		events = append(events, &e)
+	}
+	return events
+}
+
+// Values of -time-format that are not layouts.
+const (
+	timeFormatEpoch       = "epoch"
+	timeFormatEpochMillis = "epoch-millis"
+)
+
+// appendTime appends t to b as -time-format and -time-zone ask.
+func appendTime(b []byte, cfg *config, t time.Time) []byte {
+	switch cfg.TimeFormat {
+	case timeFormatEpoch:
+		return strconv.AppendInt(b, t.Unix(), 10)
+	case timeFormatEpochMillis:
+		return strconv.AppendInt(b, t.UnixMilli(), 10)
+	}
+	return t.In(cfg.timeZone).AppendFormat(b, cfg.TimeFormat)
+}
+
+// writeNames appends a list of names (or other strings) to buf separated by
+// ", ".
+func writeNames(buf *bytes.Buffer, names []string) {
+	for i, name := range names {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString(name)
+	}
+}
+
+// writeLimitedNames is writeNames for a certificate's names, of which it
+// writes at most -max-names followed by the number left out, as in
+// "a.example, b.example (+998 more)".
+func writeLimitedNames(buf *bytes.Buffer, cfg *config, names []string) {
+	names, omitted := limitNames(cfg, names)
+	writeNames(buf, names)
+	if omitted > 0 {
+		buf.WriteString(" (+")
+		buf.Write(strconv.AppendInt(buf.AvailableBuffer(), int64(omitted), 10))
+		buf.WriteString(" more)")
+	}
+}
+
+// formatCompact renders an event as a single line without the field
+// labels used on stdout, for sinks such as syslog.
+func formatCompact(cfg *config, ev *certEvent) string {
+	var buf bytes.Buffer
+	buf.Write(appendTime(buf.AvailableBuffer(), cfg, ev.Timestamp))
+	buf.WriteByte(' ')
+	names, omitted := limitNames(cfg, eventNames(cfg, ev))
+	if len(names) == 0 {
+		buf.WriteString(noNamesPlaceholder)
+	}
+	for i, name := range names {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(name)
+	}
+	if omitted > 0 {
+		buf.WriteString(" names_omitted=")
+		buf.Write(strconv.AppendInt(buf.AvailableBuffer(), int64(omitted), 10))
+	}
+	if cfg.MatchRules {
+		buf.WriteString(` rules="`)
+		buf.WriteString(strings.Join(matchedRules(cfg, ev.Cert, eventNames(cfg, ev)), ","))
+		buf.WriteByte('"')
+	}
+	if cfg.IssuerDN || cfg.Verbose {
+		buf.WriteString(` issuer="`)
+		buf.WriteString(ev.Cert.Issuer.String())
+		buf.WriteByte('"')
+	}
+	if cfg.IssuerOrg {
+		buf.WriteString(` issuer_o="`)
+		buf.WriteString(strings.Join(ev.Cert.Issuer.Organization, ", "))
+		buf.WriteByte('"')
+	}
+	if cfg.IssuerCN {
+		buf.WriteString(` issuer_cn="`)
+		buf.WriteString(ev.Cert.Issuer.CommonName)
+		buf.WriteByte('"')
+	}
+	if ev.Precert {
+		buf.WriteString(` type="precert"`)
+	}
+	if ev.NotYetValid {
+		buf.WriteString(` not_before="`)
+		buf.Write(appendTime(buf.AvailableBuffer(), cfg, ev.Cert.NotBefore))
+		buf.WriteByte('"')
+	}
+	if ev.Log != nil {
+		buf.WriteString(` log="`)
+		buf.WriteString(ev.Log.Description)
+		buf.WriteByte('"')
+		if id := ev.Log.id(); cfg.LogID && id != "" {
+			buf.WriteString(` log_id="`)
+			buf.WriteString(id)
+			buf.WriteByte('"')
+		}
+	}
+	if cfg.Label != "" {
+		buf.WriteString(` label="`)
+		buf.WriteString(cfg.Label)
+		buf.WriteByte('"')
+	}
+	return buf.String()
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// benchmarkEvents returns events for n certificates, as a monitor emits
+// them.
+func benchmarkEvents(b *testing.B, n int) []*certEvent {
+	b.Helper()
+	logInfo := &LogInfo{Description: "Benchmark log", URL: "https://ct.example.com/log/"}
+	operator := &Operator{Name: "Benchmark"}
+	var events []*certEvent
+	for i, leaf := range mockLeaves(b, n) {
+		entry, err := newLogEntry(int64(i), &leaf, 0, nil)
+		if err != nil || entry.Cert == nil {
+			b.Fatalf("entry %d: %v, %v", i, err, entry.ParseErr)
+		}
+		events = append(events, &certEvent{Timestamp: entry.Timestamp, TimestampSource: timestampFromLog,
+			Cert: entry.Cert, Log: logInfo, Operator: operator, Index: int64(i)})
+	}
+	return events
+}
+
+func BenchmarkWriteOutput(b *testing.B) {
+	events := benchmarkEvents(b, 64)
+	for _, format := range []string{formatText, formatJSON} {
+		b.Run(format, func(b *testing.B) {
+			cfg, _, err := parseTestFlags(b, "-format="+format)
+			if err != nil {
+				b.Fatal(err)
+			}
+			var buf bytes.Buffer
+			b.ReportAllocs()
+			for i := 0; b.Loop(); i++ {
+				buf.Reset()
+				writeOutput(&buf, cfg, events[i%len(events)])
+			}
+		})
+	}
+}
+
+// BenchmarkOutputWriter compares writing each entry to stdout as it comes
+// with batching the writes of a tick, as -flush-interval does.
+func BenchmarkOutputWriter(b *testing.B) {
+	events := benchmarkEvents(b, 64)
+	cfg, _, err := parseTestFlags(b)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, bc := range []struct {
+		name     string
+		buffered bool
+	}{
+		{"per entry", false},
+		{"batched", true},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			f, err := os.Create(filepath.Join(b.TempDir(), "out"))
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer f.Close()
+			o := &outputWriter{w: bufio.NewWriterSize(f, 64<<10), buffered: bc.buffered}
+			var buf bytes.Buffer
+			b.ReportAllocs()
+			for b.Loop() {
+				for _, ev := range events {
+					buf.Reset()
+					writeOutput(&buf, cfg, ev)
+					if _, err := o.Write(buf.Bytes()); err != nil {
+						b.Fatal(err)
+					}
+				}
+				if err := o.Flush(); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(b.Elapsed())/float64(b.N*len(events)), "ns/entry")
+		})
+	}
+}
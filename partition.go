@@ -0,0 +1,22 @@
+package main
+
+import "hash/fnv"
+
+// partitionLogs returns the logs assigned to instance index of count, for
+// splitting the logs between several certtail instances. Assignment hashes
+// the log URL, so it is the same on every instance and on every run: each
+// log goes to exactly one instance regardless of the order of the log list.
+func partitionLogs(logs []LogInfo, index, count int) []LogInfo {
+	if count <= 1 {
+		return logs
+	}
+	var mine []LogInfo
+	for _, logInfo := range logs {
+		h := fnv.New64a()
+		h.Write([]byte(logInfo.URL))
+		if h.Sum64()%uint64(count) == uint64(index) {
+			mine = append(mine, logInfo)
+		}
+	}
+	return mine
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// writePIDFile writes the process ID to path for init scripts and reload
+// tooling, refusing to if the file names another certtail that is still
+// running. A file left behind by a process that is gone, as after a crash,
+// is replaced.
+func writePIDFile(path string) error {
+	pid := os.Getpid()
+	for {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err == nil {
+			_, err = fmt.Fprintf(f, "%d\n", pid)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			return err
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		other, err := strconv.Atoi(strings.TrimSpace(string(data)))
+		if err == nil && other != pid && processRunning(other) {
+			return fmt.Errorf("%s belongs to process %d, which is still running", path, other)
+		}
+		log.Printf("Replacing stale PID file %s", path)
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+}
+
+// removePIDFile removes the PID file at path on a clean shutdown, unless
+// another process has taken it over since.
+func removePIDFile(path string) {
+	data, err := os.ReadFile(path)
+	if err != nil || strings.TrimSpace(string(data)) != strconv.Itoa(os.Getpid()) {
+		return
+	}
+	if err := os.Remove(path); err != nil {
+		log.Printf("Failed to remove PID file: %v", err)
+	}
+}
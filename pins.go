@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// pinSet holds the SHA-256 hashes of the public keys (SPKI) that the logs'
+// TLS certificate chains must contain, for -tls-pins. Pinning a key rather
+// than a certificate, and typically an intermediate's rather than the
+// leaf's, lets the log renew its certificate without breaking the pin; when
+// the pinned key does change, the file can be updated and reloaded with
+// SIGHUP. Only new connections are checked, so connections established
+// before a reload carry on until they are closed.
+type pinSet struct {
+	path string
+	pins atomic.Pointer[map[[sha256.Size]byte]bool]
+}
+
+// loadPinSet reads the pins in path.
+func loadPinSet(path string) (*pinSet, error) {
+	p := &pinSet{path: path}
+	if err := p.reload(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// reload reads the pin file again, one base64 SPKI hash per line,
+// optionally prefixed with sha256/ as in HPKP. Blank lines and lines
+// starting with # are ignored. On error the current pins stay in force.
+func (p *pinSet) reload() error {
+	f, err := os.Open(p.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	pins := make(map[[sha256.Size]byte]bool)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(line, "sha256/"))
+		if err != nil || len(raw) != sha256.Size {
+			return fmt.Errorf("%s: %q is not a base64 SHA-256 hash", p.path, line)
+		}
+		pins[[sha256.Size]byte(raw)] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if len(pins) == 0 {
+		return fmt.Errorf("%s lists no pins", p.path)
+	}
+	p.pins.Store(&pins)
+	return nil
+}
+
+// verifyConnection is a tls.Config.VerifyConnection callback that accepts
+// a connection whose verified chain contains a pinned key. It runs after
+// the usual certificate verification.
+func (p *pinSet) verifyConnection(cs tls.ConnectionState) error {
+	pins := *p.pins.Load()
+	for _, chain := range cs.VerifiedChains {
+		for _, cert := range chain {
+			if pins[sha256.Sum256(cert.RawSubjectPublicKeyInfo)] {
+				return nil
+			}
+		}
+	}
+	leaf := "none"
+	if len(cs.PeerCertificates) > 0 {
+		sum := sha256.Sum256(cs.PeerCertificates[0].RawSubjectPublicKeyInfo)
+		leaf = "sha256/" + base64.StdEncoding.EncodeToString(sum[:])
+	}
+	return fmt.Errorf("no key in the TLS certificate chain of %s matches -tls-pins (leaf key %s)", cs.ServerName, leaf)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// pinOf returns the -tls-pins line pinning cert's key.
+func pinOf(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return "sha256/" + base64.StdEncoding.EncodeToString(sum[:]) + "\n"
+}
+
+func TestPinSetReload(t *testing.T) {
+	var certs []*x509.Certificate
+	for _, name := range []string{"old.example.com", "new.example.com"} {
+		cert, err := x509.ParseCertificate(testCertDER(t, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		certs = append(certs, cert)
+	}
+	oldCert, newCert := certs[0], certs[1]
+	connection := func(cert *x509.Certificate) tls.ConnectionState {
+		return tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}, VerifiedChains: [][]*x509.Certificate{{cert}}}
+	}
+	path := filepath.Join(t.TempDir(), "pins.txt")
+	write := func(pins string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(pins), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("# the log's current key\n" + pinOf(oldCert))
+	pins, err := loadPinSet(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pins.verifyConnection(connection(oldCert)); err != nil {
+		t.Errorf("the pinned key was rejected: %v", err)
+	}
+	if pins.verifyConnection(connection(newCert)) == nil {
+		t.Error("a key not pinned was accepted")
+	}
+
+	// The log rotates its key: the file is updated and reloaded.
+	write(pinOf(newCert))
+	if err := pins.reload(); err != nil {
+		t.Fatal(err)
+	}
+	if err := pins.verifyConnection(connection(newCert)); err != nil {
+		t.Errorf("the newly pinned key was rejected after a reload: %v", err)
+	}
+	if pins.verifyConnection(connection(oldCert)) == nil {
+		t.Error("the key no longer pinned was accepted after a reload")
+	}
+
+	write("not a pin\n")
+	if err := pins.reload(); err == nil {
+		t.Error("reload of an invalid file succeeded")
+	}
+	if err := pins.verifyConnection(connection(newCert)); err != nil {
+		t.Errorf("a failed reload did not keep the current pins: %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/google/certificate-transparency-go/x509"
+)
+
+// The CA/Browser Forum's reserved policy OIDs, which certificates assert
+// to state how their subject was validated, by their -policy alias.
+var policyAliases = map[string]string{
+	"ev": "2.23.140.1.1",
+	"dv": "2.23.140.1.2.1",
+	"ov": "2.23.140.1.2.2",
+	"iv": "2.23.140.1.2.3",
+}
+
+// policyList is a repeatable flag of certificate policy OIDs, given in
+// dotted form or as one of the policyAliases.
+type policyList []string
+
+func (l *policyList) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, ", ")
+}
+
+func (l *policyList) Set(v string) error {
+	v = strings.TrimSpace(v)
+	if oid, ok := policyAliases[strings.ToLower(v)]; ok {
+		v = oid
+	}
+	parts := strings.Split(v, ".")
+	if len(parts) < 2 {
+		return fmt.Errorf("%q is not a policy OID (such as 2.23.140.1.1) or one of ev, ov, dv and iv", v)
+	}
+	for _, part := range parts {
+		if _, err := strconv.ParseUint(part, 10, 32); err != nil {
+			return fmt.Errorf("%q is not a policy OID (such as 2.23.140.1.1) or one of ev, ov, dv and iv", v)
+		}
+	}
+	*l = append(*l, v)
+	return nil
+}
+
+// matches reports whether cert asserts one of the policies.
+func (l policyList) matches(cert *x509.Certificate) bool {
+	for _, oid := range cert.PolicyIdentifiers {
+		for _, policy := range l {
+			if oid.String() == policy {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// writePolicies appends cert's policy OIDs to buf, each of the CA/Browser
+// Forum's followed by its alias, such as "2.23.140.1.1 (EV)".
+func writePolicies(buf *bytes.Buffer, cert *x509.Certificate) {
+	for i, oid := range cert.PolicyIdentifiers {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		s := oid.String()
+		buf.WriteString(s)
+		for alias, aliased := range policyAliases {
+			if s == aliased {
+				buf.WriteString(" (")
+				buf.WriteString(strings.ToUpper(alias))
+				buf.WriteByte(')')
+			}
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"sync"
+	"time"
+)
+
+// linkMaxPending bounds the precertificates -link-precerts waits for at
+// once; beyond it, new precertificates are not tracked.
+const linkMaxPending = 1000000
+
+// precertLinker pairs the precertificates certtail emits with their final
+// certificates, for -link-precerts. A final certificate has its
+// precertificate's issuer and serial, so those identify the pair. A
+// precertificate whose final certificate has not turned up within the
+// window is forgotten: CAs do not always log the final certificate.
+type precertLinker struct {
+	window time.Duration
+
+	mu      sync.Mutex
+	pending map[fingerprint]pendingPrecert
+}
+
+type pendingPrecert struct {
+	timestamp time.Time // when its log logged it
+	log       string
+	expires   time.Time
+}
+
+func newPrecertLinker(window time.Duration) *precertLinker {
+	return &precertLinker{window: window, pending: make(map[fingerprint]pendingPrecert)}
+}
+
+// observe records ev's precertificate, or for a final certificate returns
+// its pending precertificate, which it stops tracking.
+func (l *precertLinker) observe(ev *certEvent, now time.Time) (precert pendingPrecert, linked bool) {
+	key := serialKey(ev.Cert, false)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if ev.Precert {
+		// The first log a precertificate is seen in is kept.
+		if _, ok := l.pending[key]; !ok && len(l.pending) < linkMaxPending {
+			l.pending[key] = pendingPrecert{timestamp: ev.Timestamp, log: ev.Log.Description, expires: now.Add(l.window)}
+		}
+		return pendingPrecert{}, false
+	}
+	precert, linked = l.pending[key]
+	if linked {
+		delete(l.pending, key)
+	}
+	return precert, linked
+}
+
+// expireEvery forgets the precertificates whose window has passed every
+// interval until done is closed, counting them in the precert_unlinked
+// metric.
+func (l *precertLinker) expireEvery(interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			l.mu.Lock()
+			expired := make(map[string]int64)
+			for key, p := range l.pending {
+				if now.After(p.expires) {
+					delete(l.pending, key)
+					expired[p.log]++
+				}
+			}
+			l.mu.Unlock()
+			for logName, n := range expired {
+				metrics.count(metricPrecertUnlinked, n, logName)
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// writeLinkLine appends the line linking ev's final certificate to its
+// precertificate, delay after it.
+func writeLinkLine(buf *bytes.Buffer, cfg *config, ev *certEvent, precert pendingPrecert, delay time.Duration) {
+	buf.WriteString("Linked: ")
+	startColor(buf, cfg, ansiCyan)
+	buf.WriteString("final certificate logged ")
+	buf.WriteString(delay.Round(time.Second).String())
+	buf.WriteString(" after its precertificate")
+	endColor(buf, cfg)
+	buf.WriteString(", Serial: ")
+	buf.WriteString(formatSerial(ev.Cert))
+	buf.WriteString(", Names: ")
+	writeLimitedNames(buf, cfg, normalizeNames(cfg, certNames(ev.Cert)))
+	buf.WriteString(", Log: ")
+	buf.WriteString(ev.Log.Description)
+	buf.WriteString(", Precert log: ")
+	buf.WriteString(precert.log)
+	buf.WriteByte('\n')
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	ct "github.com/google/certificate-transparency-go"
+)
+
+// probeTimeout bounds how long -probe-logs waits for each log's STH.
+const probeTimeout = 30 * time.Second
+
+// Values of -check-mmd.
+const (
+	checkMMDWarn = "warn" // log a warning for stale logs, and monitor them
+	checkMMDSkip = "skip" // leave stale logs out
+)
+
+// probeResult is the STH of a log, or why it could not be fetched.
+type probeResult struct {
+	sth *ct.SignedTreeHead
+	err error
+}
+
+// probeSTHs fetches the STH of every log concurrently, returning the
+// results in the order of logs.
+func probeSTHs(cfg *config, logs []LogInfo) []probeResult {
+	results := make([]probeResult, len(logs))
+	done := make(chan struct{})
+	for i, logInfo := range logs {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			logClient, _, err := newMonitorClient(cfg, logInfo)
+			if err != nil {
+				results[i] = probeResult{err: err}
+				return
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+			defer cancel()
+			sth, err := logClient.GetSTH(ctx)
+			results[i] = probeResult{sth, err}
+		}()
+	}
+	for range logs {
+		<-done
+	}
+	return results
+}
+
+// sthAge returns how old sth is at now, and whether that is beyond
+// logInfo's maximum merge delay: such a log is not incorporating new
+// entries within its own policy and is a poor choice to rely on for
+// monitoring. The age is measured against our clock, so a log whose clock
+// is behind ours looks older than it is; it is only stale once the age is
+// beyond what the tolerated skew can explain.
+func sthAge(cfg *config, logInfo LogInfo, sth *ct.SignedTreeHead, now time.Time) (time.Duration, bool) {
+	age := now.Sub(time.UnixMilli(int64(sth.Timestamp))).Truncate(time.Second)
+	return age, logInfo.MMD > 0 && age > time.Duration(logInfo.MMD)*time.Second+cfg.ClockSkew
+}
+
+// probeLogs fetches the STH of every log and prints a table of tree sizes
+// and STH ages, flagging logs whose latest STH is older than their maximum
+// merge delay. It returns the process exit code: 0 if every log responded
+// with a fresh STH, 1 otherwise.
+func probeLogs(cfg *config, logs []LogInfo) int {
+	results := probeSTHs(cfg, logs)
+	now := time.Now()
+	code := 0
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "LOG\tTREE SIZE\tSTH TIMESTAMP\tSTH AGE\tMMD\tSTATUS")
+	for i, logInfo := range logs {
+		mmd := "-"
+		if logInfo.MMD > 0 {
+			mmd = (time.Duration(logInfo.MMD) * time.Second).String()
+		}
+		r := results[i]
+		if r.err != nil {
+			fmt.Fprintf(tw, "%s\t-\t-\t-\t%s\terror: %v\n", logInfo.Description, mmd, r.err)
+			code = 1
+			continue
+		}
+		ts := time.UnixMilli(int64(r.sth.Timestamp)).UTC()
+		age, stale := sthAge(cfg, logInfo, r.sth, now)
+		status := "ok"
+		if stale {
+			status = "STH older than MMD"
+			code = 1
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%s\n", logInfo.Description, r.sth.TreeSize, ts.Format(time.RFC3339), age, mmd, status)
+	}
+	tw.Flush()
+	return code
+}
+
+// applyCheckMMD fetches the STH of every log for -check-mmd, and warns
+// about the logs whose STH is older than their maximum merge delay or,
+// with checkMMDSkip, leaves them out. Logs whose STH cannot be fetched
+// are kept, with a warning: their monitors retry as usual.
+func applyCheckMMD(cfg *config, logs []LogInfo) []LogInfo {
+	if cfg.CheckMMD == "" {
+		return logs
+	}
+	results := probeSTHs(cfg, logs)
+	now := time.Now()
+	var kept []LogInfo
+	for i, logInfo := range logs {
+		r := results[i]
+		if r.err != nil {
+			log.Printf("Warning: failed to check the STH of %s against its MMD: %v", logInfo.Description, r.err)
+		} else if age, stale := sthAge(cfg, logInfo, r.sth, now); stale {
+			mmd := time.Duration(logInfo.MMD) * time.Second
+			if cfg.CheckMMD == checkMMDSkip {
+				log.Printf("Skipping %s: its latest STH is %s old, older than its MMD of %s", logInfo.Description, age, mmd)
+				continue
+			}
+			log.Printf("Warning: the latest STH of %s is %s old, older than its MMD of %s", logInfo.Description, age, mmd)
+		}
+		kept = append(kept, logInfo)
+	}
+	return kept
+}
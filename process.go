@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"time"
+)
+
+// entryProcessor takes the entries of one log from parsing to the output
+// and the sinks: sampling, filters, deduplication, alerts and metrics. Each
+// monitor has one, as does each log of a -replay. It is not safe for
+// concurrent use.
+type entryProcessor struct {
+	sh       *shared
+	cfg      *config // the log's configuration, with -log-filters applied
+	filters  []certFilter
+	logInfo  *LogInfo
+	operator *Operator
+	warnings *warnCoalescer
+
+	// Detection latency is only measured for entries from liveFrom on.
+	liveFrom int64
+	latency  latencyTracker
+
+	// out collects the output of a batch; it is flushed to stdout in a
+	// single write once the batch has been processed, or earlier if it
+	// grows large.
+	out bytes.Buffer
+	// reordered is a certificate's output on its way to the reorder buffer.
+	reordered bytes.Buffer
+}
+
+// flush writes the output collected so far to stdout.
+func (p *entryProcessor) flush() {
+	if p.out.Len() == 0 {
+		return
+	}
+	if _, err := stdout.Write(p.out.Bytes()); err != nil {
+		log.Printf("Failed to write output for %s: %v", p.logInfo.Description, err)
+	}
+	p.out.Reset()
+}
+
+// process emits the certificate the log entry at index holds, if it gets
+// through.
+func (p *entryProcessor) process(entry *logEntry, index int64) {
+	sh, cfg, logInfo := p.sh, p.cfg, p.logInfo
+	// Entries -sample-rate leaves out, like those of unwanted types, were
+	// skipped by newLogEntry before parsing (see sampleEntry), so that they
+	// cost nothing; the index still advances over every entry.
+	metrics.count(metricEntries, 1, logInfo.Description)
+	if entry.Oversized {
+		log.Printf("Skipping entry %d of %s: larger than -max-entry-size", index, logInfo.Description)
+		metrics.count(metricParseErrors, 1, logInfo.Description)
+		return
+	}
+	if entry.Skipped || !cfg.wantsEntry(entry.Type) {
+		return
+	}
+	cert := entry.Cert
+	var precert bool
+	switch entry.Type {
+	case entryX509:
+		if entry.ParseErr != nil {
+			p.warnings.warn("Failed to parse X509 certificate from "+logInfo.Description, entry.ParseErr, time.Now())
+			metrics.count(metricParseErrors, 1, logInfo.Description)
+			return
+		}
+	case entryPrecert:
+		// The TBSCertificate's Issuer is the one to report, not the
+		// submitted certificate's (see logEntry.Cert).
+		if cert == nil {
+			p.warnings.warn("Failed to parse precertificate from "+logInfo.Description, entry.ParseErr, time.Now())
+			metrics.count(metricParseErrors, 1, logInfo.Description)
+			return
+		}
+		precert = true
+	default:
+		if entry.ParseErr != nil {
+			p.warnings.warn("Failed to decode entry from "+logInfo.Description, entry.ParseErr, time.Now())
+			metrics.count(metricParseErrors, 1, logInfo.Description)
+			return
+		}
+		log.Printf("Skipping entry %d of unknown type from %s", index, logInfo.Description)
+		return
+	}
+
+	// Serial reuse is checked for every certificate, whether or not it
+	// is emitted.
+	if sh.serials != nil {
+		if previous, reused := sh.serials.check(cert, precert); reused {
+			log.Printf("Serial number reuse: %s issued serial %s for two different certificates, seen in %s", cert.Issuer.String(), formatSerial(cert), logInfo.Description)
+			if cfg.Format == formatText {
+				writeSerialAlert(&p.out, cfg, &certEvent{Cert: cert, Precert: precert, Log: logInfo}, previous)
+			}
+		}
+	}
+
+	// So is key reuse.
+	if sh.keys != nil {
+		if certs, reusedKeys, reused := sh.keys.observe(cert); reused {
+			metrics.count(metricKeyReuse, 1, logInfo.Description)
+			metrics.gauge(metricKeysReused, int64(reusedKeys), "")
+			if certs == cfg.KeyReuseThreshold {
+				log.Printf("Key reuse: a public key has been seen on %d certificates, the latest issued by %s, seen in %s", certs, cert.Issuer.String(), logInfo.Description)
+				if cfg.Format == formatText {
+					writeKeyReuseAlert(&p.out, cfg, &certEvent{Cert: cert, Precert: precert, Log: logInfo}, certs)
+				}
+			}
+		}
+	}
+
+	if !passes(p.filters, cert) {
+		return
+	}
+
+	if sh.dedup != nil && sh.dedup.seen(logInfo.Description, dedupKey(cfg, cert)) {
+		return
+	}
+	// Past the -limit, certificates are dropped while certtail shuts down.
+	if sh.limit != nil && !sh.limit.take() {
+		return
+	}
+
+	ev := &certEvent{Cert: cert, Precert: precert, Log: logInfo, Operator: p.operator, Index: index}
+	if cfg != sh.cfg {
+		ev.logCfg = cfg
+	}
+	ev.NotYetValid = notYetValid(cert, time.Now(), cfg.ClockSkew)
+	if cfg.Chain {
+		var err error
+		if ev.Chain, err = parseChain(entry.Chain); err != nil {
+			p.warnings.warn("Failed to parse the chain of a certificate from "+logInfo.Description, err, time.Now())
+		}
+	}
+	if !entry.Timestamp.IsZero() {
+		ev.Timestamp = entry.Timestamp
+		ev.TimestampSource = timestampFromLog
+	} else {
+		// Without a timestamped entry the certificate is still a
+		// valid observation; notBefore is the closest stand-in.
+		ev.Timestamp = cert.NotBefore
+		ev.TimestampSource = timestampFromNotBefore
+	}
+	if sh.alert != nil {
+		if count, fired := sh.alert.observe(ev); fired {
+			log.Printf("Issuance rate alert: %d matching certificates within %s, latest in %s", count, cfg.AlertWindow, logInfo.Description)
+			if cfg.Format == formatText {
+				sh.alert.writeAlert(&p.out, cfg, ev, count)
+			}
+		}
+	}
+	metrics.count(metricCertificates, 1, logInfo.Description)
+	if index >= p.liveFrom && ev.TimestampSource == timestampFromLog {
+		d := time.Since(ev.Timestamp)
+		p.latency.observe(d)
+		metrics.timing(metricLatency, d, logInfo.Description)
+	}
+	if sh.validity != nil {
+		sh.validity.observe(cert, logInfo.Description)
+	}
+	var linked pendingPrecert
+	var link bool
+	if sh.links != nil {
+		if linked, link = sh.links.observe(ev, time.Now()); link {
+			metrics.timing(metricPrecertDelay, ev.Timestamp.Sub(linked.timestamp), linked.log)
+		}
+	}
+	// Certificates above -max-output-rate still reach the sinks.
+	printed := sh.throttle.allow(time.Now())
+	// With -reorder-window the certificate's output goes to the
+	// reorder buffer rather than with the rest of the batch.
+	dst := &p.out
+	if sh.reorder != nil {
+		p.reordered.Reset()
+		dst = &p.reordered
+	}
+	if cfg.Format == formatNames {
+		if printed {
+			writeNameLines(dst, cfg, ev, sh.nameDedup)
+		}
+		sh.events.publish(ev)
+	} else if cfg.ExplodeNames && len(certNames(cert)) > 0 {
+		// Publishing numbers the event, for -format json.
+		for _, nameEv := range explodeNames(cfg, ev) {
+			sh.events.publish(nameEv)
+			if printed {
+				writeOutput(dst, cfg, nameEv)
+			}
+		}
+	} else {
+		sh.events.publish(ev)
+		if printed {
+			writeOutput(dst, cfg, ev)
+		}
+	}
+	if printed && link && cfg.Format == formatText {
+		writeLinkLine(dst, cfg, ev, linked, ev.Timestamp.Sub(linked.timestamp))
+	}
+	if printed && sh.resolver != nil {
+		sh.resolver.enqueue(cfg, ev)
+	}
+	if sh.reorder != nil && p.reordered.Len() > 0 {
+		sh.reorder.add(ev.Timestamp, bytes.Clone(p.reordered.Bytes()))
+	}
+	if p.out.Len() >= monitorFlushThreshold {
+		p.flush()
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestProcessor returns the entry processor of a monitor with cfg.
+func newTestProcessor(cfg *config) *entryProcessor {
+	sh := &shared{cfg: cfg, events: newBroadcaster(), status: newStatusBoard(nil), filters: buildFilters(cfg)}
+	return &entryProcessor{sh: sh, cfg: cfg, filters: sh.filters, logInfo: &LogInfo{Description: "Test log"},
+		operator: &Operator{Name: "Test"}, warnings: newWarnCoalescer(cfg.WarnInterval)}
+}
+
+func TestPrecertsEmittedByDefault(t *testing.T) {
+	leaf := testPrecertLeaf(t, testPrecertTBS(t, "Test CA", "www.example.com"), time.Now())
+	for _, tt := range []struct {
+		args []string
+		want bool
+	}{
+		{nil, true},
+		{[]string{"-only=precert"}, true},
+		{[]string{"-precerts=false"}, false},
+		{[]string{"-only=x509"}, false},
+	} {
+		cfg, _, err := parseTestFlags(t, tt.args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := cfg.wantsEntry(entryPrecert); got != tt.want {
+			t.Errorf("%q: wantsEntry(precert) = %v, want %v", tt.args, got, tt.want)
+		}
+		entry, err := newLogEntry(0, &leaf, 0, cfg.wantsEntry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := newTestProcessor(cfg)
+		p.process(&entry, 0)
+		out := p.out.String()
+		if got := strings.Contains(out, "Type: precert") && strings.Contains(out, "www.example.com"); got != tt.want {
+			t.Errorf("%q: emitted the precertificate: %v, want %v; output %q", tt.args, got, tt.want, out)
+		}
+	}
+}
+
+func TestSampledOutEntriesNotParsed(t *testing.T) {
+	leaf := testPrecertLeaf(t, testPrecertTBS(t, "Test CA", "www.example.com"), time.Now())
+	for _, tt := range []struct {
+		rate       string
+		wantParsed bool
+	}{
+		{"1", true},
+		{"0", false},
+	} {
+		cfg, _, err := parseTestFlags(t, "-sample-rate="+tt.rate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entry, err := newLogEntry(0, &leaf, 0, cfg.sampleEntry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed := entry.Cert != nil; parsed != tt.wantParsed || entry.Skipped == tt.wantParsed {
+			t.Errorf("-sample-rate=%s: parsed %v, skipped %v; want parsed %v", tt.rate, parsed, entry.Skipped, tt.wantParsed)
+		}
+		p := newTestProcessor(cfg)
+		p.process(&entry, 0)
+		if emitted := p.out.Len() > 0; emitted != tt.wantParsed {
+			t.Errorf("-sample-rate=%s: emitted %v, want %v", tt.rate, emitted, tt.wantParsed)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// promRecorder keeps the metrics certtail records for Prometheus to scrape
+// from -metrics-addr, as certtail_<name>: counters with a _total suffix,
+// timings as summaries in seconds (their sum and count), and gauges as
+// they were last set. Measurements for a log carry a "log" label. It sits
+// in front of the configured metrics recorder, passing every measurement
+// on.
+type promRecorder struct {
+	next metricsRecorder
+
+	mu       sync.Mutex
+	counters map[statsdKey]int64
+	timings  map[statsdKey]*promSummary
+	gauges   map[statsdKey]int64
+}
+
+type promSummary struct {
+	sum   time.Duration
+	count int64
+}
+
+func newPromRecorder(next metricsRecorder) *promRecorder {
+	return &promRecorder{
+		next:     next,
+		counters: make(map[statsdKey]int64),
+		timings:  make(map[statsdKey]*promSummary),
+		gauges:   make(map[statsdKey]int64),
+	}
+}
+
+func (p *promRecorder) count(name string, n int64, logName string) {
+	p.next.count(name, n, logName)
+	p.mu.Lock()
+	p.counters[statsdKey{name, logName}] += n
+	p.mu.Unlock()
+}
+
+func (p *promRecorder) timing(name string, d time.Duration, logName string) {
+	p.next.timing(name, d, logName)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s, ok := p.timings[statsdKey{name, logName}]
+	if !ok {
+		s = &promSummary{}
+		p.timings[statsdKey{name, logName}] = s
+	}
+	s.sum += d
+	s.count++
+}
+
+func (p *promRecorder) gauge(name string, value int64, logName string) {
+	p.next.gauge(name, value, logName)
+	p.mu.Lock()
+	p.gauges[statsdKey{name, logName}] = value
+	p.mu.Unlock()
+}
+
+// write writes every metric in the Prometheus text exposition format,
+// ordered by name and then by log.
+func (p *promRecorder) write(w io.Writer) error {
+	type sample struct {
+		suffix, logName, value string
+	}
+	type family struct {
+		kind    string
+		samples []sample
+	}
+	families := make(map[string]*family)
+	add := func(name, kind, suffix, logName, value string) {
+		f, ok := families[name]
+		if !ok {
+			f = &family{kind: kind}
+			families[name] = f
+		}
+		f.samples = append(f.samples, sample{suffix, logName, value})
+	}
+
+	p.mu.Lock()
+	for key, n := range p.counters {
+		add(promName(key.name)+"_total", "counter", "", key.logName, fmt.Sprint(n))
+	}
+	for key, s := range p.timings {
+		name := promName(key.name) + "_seconds"
+		add(name, "summary", "_sum", key.logName, fmt.Sprint(s.sum.Seconds()))
+		add(name, "summary", "_count", key.logName, fmt.Sprint(s.count))
+	}
+	for key, v := range p.gauges {
+		add(promName(key.name), "gauge", "", key.logName, fmt.Sprint(v))
+	}
+	p.mu.Unlock()
+
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	bw := bufio.NewWriter(w)
+	for _, name := range names {
+		f := families[name]
+		sort.SliceStable(f.samples, func(i, j int) bool { return f.samples[i].logName < f.samples[j].logName })
+		fmt.Fprintf(bw, "# TYPE %s %s\n", name, f.kind)
+		for _, s := range f.samples {
+			bw.WriteString(name + s.suffix)
+			if s.logName != "" {
+				bw.WriteString(`{log="` + promLabelEscaper.Replace(s.logName) + `"}`)
+			}
+			bw.WriteString(" " + s.value + "\n")
+		}
+	}
+	return bw.Flush()
+}
+
+// promName turns a metric name such as "validity.90d" into a valid
+// Prometheus one, "certtail_validity_90d".
+func promName(name string) string {
+	return "certtail_" + strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+var promLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// startMetricsServer serves GET /metrics, for Prometheus, and GET /healthz
+// (see serveHealthz) on addr.
+func startMetricsServer(addr string, cfg *config, prom *promRecorder, pause *pauseState, status *statusBoard) (*http.Server, error) {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := prom.write(w); err != nil {
+			log.Printf("Failed to write metrics: %v", err)
+		}
+	})
+	serveHealthz(mux, status, pause, cfg.StallThreshold)
+
+	srv := &http.Server{Handler: mux}
+	go func() {
+		if err := srv.Serve(lis); err != nil && err != http.ErrServerClosed {
+			log.Printf("Metrics server stopped: %v", err)
+		}
+	}()
+	log.Printf("Serving metrics on %s", lis.Addr())
+	return srv, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// countingMetrics counts the measurements passed on to it.
+type countingMetrics struct {
+	noopMetrics
+	n int
+}
+
+func (c *countingMetrics) count(string, int64, string)          { c.n++ }
+func (c *countingMetrics) timing(string, time.Duration, string) { c.n++ }
+func (c *countingMetrics) gauge(string, int64, string)          { c.n++ }
+
+func TestPromRecorderWrite(t *testing.T) {
+	next := &countingMetrics{}
+	p := newPromRecorder(next)
+	p.count(metricEntries, 3, "Log B")
+	p.count(metricEntries, 2, "Log A")
+	p.count(metricEntries, 1, "Log A")
+	p.count(metricSTHErrors, 1, `Odd "log"\name`)
+	p.timing(metricParseTime, 1500*time.Millisecond, "Log A")
+	p.timing(metricParseTime, 500*time.Millisecond, "Log A")
+	p.gauge("validity.90d", 7, "")
+	p.gauge("validity.90d", 9, "")
+
+	var out strings.Builder
+	if err := p.write(&out); err != nil {
+		t.Fatal(err)
+	}
+	want := `# TYPE certtail_entries_total counter
+certtail_entries_total{log="Log A"} 3
+certtail_entries_total{log="Log B"} 3
+# TYPE certtail_parse_time_seconds summary
+certtail_parse_time_seconds_sum{log="Log A"} 2
+certtail_parse_time_seconds_count{log="Log A"} 2
+# TYPE certtail_sth_errors_total counter
+certtail_sth_errors_total{log="Odd \"log\"\\name"} 1
+# TYPE certtail_validity_90d gauge
+certtail_validity_90d 9
+`
+	if got := out.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	// Every measurement is passed on to the next recorder.
+	if next.n != 8 {
+		t.Errorf("next recorder got %d measurements, want 8", next.n)
+	}
+}
+
+func TestPromName(t *testing.T) {
+	for name, want := range map[string]string{
+		"entries":       "certtail_entries",
+		"validity.90d":  "certtail_validity_90d",
+		"exec-failures": "certtail_exec_failures",
+		"Sink:Kafka":    "certtail_Sink_Kafka",
+	} {
+		if got := promName(name); got != want {
+			t.Errorf("promName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
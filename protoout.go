@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protodelim"
+)
+
+// protoRedialInterval bounds how often an unreachable -proto-out socket is
+// retried.
+const protoRedialInterval = 10 * time.Second
+
+// runProtoSink writes every event from sub as a certtail.v1.CertEvent
+// protobuf message, each preceded by its length as a varint (the framing
+// of Java's writeDelimitedTo and Go's protodelim), until the subscription
+// is closed. target is a file path, appended to, or tcp://host:port or
+// unix://path for a socket; events that arrive while a socket is
+// unreachable are dropped. The returned channel is closed once the last
+// event has been written.
+func runProtoSink(cfg *config, target string, sub *subscription) (<-chan struct{}, error) {
+	var open func() (io.WriteCloser, error)
+	network, addr, isSocket := strings.Cut(target, "://")
+	if isSocket {
+		if network != "tcp" && network != "unix" {
+			return nil, fmt.Errorf("-proto-out must be a file, tcp://host:port or unix://path")
+		}
+		open = func() (io.WriteCloser, error) { return net.Dial(network, addr) }
+	} else {
+		open = func() (io.WriteCloser, error) {
+			return os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		}
+	}
+
+	conn, err := open()
+	if err != nil {
+		if !isSocket {
+			return nil, err
+		}
+		log.Printf("Failed to connect to %s, will retry: %v", target, err)
+	}
+	lastDial := time.Now()
+	var w *bufio.Writer
+	if conn != nil {
+		w = bufio.NewWriter(conn)
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		var dropped uint64
+		fail := func(err error) {
+			log.Printf("Failed to write events to %s: %v", target, err)
+			conn.Close()
+			conn, w = nil, nil
+		}
+		for ev := range sub.C {
+			if conn == nil && time.Since(lastDial) >= protoRedialInterval {
+				lastDial = time.Now()
+				if conn, err = open(); err == nil {
+					w = bufio.NewWriter(conn)
+					log.Printf("Connected to %s after dropping %d events", target, dropped)
+				}
+			}
+			if conn == nil {
+				dropped++
+				continue
+			}
+			if _, err := protodelim.MarshalTo(w, eventToProto(cfg, ev)); err != nil {
+				fail(err)
+				dropped++
+				continue
+			}
+			// Flush once the backlog is written rather than per event.
+			if len(sub.C) == 0 {
+				if err := w.Flush(); err != nil {
+					fail(err)
+				}
+			}
+		}
+		if conn != nil {
+			if err := w.Flush(); err != nil {
+				log.Printf("Failed to write events to %s: %v", target, err)
+			}
+			conn.Close()
+		}
+	}()
+	return stopped, nil
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"sync"
+)
+
+// monitorSet runs a monitor per log, and starts and stops monitors one by
+// one as the logs to monitor change on a reload.
+type monitorSet struct {
+	sh   *shared
+	wg   sync.WaitGroup
+	done <-chan struct{} // closed on shutdown, stopping every monitor
+
+	mu      sync.Mutex
+	running map[string]*runningMonitor // keyed by log URL
+}
+
+type runningMonitor struct {
+	logInfo LogInfo
+	stop    chan struct{}
+}
+
+func newMonitorSet(sh *shared, done <-chan struct{}) *monitorSet {
+	return &monitorSet{sh: sh, done: done, running: make(map[string]*runningMonitor)}
+}
+
+// start starts a monitor for logInfo. fromStart reads the log from its
+// first entry; see planRollover.
+func (m *monitorSet) start(operator *Operator, logInfo LogInfo, fromStart bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rm := &runningMonitor{logInfo: logInfo, stop: make(chan struct{})}
+	m.running[logInfo.URL] = rm
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-m.done:
+		case <-rm.stop:
+		}
+		close(done)
+	}()
+	m.wg.Add(1)
+	go func() {
+		monitorLog(m.sh, operator, logInfo, fromStart, &m.wg, done)
+		// A monitor stopped by a reload is gone for good, and must not be
+		// reported as stalled.
+		select {
+		case <-rm.stop:
+			m.sh.status.remove(logInfo)
+		default:
+		}
+	}()
+}
+
+// update makes the set monitor exactly logs: monitors for logs that are no
+// longer among them are stopped and monitors for new ones started, while
+// those for logs that remain carry on undisturbed. operatorOf maps the log
+// URLs to their operators.
+func (m *monitorSet) update(operatorOf map[string]*Operator, logs []LogInfo, fromStart map[string]bool) {
+	want := make(map[string]bool, len(logs))
+	for _, logInfo := range logs {
+		want[logInfo.URL] = true
+	}
+	m.mu.Lock()
+	var stopped []*runningMonitor
+	for url, rm := range m.running {
+		if !want[url] {
+			close(rm.stop)
+			delete(m.running, url)
+			stopped = append(stopped, rm)
+		}
+	}
+	var added []LogInfo
+	for _, logInfo := range logs {
+		if _, ok := m.running[logInfo.URL]; !ok {
+			added = append(added, logInfo)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, rm := range stopped {
+		log.Printf("Reload: %s is no longer selected, stopping its monitor", rm.logInfo.Description)
+	}
+	for _, logInfo := range added {
+		log.Printf("Reload: starting a monitor for %s", logInfo.Description)
+		m.start(operatorOf[logInfo.URL], logInfo, fromStart[logInfo.URL])
+	}
+	if len(stopped) == 0 && len(added) == 0 {
+		log.Printf("Reload: the monitored logs are unchanged")
+	}
+}
+
+// logs returns the logs being monitored, ordered by description.
+func (m *monitorSet) logs() []LogInfo {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	logs := make([]LogInfo, 0, len(m.running))
+	for _, rm := range m.running {
+		logs = append(logs, rm.logInfo)
+	}
+	sort.Slice(logs, func(i, j int) bool { return logs[i].Description < logs[j].Description })
+	return logs
+}
+
+// reloadConfig handles SIGHUP: it reads the files named by flags again
+// (-allowlist, -match-file, -tls-pins and -trusted-cas), fetches the log
+// list afresh and brings the monitors in line with it. A file or log list
+// that fails to load is reported and the current one kept. Other flags,
+// and -log-filters, whose overrides the monitors are set up with, cannot
+// change without a restart.
+func reloadConfig(cfg *config, monitors *monitorSet, state *stateStore) {
+	log.Printf("Reloading configuration")
+	if cfg.Allowlist != nil {
+		if err := cfg.Allowlist.reload(); err != nil {
+			log.Printf("Failed to reload -allowlist, keeping the current list: %v", err)
+		}
+	}
+	if cfg.MatchFile != nil {
+		if err := cfg.MatchFile.reload(); err != nil {
+			log.Printf("Failed to reload -match-file, keeping the current domains: %v", err)
+		}
+	}
+	if cfg.pins != nil {
+		if err := cfg.pins.reload(); err != nil {
+			log.Printf("Failed to reload -tls-pins, keeping the current pins: %v", err)
+		}
+	}
+	if cfg.TrustedCAs != nil {
+		if err := cfg.TrustedCAs.reload(); err != nil {
+			log.Printf("Failed to reload -trusted-cas, keeping the current CAs: %v", err)
+		}
+	}
+
+	reselectLogs(cfg, monitors, state)
+}
+
+// reselectLogs fetches the log list afresh and brings the monitors in line
+// with the logs selected from it.
+func reselectLogs(cfg *config, monitors *monitorSet, state *stateStore) {
+	logList, err := getConfiguredLogList(cfg)
+	if err != nil {
+		log.Printf("Failed to reload log list, keeping the current logs: %v", err)
+		return
+	}
+	// Logs added to the list can turn up in SCTs.
+	cfg.logNames.set(logList)
+	operatorOf, logs, fromStart, err := selectOperatorLogs(cfg, logList, state)
+	if err != nil {
+		log.Printf("Failed to select logs from the reloaded log list, keeping the current logs: %v", err)
+		return
+	}
+	if cfg.ShardCount > 1 {
+		logs = partitionLogs(logs, cfg.ShardIndex, cfg.ShardCount)
+	}
+	if n := len(logs); n > 0 {
+		if logs = applyCheckMMD(cfg, logs); len(logs) == 0 {
+			log.Printf("None of the %d logs selected from the reloaded log list has an STH within its maximum merge delay, keeping the current logs", n)
+			return
+		}
+	}
+	logs = applyMaxLogs(cfg, logs)
+	monitors.update(operatorOf, logs, fromStart)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"container/heap"
+	"log"
+	"sync"
+	"time"
+)
+
+// reorderTick is how often the -reorder-window buffer releases entries.
+const reorderTick = 100 * time.Millisecond
+
+// reorderBuffer holds the stdout output of each certificate for
+// -reorder-window and writes it sorted by CT timestamp, so that the output
+// of many logs comes out in approximately time order rather than
+// interleaved by whichever log was polled last. An entry is written at the
+// latest window after it arrived, together with every held entry with an
+// earlier timestamp; entries that arrive later than that with an earlier
+// timestamp are written as they are released, out of order. At most max
+// entries are held: beyond that the earliest is written straight away.
+type reorderBuffer struct {
+	window time.Duration
+	max    int
+
+	mu      sync.Mutex
+	entries reorderHeap
+}
+
+type reorderEntry struct {
+	timestamp time.Time
+	arrived   time.Time
+	output    []byte
+}
+
+// reorderHeap is a min-heap of entries by timestamp.
+type reorderHeap []*reorderEntry
+
+func (h reorderHeap) Len() int           { return len(h) }
+func (h reorderHeap) Less(i, j int) bool { return h[i].timestamp.Before(h[j].timestamp) }
+func (h reorderHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *reorderHeap) Push(x any)        { *h = append(*h, x.(*reorderEntry)) }
+func (h *reorderHeap) Pop() any {
+	old := *h
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return e
+}
+
+func newReorderBuffer(window time.Duration, max int) *reorderBuffer {
+	return &reorderBuffer{window: window, max: max}
+}
+
+// add holds output, the stdout lines for a certificate with the given
+// timestamp.
+func (r *reorderBuffer) add(timestamp time.Time, output []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	heap.Push(&r.entries, &reorderEntry{timestamp: timestamp, arrived: time.Now(), output: output})
+	var overflow []byte
+	for r.entries.Len() > r.max {
+		overflow = append(overflow, heap.Pop(&r.entries).(*reorderEntry).output...)
+	}
+	r.write(overflow)
+}
+
+// release writes the entries that have been held for the window, along
+// with the held entries with earlier timestamps.
+func (r *reorderBuffer) release(now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var cutoff time.Time
+	for _, e := range r.entries {
+		if now.Sub(e.arrived) >= r.window && e.timestamp.After(cutoff) {
+			cutoff = e.timestamp
+		}
+	}
+	var out []byte
+	for r.entries.Len() > 0 && !r.entries[0].timestamp.After(cutoff) {
+		out = append(out, heap.Pop(&r.entries).(*reorderEntry).output...)
+	}
+	r.write(out)
+}
+
+// run releases entries until done is closed, and then writes the rest.
+func (r *reorderBuffer) run(done <-chan struct{}) {
+	ticker := time.NewTicker(reorderTick)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			r.release(now)
+		case <-done:
+			return
+		}
+	}
+}
+
+// flush writes every held entry, in timestamp order.
+func (r *reorderBuffer) flush() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []byte
+	for r.entries.Len() > 0 {
+		out = append(out, heap.Pop(&r.entries).(*reorderEntry).output...)
+	}
+	r.write(out)
+}
+
+// write writes out to stdout. It is called with mu held, so that released
+// entries reach stdout in the order they were released.
+func (r *reorderBuffer) write(out []byte) {
+	if len(out) == 0 {
+		return
+	}
+	if _, err := stdout.Write(out); err != nil {
+		log.Printf("Failed to write output: %v", err)
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	ct "github.com/google/certificate-transparency-go"
+)
+
+// replayLog is a log whose entries -replay reads from an archive
+// directory.
+type replayLog struct {
+	dir      string
+	operator *Operator
+	logInfo  LogInfo
+}
+
+// archivedLogs returns the logs archived under dir by -archive-dir, one per
+// directory, as described by its archiveLogFile. Directories without one,
+// from before it was written, are named after the directory.
+func archivedLogs(dir string) ([]replayLog, error) {
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var logs []replayLog
+	for _, de := range dirEntries {
+		if !de.IsDir() {
+			continue
+		}
+		l := replayLog{dir: filepath.Join(dir, de.Name()), logInfo: LogInfo{URL: de.Name(), Description: de.Name()}}
+		data, err := os.ReadFile(filepath.Join(l.dir, archiveLogFile))
+		switch {
+		case err == nil:
+			var described archivedLog
+			if err := json.Unmarshal(data, &described); err != nil {
+				return nil, fmt.Errorf("failed to parse %s: %w", filepath.Join(l.dir, archiveLogFile), err)
+			}
+			l.logInfo = described.Log
+			if described.Operator != "" {
+				l.operator = &Operator{Name: described.Operator}
+			}
+		case !errors.Is(err, fs.ErrNotExist):
+			return nil, err
+		}
+		logs = append(logs, l)
+	}
+	if len(logs) == 0 {
+		return nil, fmt.Errorf("no archived logs in %s", dir)
+	}
+	return logs, nil
+}
+
+// archiveFiles returns the archive files in a log's directory, in index
+// order. Their names start with the first index of their range, padded to
+// at least eight digits, so they cannot simply be sorted by name.
+func archiveFiles(logDir string) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(logDir, "*.ndjson.gz"))
+	if err != nil {
+		return nil, err
+	}
+	first := make(map[string]int64, len(paths))
+	var files []string
+	for _, path := range paths {
+		lo, _, _ := strings.Cut(filepath.Base(path), "-")
+		index, err := strconv.ParseInt(lo, 10, 64)
+		if err != nil {
+			continue
+		}
+		first[path] = index
+		files = append(files, path)
+	}
+	slices.SortFunc(files, func(a, b string) int { return cmp.Compare(first[a], first[b]) })
+	return files, nil
+}
+
+// startReplay processes the entries of logs, one goroutine per log, with
+// the same parsing, filters and output as a monitor's. wg counts the
+// goroutines, like those of the monitors; the returned channel is closed
+// once every log was replayed, or stopped by done.
+func startReplay(sh *shared, logs []replayLog, wg *sync.WaitGroup, done <-chan struct{}) <-chan struct{} {
+	finished := make(chan struct{})
+	var replays sync.WaitGroup
+	for _, l := range logs {
+		wg.Add(1)
+		replays.Add(1)
+		go func() {
+			defer wg.Done()
+			defer replays.Done()
+			replayArchivedLog(sh, l, done)
+		}()
+	}
+	go func() {
+		replays.Wait()
+		close(finished)
+	}()
+	return finished
+}
+
+// replayArchivedLog processes the archived entries of l, file by file.
+func replayArchivedLog(sh *shared, l replayLog, done <-chan struct{}) {
+	cfg := sh.cfg.forLog(l.operator, l.logInfo)
+	filters := sh.filters
+	if cfg != sh.cfg {
+		filters = buildFilters(cfg)
+		log.Printf("Using the -log-filters overrides for %s", l.logInfo.Description)
+	}
+	// Archived entries were detected long ago: their detection latency is
+	// not measured.
+	proc := &entryProcessor{sh: sh, cfg: cfg, filters: filters, logInfo: &l.logInfo, operator: l.operator,
+		warnings: newWarnCoalescer(cfg.WarnInterval), liveFrom: math.MaxInt64}
+
+	files, err := archiveFiles(l.dir)
+	if err != nil {
+		log.Printf("Failed to read the archive of %s: %v", l.logInfo.Description, err)
+		return
+	}
+	log.Printf("Replaying %d archive files of %s", len(files), l.logInfo.Description)
+	var replayed int64
+	for _, path := range files {
+		n, err := replayArchiveFile(proc, path, done)
+		replayed += n
+		proc.flush()
+		proc.warnings.flush(time.Now())
+		if sh.idle != nil && n > 0 {
+			sh.idle.touch(time.Now())
+		}
+		if err != nil {
+			log.Printf("Failed to replay %s, continuing with the next file: %v", path, err)
+		}
+		select {
+		case <-done:
+			log.Printf("Stopped replaying %s after %d entries", l.logInfo.Description, replayed)
+			return
+		default:
+		}
+	}
+	log.Printf("Replayed %d entries of %s", replayed, l.logInfo.Description)
+}
+
+// replayArchiveFile processes the entries of the archive file at path,
+// each index once, and returns how many it processed. A file cut short, as
+// by a crash while it was written, is replayed up to where it ends.
+func replayArchiveFile(proc *entryProcessor, path string, done <-chan struct{}) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(bufio.NewReader(f))
+	if err != nil {
+		return 0, err
+	}
+	r := bufio.NewReader(zr)
+	// Entries fetched more than once were archived more than once.
+	seen := make(map[int64]bool)
+	var n int64
+	for {
+		select {
+		case <-done:
+			return n, nil
+		default:
+		}
+		line, err := r.ReadBytes('\n')
+		// A line without its newline was cut short.
+		if len(line) > 0 && line[len(line)-1] == '\n' {
+			var archived archivedEntry
+			if err := json.Unmarshal(line, &archived); err != nil {
+				return n, fmt.Errorf("failed to parse archived entry: %w", err)
+			}
+			if seen[archived.Index] {
+				continue
+			}
+			seen[archived.Index] = true
+			leaf := ct.LeafEntry{LeafInput: archived.LeafInput, ExtraData: archived.ExtraData}
+			entry, err := newLogEntry(archived.Index, &leaf, proc.cfg.MaxEntrySize, proc.cfg.sampleEntry)
+			if err != nil {
+				proc.warnings.warn("Failed to parse an archived entry of "+proc.logInfo.Description, err, time.Now())
+				metrics.count(metricParseErrors, 1, proc.logInfo.Description)
+				continue
+			}
+			proc.process(&entry, archived.Index)
+			n++
+		}
+		switch {
+		case err == io.EOF:
+			return n, nil
+		case errors.Is(err, io.ErrUnexpectedEOF):
+			return n, fmt.Errorf("the file ends early, replayed up to its last complete entry")
+		case err != nil:
+			return n, err
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// resolveMaxNames is how many names of a certificate -resolve looks up.
+	resolveMaxNames = 10
+	// resolveQueue is how many certificates may wait for a lookup; beyond
+	// it, certificates are not looked up rather than hold up the monitors.
+	resolveQueue = 1024
+	// resolveTimeout bounds a single lookup.
+	resolveTimeout = 5 * time.Second
+	// Lookups are cached for resolveCacheTTL, up to resolveCacheSize names.
+	resolveCacheTTL  = 10 * time.Minute
+	resolveCacheSize = 10000
+)
+
+// nameResolver looks up in DNS the names of the certificates certtail
+// prints, for -resolve, and prints whether each currently resolves, and to
+// which addresses, on a line of its own once the lookups are done. Lookups
+// run in the background on a bounded pool of workers, so that a slow
+// resolver never holds up the monitors.
+type nameResolver struct {
+	dropped atomic.Uint64
+
+	// queueMu guards queue against enqueue after close.
+	queueMu sync.RWMutex
+	queue   chan resolveRequest
+	closed  bool
+	workers sync.WaitGroup
+
+	mu    sync.Mutex
+	cache map[string]resolveResult
+}
+
+type resolveRequest struct {
+	names []string
+	log   string
+}
+
+type resolveResult struct {
+	addrs   []string
+	err     string // why the name does not resolve; empty if it does
+	expires time.Time
+}
+
+// newNameResolver starts concurrency workers, which run until close.
+func newNameResolver(concurrency int) *nameResolver {
+	r := &nameResolver{queue: make(chan resolveRequest, resolveQueue), cache: make(map[string]resolveResult)}
+	for range concurrency {
+		r.workers.Add(1)
+		go func() {
+			defer r.workers.Done()
+			for req := range r.queue {
+				r.resolve(req)
+			}
+		}()
+	}
+	return r
+}
+
+// close stops taking lookups; the returned channel is closed once the
+// queued ones are done.
+func (r *nameResolver) close() <-chan struct{} {
+	r.queueMu.Lock()
+	if !r.closed {
+		r.closed = true
+		close(r.queue)
+	}
+	r.queueMu.Unlock()
+	finished := make(chan struct{})
+	go func() {
+		r.workers.Wait()
+		close(finished)
+	}()
+	return finished
+}
+
+// enqueue schedules the lookup of ev's names, unless the queue is full.
+func (r *nameResolver) enqueue(cfg *config, ev *certEvent) {
+	names := eventNames(cfg, ev)
+	if len(names) > resolveMaxNames {
+		names = names[:resolveMaxNames]
+	}
+	if len(names) == 0 {
+		return
+	}
+	r.queueMu.RLock()
+	defer r.queueMu.RUnlock()
+	if r.closed {
+		return
+	}
+	select {
+	case r.queue <- resolveRequest{names: names, log: ev.Log.Description}:
+	default:
+		if r.dropped.Add(1) == 1 {
+			log.Printf("Warning: -resolve cannot keep up, skipping the lookup of some certificates' names")
+		}
+	}
+}
+
+// resolve looks up the names of req and writes the result line to stdout,
+// such as
+//
+//	Resolved: www.example.com -> 192.0.2.1, 2001:db8::1; dev.example.com -> not found, Log: ...
+func (r *nameResolver) resolve(req resolveRequest) {
+	var buf bytes.Buffer
+	buf.WriteString("Resolved: ")
+	for i, name := range req.names {
+		if i > 0 {
+			buf.WriteString("; ")
+		}
+		buf.WriteString(name)
+		buf.WriteString(" -> ")
+		if strings.HasPrefix(name, "*.") {
+			buf.WriteString("wildcard, not looked up")
+			continue
+		}
+		res := r.lookup(name)
+		if res.err != "" {
+			buf.WriteString(res.err)
+		} else {
+			buf.WriteString(strings.Join(res.addrs, ", "))
+		}
+	}
+	buf.WriteString(", Log: ")
+	buf.WriteString(req.log)
+	buf.WriteByte('\n')
+	if _, err := stdout.Write(buf.Bytes()); err != nil {
+		log.Printf("Failed to write output: %v", err)
+	}
+}
+
+// lookup resolves name, from the cache when it was looked up recently.
+func (r *nameResolver) lookup(name string) resolveResult {
+	now := time.Now()
+	r.mu.Lock()
+	res, ok := r.cache[name]
+	r.mu.Unlock()
+	if ok && now.Before(res.expires) {
+		return res
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupHost(ctx, name)
+	res = resolveResult{addrs: addrs, expires: now.Add(resolveCacheTTL)}
+	var dnsErr *net.DNSError
+	switch {
+	case err == nil:
+	case errors.As(err, &dnsErr) && dnsErr.IsNotFound:
+		res.err = "not found"
+	case errors.As(err, &dnsErr) && dnsErr.IsTimeout:
+		res.err = "timed out"
+	default:
+		res.err = "lookup failed"
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.cache) >= resolveCacheSize {
+		for cached, old := range r.cache {
+			if now.After(old.expires) {
+				delete(r.cache, cached)
+			}
+		}
+		if len(r.cache) >= resolveCacheSize {
+			clear(r.cache)
+		}
+	}
+	r.cache[name] = res
+	return res
+}
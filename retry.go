@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/certificate-transparency-go/jsonclient"
+)
+
+// Backoff between polls of a log that answers 429 or 5xx.
+const (
+	pollBackoffMin = time.Second
+	pollBackoffMax = 5 * time.Minute
+)
+
+// retryAfterTransport remembers the Retry-After deadline announced by the
+// most recent rate-limited (429) or unavailable (503) response. The CT
+// client only surfaces the status code and body of a failed GET, so the
+// header has to be captured at the transport level.
+type retryAfterTransport struct {
+	base http.RoundTripper
+
+	mu    sync.Mutex
+	until time.Time
+}
+
+func newRetryAfterTransport(base http.RoundTripper) *retryAfterTransport {
+	return &retryAfterTransport{base: base}
+}
+
+func (t *retryAfterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		if d, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+			t.mu.Lock()
+			t.until = time.Now().Add(d)
+			t.mu.Unlock()
+		}
+	}
+	return resp, nil
+}
+
+// retryAfter returns how long the server asked us to wait, or zero if no
+// Retry-After is in effect.
+func (t *retryAfterTransport) retryAfter() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if d := time.Until(t.until); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// parseRetryAfter parses a Retry-After header value, which is either a
+// number of seconds or an HTTP date.
+func parseRetryAfter(v string, now time.Time) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// isRateLimited reports whether err is a CT client error for an HTTP 429
+// response.
+func isRateLimited(err error) bool {
+	var rspErr jsonclient.RspError
+	if errors.As(err, &rspErr) {
+		return rspErr.StatusCode == http.StatusTooManyRequests
+	}
+	return false
+}
+
+// isOverloaded reports whether err is a CT client error for an HTTP 429 or
+// 5xx response: the log is struggling, and hitting it again straight away
+// only makes that worse.
+func isOverloaded(err error) bool {
+	var rspErr jsonclient.RspError
+	if errors.As(err, &rspErr) {
+		return rspErr.StatusCode == http.StatusTooManyRequests || rspErr.StatusCode >= 500
+	}
+	return false
+}
+
+// pollBackoff returns how long to wait after the failures'th poll in a row
+// that a log answered with 429 or 5xx: exponential from pollBackoffMin up
+// to pollBackoffMax, with jitter so that monitors of logs behind the same
+// frontend do not retry in lockstep.
+func pollBackoff(failures int) time.Duration {
+	d := pollBackoffMin
+	for i := 1; i < failures && d < pollBackoffMax; i++ {
+		d *= 2
+	}
+	d = min(d, pollBackoffMax)
+	return d/2 + rand.N(d/2+1)
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPollBackoffBounds(t *testing.T) {
+	tests := []struct {
+		failures int
+		max      time.Duration // before jitter, which takes off up to half
+	}{
+		{0, time.Second},
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{9, 256 * time.Second},
+		{10, pollBackoffMax},
+		{1000, pollBackoffMax},
+	}
+	for _, tt := range tests {
+		seen := make(map[time.Duration]bool)
+		for range 200 {
+			d := pollBackoff(tt.failures)
+			if d < tt.max/2 || d > tt.max {
+				t.Fatalf("pollBackoff(%d) = %s, want between %s and %s", tt.failures, d, tt.max/2, tt.max)
+			}
+			seen[d] = true
+		}
+		if len(seen) < 2 {
+			t.Errorf("pollBackoff(%d) returned %d distinct durations in 200 calls, want jitter", tt.failures, len(seen))
+		}
+	}
+}
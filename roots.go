@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/google/certificate-transparency-go/x509"
+)
+
+// listRoots prints the root certificates each log accepts, according to its
+// get-roots endpoint: the CAs whose certificates can appear in the log at
+// all. It returns the process exit code: 1 if any log could not be queried.
+func listRoots(cfg *config, logs []LogInfo) int {
+	code := 0
+	for _, logInfo := range logs {
+		logClient, _, err := newLogClient(cfg, logInfo)
+		if err != nil {
+			fmt.Printf("%s: %v\n\n", logInfo.Description, err)
+			code = 1
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+		roots, err := logClient.GetAcceptedRoots(ctx)
+		cancel()
+		if err != nil {
+			fmt.Printf("%s: failed to get roots: %v\n\n", logInfo.Description, err)
+			code = 1
+			continue
+		}
+
+		subjects := make([]string, 0, len(roots))
+		for _, root := range roots {
+			cert, err := x509.ParseCertificate(root.Data)
+			if x509.IsFatal(err) {
+				subjects = append(subjects, fmt.Sprintf("(unparseable: %v)", err))
+				continue
+			}
+			subjects = append(subjects, cert.Subject.String())
+		}
+		sort.Strings(subjects)
+		fmt.Printf("%s: %d roots\n", logInfo.Description, len(roots))
+		for _, subject := range subjects {
+			fmt.Printf("  %s\n", subject)
+		}
+		fmt.Println()
+	}
+	return code
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/base64"
+	"sync/atomic"
+
+	ct "github.com/google/certificate-transparency-go"
+	"github.com/google/certificate-transparency-go/tls"
+	"github.com/google/certificate-transparency-go/x509"
+)
+
+// embeddedSCTLogIDs returns the base64 IDs (as in the log list's log_id) of
+// the logs that issued the SCTs embedded in cert, i.e. the logs its
+// precertificate was submitted to. SCTs that fail to parse are skipped.
+func embeddedSCTLogIDs(cert *x509.Certificate) []string {
+	var ids []string
+	for _, serialized := range cert.SCTList.SCTList {
+		var sct ct.SignedCertificateTimestamp
+		if rest, err := tls.Unmarshal(serialized.Val, &sct); err != nil || len(rest) > 0 {
+			continue
+		}
+		ids = append(ids, base64.StdEncoding.EncodeToString(sct.LogID.KeyID[:]))
+	}
+	return ids
+}
+
+// logDescriptions maps the log IDs of every log in list to its
+// description, for naming the logs of embedded SCTs.
+func logDescriptions(list *LogList) map[string]string {
+	m := make(map[string]string)
+	for _, op := range list.Operators {
+		for _, l := range op.Logs {
+			if id := l.id(); id != "" {
+				m[id] = l.Description
+			}
+		}
+	}
+	return m
+}
+
+// logNameTable holds the log descriptions of logDescriptions, replaced
+// whenever the log list is fetched again while monitors read it.
+type logNameTable struct {
+	names atomic.Pointer[map[string]string]
+}
+
+func newLogNameTable(list *LogList) *logNameTable {
+	t := &logNameTable{}
+	t.set(list)
+	return t
+}
+
+// set replaces the descriptions with those of list.
+func (t *logNameTable) set(list *LogList) {
+	names := logDescriptions(list)
+	t.names.Store(&names)
+}
+
+// lookup returns the description of the log with the given ID. A nil
+// table knows no logs.
+func (t *logNameTable) lookup(id string) (string, bool) {
+	if t == nil {
+		return "", false
+	}
+	name, ok := (*t.names.Load())[id]
+	return name, ok
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/certificate-transparency-go/x509"
+)
+
+// serialTracker spots CAs reusing a serial number for different
+// certificates, which RFC 5280 forbids. It maps (issuer, serial) to the
+// fingerprint of the certificate first seen with them, remembering the most
+// recent size pairs. Precertificates are tracked separately from final
+// certificates, as a precertificate and its final certificate legitimately
+// share a serial.
+type serialTracker struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List // of *serialEntry, most recently seen first
+	entries map[fingerprint]*list.Element
+	dirty   bool
+}
+
+type serialEntry struct {
+	key  fingerprint // of issuer, serial and entry type
+	cert fingerprint // of the certificate
+}
+
+func newSerialTracker(size int) *serialTracker {
+	return &serialTracker{size: size, order: list.New(), entries: make(map[fingerprint]*list.Element)}
+}
+
+func serialKey(cert *x509.Certificate, precert bool) fingerprint {
+	h := sha256.New()
+	h.Write(cert.RawIssuer)
+	h.Write([]byte{0})
+	if cert.SerialNumber != nil {
+		h.Write(cert.SerialNumber.Bytes())
+	}
+	if precert {
+		h.Write([]byte("precert"))
+	}
+	return fingerprint(h.Sum(nil))
+}
+
+// check records cert and reports whether a different certificate with the
+// same issuer and serial was seen before, returning that certificate's
+// fingerprint.
+func (t *serialTracker) check(cert *x509.Certificate, precert bool) (previous fingerprint, reused bool) {
+	key := serialKey(cert, precert)
+	fp := fingerprint(sha256.Sum256(cert.Raw))
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if elem, ok := t.entries[key]; ok {
+		t.order.MoveToFront(elem)
+		entry := elem.Value.(*serialEntry)
+		return entry.cert, entry.cert != fp
+	}
+	t.add(&serialEntry{key: key, cert: fp})
+	t.dirty = true
+	return fingerprint{}, false
+}
+
+// add inserts entry as the most recently seen. t.mu must be held.
+func (t *serialTracker) add(entry *serialEntry) {
+	t.entries[entry.key] = t.order.PushFront(entry)
+	if t.order.Len() > t.size {
+		oldest := t.order.Back()
+		t.order.Remove(oldest)
+		delete(t.entries, oldest.Value.(*serialEntry).key)
+	}
+}
+
+// writeSerialAlert appends the alert line for a reused serial.
+func writeSerialAlert(buf *bytes.Buffer, cfg *config, ev *certEvent, previous fingerprint) {
+	buf.WriteString("Alert: ")
+	startColor(buf, cfg, ansiRed)
+	buf.WriteString("serial ")
+	buf.WriteString(formatSerial(ev.Cert))
+	buf.WriteString(" reused by ")
+	buf.WriteString(ev.Cert.Issuer.String())
+	endColor(buf, cfg)
+	buf.WriteString(", Names: ")
+	writeLimitedNames(buf, cfg, normalizeNames(cfg, certNames(ev.Cert)))
+	buf.WriteString(", Previous SHA-256: ")
+	buf.WriteString(hex.EncodeToString(previous[:]))
+	buf.WriteString(", Log: ")
+	buf.WriteString(ev.Log.Description)
+	buf.WriteByte('\n')
+}
+
+// serialFileEntry is how a tracked pair is stored in -serial-reuse-file.
+type serialFileEntry struct {
+	Key  string `json:"key"`
+	Cert string `json:"cert"`
+}
+
+// load reads pairs saved by save from path; a missing file is not an error.
+func (t *serialTracker) load(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var saved []serialFileEntry
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, s := range saved { // oldest first
+		key, ok1 := decodeFingerprint(s.Key)
+		cert, ok2 := decodeFingerprint(s.Cert)
+		if !ok1 || !ok2 {
+			continue
+		}
+		entry := serialEntry{key: key, cert: cert}
+		t.add(&entry)
+	}
+	return nil
+}
+
+func decodeFingerprint(s string) (fingerprint, bool) {
+	var fp fingerprint
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != len(fp) {
+		return fp, false
+	}
+	copy(fp[:], b)
+	return fp, true
+}
+
+// save writes the tracked pairs to path if they changed since the last
+// save.
+func (t *serialTracker) save(path string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.dirty {
+		return nil
+	}
+	saved := make([]serialFileEntry, 0, t.order.Len())
+	for elem := t.order.Back(); elem != nil; elem = elem.Prev() {
+		entry := elem.Value.(*serialEntry)
+		saved = append(saved, serialFileEntry{Key: hex.EncodeToString(entry.key[:]), Cert: hex.EncodeToString(entry.cert[:])})
+	}
+	data, err := json.Marshal(saved)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		return err
+	}
+	t.dirty = false
+	return nil
+}
+
+// saveEvery saves the tracked pairs to path every interval until done is
+// closed.
+func (t *serialTracker) saveEvery(path string, interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := t.save(path); err != nil {
+				log.Printf("Failed to save serial numbers: %v", err)
+			}
+		case <-done:
+			return
+		}
+	}
+}
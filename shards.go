@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxCertLifetime is the longest validity period publicly-trusted
+// certificates may have (CA/Browser Forum baseline requirements).
+const maxCertLifetime = 398 * 24 * time.Hour
+
+// TemporalInterval is the range of certificate expiry (notAfter) dates a
+// sharded log accepts.
+type TemporalInterval struct {
+	StartInclusive time.Time `json:"start_inclusive"`
+	EndExclusive   time.Time `json:"end_exclusive"`
+}
+
+// mayContain reports whether the log can hold certificates that were logged
+// between from and to. A certificate logged at time t expires somewhere in
+// (t, t+maxCertLifetime], so a shard is relevant when its interval overlaps
+// (from, to+maxCertLifetime]. Logs without a temporal interval accept
+// everything.
+func (l LogInfo) mayContain(from, to time.Time) bool {
+	if l.TemporalInterval == nil {
+		return true
+	}
+	return l.TemporalInterval.EndExclusive.After(from) &&
+		l.TemporalInterval.StartInclusive.Before(to.Add(maxCertLifetime))
+}
+
+// selectShards returns the logs that can contain certificates logged between
+// from and to, and the shards that were left out.
+func selectShards(logs []LogInfo, from, to time.Time) (selected, skipped []LogInfo) {
+	for _, logInfo := range logs {
+		if logInfo.mayContain(from, to) {
+			selected = append(selected, logInfo)
+		} else {
+			skipped = append(skipped, logInfo)
+		}
+	}
+	return selected, skipped
+}
+
+// shardRecheckInterval is how often -current-shard looks for a new shard
+// when none of the monitored logs has a temporal interval still running.
+const shardRecheckInterval = 24 * time.Hour
+
+// selectCurrentShard returns, for -current-shard, the logs whose temporal
+// interval contains now, along with the logs without one, and the shards
+// that were left out.
+func selectCurrentShard(logs []LogInfo, now time.Time) (selected, skipped []LogInfo) {
+	for _, logInfo := range logs {
+		if ti := logInfo.TemporalInterval; ti == nil || !now.Before(ti.StartInclusive) && now.Before(ti.EndExclusive) {
+			selected = append(selected, logInfo)
+		} else {
+			skipped = append(skipped, logInfo)
+		}
+	}
+	return selected, skipped
+}
+
+// untilShardBoundary returns how long until the first of the temporal
+// intervals of logs ends after now, when -current-shard moves on to the next
+// shard, or shardRecheckInterval when none does.
+func untilShardBoundary(logs []LogInfo, now time.Time) time.Duration {
+	var next time.Time
+	for _, logInfo := range logs {
+		if ti := logInfo.TemporalInterval; ti != nil && ti.EndExclusive.After(now) && (next.IsZero() || ti.EndExclusive.Before(next)) {
+			next = ti.EndExclusive
+		}
+	}
+	if next.IsZero() {
+		return shardRecheckInterval
+	}
+	// The interval's end is exclusive: wake up just past it.
+	return next.Sub(now) + time.Second
+}
+
+// planRollover adjusts the shard selection of an operator's logs for
+// positions saved by a previous run, so that yearly (or half-yearly) shard
+// rollover loses no entries. Skipped shards with a saved position are
+// monitored anyway, so that an old shard is drained to its end. A selected
+// shard without a saved position whose predecessor in the temporal series
+// (the shard whose interval ends where it starts) has one appeared since the
+// last run, and is returned in fromStart to be read from its first entry
+// rather than from its current end.
+func planRollover(selected, skipped []LogInfo, state *stateStore) (monitor []LogInfo, fromStart map[string]bool) {
+	monitor = selected
+	fromStart = make(map[string]bool)
+	saved := func(l LogInfo) bool {
+		_, ok := state.get(l.URL)
+		return ok
+	}
+	for _, l := range skipped {
+		if saved(l) {
+			monitor = append(monitor, l)
+		}
+	}
+	all := append(append([]LogInfo(nil), selected...), skipped...)
+	for _, l := range selected {
+		if l.TemporalInterval == nil || saved(l) {
+			continue
+		}
+		for _, prev := range all {
+			if prev.TemporalInterval != nil && prev.TemporalInterval.EndExclusive.Equal(l.TemporalInterval.StartInclusive) && saved(prev) {
+				fromStart[l.URL] = true
+			}
+		}
+	}
+	return monitor, fromStart
+}
+
+// findIndexByTime returns the index of the first entry in a log of the given
+// tree size whose timestamp is at or after t, using a binary search over
+// single-entry fetches. Entry timestamps are only roughly ordered (within the
+// log's merge delay), which is accurate enough for choosing a start point.
+func findIndexByTime(ctx context.Context, logClient ctLog, treeSize uint64, t time.Time) (int64, error) {
+	lo, hi := int64(0), int64(treeSize)
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		// Only the entry's timestamp is needed, not its certificate.
+		entries, err := fetchRange(ctx, logClient, mid, mid+1, 0, func(entryType) bool { return false }, nil)
+		if err != nil {
+			return 0, fmt.Errorf("failed to get entry %d: %w", mid, err)
+		}
+		if entries[0].Timestamp.Before(t) {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	return lo, nil
+}
+
+// parseDuration is time.ParseDuration with support for a "d" (day) suffix,
+// e.g. "60d".
+func parseDuration(v string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(v, "d"); ok {
+		n, err := strconv.ParseFloat(days, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", v)
+		}
+		return time.Duration(n * float64(24*time.Hour)), nil
+	}
+	return time.ParseDuration(v)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	ct "github.com/google/certificate-transparency-go"
+)
+
+// showState prints the positions saved in the state file, for -show-state:
+// per log, the saved index, how far it is behind the log's current tree
+// size and when it was saved. Logs are looked up in the log list by URL;
+// those no longer in it are shown by URL. It returns the process exit
+// code: 1 if any log's tree head could not be fetched.
+func showState(cfg *config, logList *LogList, state *stateStore) int {
+	byURL := make(map[string]LogInfo)
+	for _, op := range logList.Operators {
+		for _, l := range op.Logs {
+			byURL[strings.TrimSuffix(l.URL, "/")] = l
+		}
+	}
+	state.mu.Lock()
+	saved := make(map[string]logState, len(state.logs))
+	urls := make([]string, 0, len(state.logs))
+	for url, st := range state.logs {
+		if !st.hasPosition() {
+			continue // only a verified tree head
+		}
+		saved[url] = st
+		urls = append(urls, url)
+	}
+	state.mu.Unlock()
+	if len(urls) == 0 {
+		fmt.Printf("%s holds no saved positions\n", cfg.StateFile)
+		return 0
+	}
+
+	logs := make([]LogInfo, len(urls))
+	for i, url := range urls {
+		l, ok := byURL[strings.TrimSuffix(url, "/")]
+		if !ok {
+			l = LogInfo{URL: url, Description: url}
+		}
+		logs[i] = l
+	}
+	sort.Slice(logs, func(i, j int) bool { return logs[i].Description < logs[j].Description })
+
+	type result struct {
+		sth *ct.SignedTreeHead
+		err error
+	}
+	results := make([]chan result, len(logs))
+	for i, logInfo := range logs {
+		results[i] = make(chan result, 1)
+		go func() {
+			logClient, _, err := newMonitorClient(cfg, logInfo)
+			if err != nil {
+				results[i] <- result{err: err}
+				return
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+			defer cancel()
+			sth, err := logClient.GetSTH(ctx)
+			results[i] <- result{sth, err}
+		}()
+	}
+
+	now := time.Now()
+	code := 0
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "LOG\tNEXT INDEX\tSAVED\tSAVED AGO\tTREE SIZE\tBEHIND")
+	for i, logInfo := range logs {
+		st := saved[logInfo.URL]
+		savedAt, ago := "-", "-"
+		if !st.Updated.IsZero() {
+			savedAt = st.Updated.UTC().Format(time.RFC3339)
+			ago = now.Sub(st.Updated).Truncate(time.Second).String()
+		}
+		r := <-results[i]
+		if r.err != nil {
+			fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t-\terror: %v\n", logInfo.Description, st.NextIndex, savedAt, ago, r.err)
+			code = 1
+			continue
+		}
+		behind := fmt.Sprint(int64(r.sth.TreeSize) - st.NextIndex)
+		if st.NextIndex > int64(r.sth.TreeSize) {
+			behind = "beyond the tree"
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%d\t%s\n", logInfo.Description, st.NextIndex, savedAt, ago, r.sth.TreeSize, behind)
+	}
+	tw.Flush()
+	return code
+}
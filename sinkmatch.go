@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/artooro/certtail/match"
+)
+
+// sinkConfigured reports, for each sink -sink-match can name, whether the
+// sink is enabled.
+var sinkConfigured = map[string]func(cfg *config) bool{
+	"syslog":        func(cfg *config) bool { return cfg.Syslog != "" },
+	"cert-dir":      func(cfg *config) bool { return cfg.CertDir != "" },
+	"digest":        func(cfg *config) bool { return cfg.Digest != "" },
+	"nats":          func(cfg *config) bool { return cfg.NATSURL != "" },
+	"exec":          func(cfg *config) bool { return cfg.Exec != "" },
+	"elasticsearch": func(cfg *config) bool { return cfg.ESURL != "" },
+	"object-store":  func(cfg *config) bool { return cfg.ObjectStore != "" },
+	"proto-out":     func(cfg *config) bool { return cfg.ProtoOut != "" },
+	"grpc":          func(cfg *config) bool { return cfg.GRPCAddr != "" },
+	"webhook":       func(cfg *config) bool { return cfg.Webhook != "" },
+}
+
+// sinkMatchList is the repeatable -sink-match flag: a sink name and a name
+// regexp, as sink=regexp. Only events for a name matching its regexp reach
+// the sink.
+type sinkMatchList map[string]*regexp.Regexp
+
+func (l *sinkMatchList) String() string {
+	if l == nil {
+		return ""
+	}
+	var parts []string
+	for _, sink := range slices.Sorted(maps.Keys(*l)) {
+		parts = append(parts, sink+"="+(*l)[sink].String())
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (l *sinkMatchList) Set(v string) error {
+	sink, pattern, ok := strings.Cut(v, "=")
+	if !ok {
+		return fmt.Errorf("%q is not sink=regexp", v)
+	}
+	sink = strings.TrimSpace(sink)
+	if _, known := sinkConfigured[sink]; !known {
+		return fmt.Errorf("unknown sink %q (want one of %s)", sink, strings.Join(slices.Sorted(maps.Keys(sinkConfigured)), ", "))
+	}
+	if _, dup := (*l)[sink]; dup {
+		return fmt.Errorf("-sink-match given twice for %s", sink)
+	}
+	re, err := match.CompileRegexp(pattern)
+	if err != nil {
+		return err
+	}
+	if *l == nil {
+		*l = make(sinkMatchList)
+	}
+	(*l)[sink] = re
+	return nil
+}
+
+// matcher returns the predicate selecting the events for sink, or nil when
+// it gets them all. An event passes when one of the names it is for matches,
+// so that an -explode-names event only passes for a matching name.
+func (l sinkMatchList) matcher(cfg *config, sink string) func(*certEvent) bool {
+	re := l[sink]
+	if re == nil {
+		return nil
+	}
+	return func(ev *certEvent) bool {
+		return slices.ContainsFunc(eventNames(cfg, ev), re.MatchString)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/google/certificate-transparency-go/x509"
+)
+
+func TestSinkMatchRouting(t *testing.T) {
+	cfg, _, err := parseTestFlags(t, "-exec=true", "-webhook=https://hooks.example.com/ct",
+		`-sink-match=exec=(^|\.)example\.com$`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := newBroadcaster()
+	execSub := events.subscribeMatching(8, overflowDropNewest, cfg.SinkMatch.matcher(cfg, "exec"))
+	webhookSub := events.subscribeMatching(8, overflowDropNewest, cfg.SinkMatch.matcher(cfg, "webhook"))
+	for _, names := range [][]string{
+		{"www.example.com"},
+		{"www.example.org"},
+		{"mail.example.org", "example.com"},
+		{"example.com.evil.net"},
+	} {
+		events.publish(&certEvent{Cert: &x509.Certificate{DNSNames: names}})
+	}
+	events.close()
+
+	received := func(sub *subscription) []string {
+		var got []string
+		for ev := range sub.C {
+			got = append(got, strings.Join(ev.Cert.DNSNames, " "))
+		}
+		return got
+	}
+	// An event reaches a sink when one of its names matches.
+	if got, want := received(execSub), []string{"www.example.com", "mail.example.org example.com"}; !slices.Equal(got, want) {
+		t.Errorf("exec sink got %q, want %q", got, want)
+	}
+	if got := received(webhookSub); len(got) != 4 {
+		t.Errorf("webhook sink, without -sink-match, got %q, want every event", got)
+	}
+}
+
+func TestSinkMatchExplodedNames(t *testing.T) {
+	cfg, _, err := parseTestFlags(t, "-exec=true", "-explode-names", `-sink-match=exec=(^|\.)example\.com$`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	matches := cfg.SinkMatch.matcher(cfg, "exec")
+	cert := &x509.Certificate{DNSNames: []string{"mail.example.org", "example.com"}}
+	for _, ev := range explodeNames(cfg, &certEvent{Cert: cert}) {
+		if got, want := matches(ev), ev.Name == "example.com"; got != want {
+			t.Errorf("event for %s passes: %v, want %v", ev.Name, got, want)
+		}
+	}
+}
+
+func TestSinkMatchErrors(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-exec=true", "-sink-match=exec"}, "is not sink=regexp"},
+		{[]string{"-exec=true", "-sink-match=printer=x"}, `unknown sink "printer"`},
+		{[]string{"-exec=true", "-sink-match=exec=a", "-sink-match=exec=b"}, "given twice for exec"},
+		{[]string{"-exec=true", "-sink-match=exec=*.example.com"}, "not a glob"},
+		{[]string{"-sink-match=webhook=x"}, "the webhook sink, which is not enabled"},
+	}
+	for _, tt := range tests {
+		_, _, err := parseTestFlags(t, tt.args...)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%q: error = %v, want one containing %q", tt.args, err, tt.want)
+		}
+	}
+}
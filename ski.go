@@ -0,0 +1,82 @@
+package main
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/google/certificate-transparency-go/x509"
+)
+
+// subjectKeyID returns cert's subject key identifier: the one in its
+// extension, or for certificates without one (many CAs leave it out of
+// end-entity certificates), the SHA-1 hash of the public key that RFC 5280
+// section 4.2.1.2 describes and most CAs use.
+func subjectKeyID(cert *x509.Certificate) []byte {
+	if len(cert.SubjectKeyId) > 0 {
+		return cert.SubjectKeyId
+	}
+	key := publicKeyBits(cert)
+	if key == nil {
+		return nil
+	}
+	sum := sha1.Sum(key)
+	return sum[:]
+}
+
+// publicKeyBits returns the subjectPublicKey bit string of cert, which
+// key identifiers are computed from.
+func publicKeyBits(cert *x509.Certificate) []byte {
+	var spki struct {
+		Algorithm asn1.RawValue
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(cert.RawSubjectPublicKeyInfo, &spki); err != nil {
+		return nil
+	}
+	return spki.PublicKey.Bytes
+}
+
+// keyIDList is a repeatable flag of hex subject key identifiers, with or
+// without colons, stored in lower-case hex without them.
+type keyIDList []string
+
+func (l *keyIDList) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, ", ")
+}
+
+func (l *keyIDList) Set(v string) error {
+	keyID, err := hex.DecodeString(strings.ReplaceAll(strings.TrimSpace(v), ":", ""))
+	if err != nil || len(keyID) == 0 {
+		return fmt.Errorf("%q is not a hex key identifier", v)
+	}
+	*l = append(*l, hex.EncodeToString(keyID))
+	return nil
+}
+
+// matches reports whether cert's subject key identifier is in the list.
+// For a certificate without one, the identifier its key would have is
+// computed both ways in use: the SHA-1 hash of RFC 5280 and the truncated
+// SHA-256 hash of RFC 7093.
+func (l keyIDList) matches(cert *x509.Certificate) bool {
+	skis := []string{hex.EncodeToString(subjectKeyID(cert))}
+	if len(cert.SubjectKeyId) == 0 {
+		if key := publicKeyBits(cert); key != nil {
+			sum := sha256.Sum256(key)
+			skis = append(skis, hex.EncodeToString(sum[:sha1.Size]))
+		}
+	}
+	for _, keyID := range l {
+		if slices.Contains(skis, keyID) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Backoff between -no-fatal retries of a failed startup step.
+const (
+	startupRetryMin = 10 * time.Second
+	startupRetryMax = 5 * time.Minute
+)
+
+// startupStep runs a step needed before monitoring can start. If it fails
+// certtail exits, unless -no-fatal is set: then the error is logged and the
+// step retried with exponential backoff until it succeeds, so that a
+// transient failure (the log list being unreachable, say) does not need an
+// external restart. An interrupt while waiting exits.
+func startupStep(cfg *config, what string, step func() error) {
+	err := step()
+	if err == nil {
+		return
+	}
+	if !cfg.NoFatal {
+		fatal(errorCode(err, errCodeStartup), "Failed to %s: %v", what, err)
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt)
+	defer signal.Stop(sigChan)
+	wait := startupRetryMin
+	for err != nil {
+		log.Printf("Failed to %s, retrying in %s: %v", what, wait, err)
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-sigChan:
+			timer.Stop()
+			fatal(errorCode(err, errCodeStartup), "Interrupted while retrying to %s: %v", what, err)
+		}
+		wait = min(2*wait, startupRetryMax)
+		err = step()
+	}
+}
+
+// getConfiguredLogList fetches the log list given by -log-lists or
+// -log-list.
+func getConfiguredLogList(cfg *config) (*LogList, error) {
+	var logList *LogList
+	var err error
+	if len(cfg.LogListURLs) > 0 {
+		logList, err = getLogLists(cfg.LogListURLs)
+	} else {
+		logList, err = getLogList(cfg.LogListURL)
+	}
+	return logList, withCode(errCodeLogListFetch, err)
+}
+
+// selectOperatorLogs returns the logs to monitor of the operators named by
+// -operator, with the operator of each by log URL and the URLs of new
+// shards to read from the start (see planRollover). Operators missing from
+// the log list are warned about, as long as one of them is found. Logs that
+// are read-only, retired or rejected never grow and are left out, unless
+// picked by ID or still being drained.
+func selectOperatorLogs(cfg *config, logList *LogList, state *stateStore) (map[string]*Operator, []LogInfo, map[string]bool, error) {
+	var operators []*Operator
+	var missing []string
+	for _, name := range operatorNames(cfg.Operator) {
+		if strings.EqualFold(name, allOperators) {
+			for i := range logList.Operators {
+				if !slices.Contains(operators, &logList.Operators[i]) {
+					operators = append(operators, &logList.Operators[i])
+				}
+			}
+		} else if operator := findOperator(logList, name); operator == nil {
+			missing = append(missing, name)
+		} else if !slices.Contains(operators, operator) {
+			operators = append(operators, operator)
+		}
+	}
+	if len(operators) == 0 {
+		names := make([]string, len(logList.Operators))
+		for i, op := range logList.Operators {
+			names[i] = op.Name
+		}
+		return nil, nil, nil, withCode(errCodeOperatorNotFound, fmt.Errorf("operator %q not found in the log list; it has %s", cfg.Operator, strings.Join(names, ", ")))
+	}
+	for _, name := range missing {
+		log.Printf("Warning: operator %q not found in the log list, monitoring the logs of %s", name, operatorList(operators))
+	}
+
+	operatorOf := make(map[string]*Operator)
+	var operatorLogs []LogInfo
+	for _, operator := range operators {
+		for _, logInfo := range cfg.ExcludeLogs.exclude(operator.Logs) {
+			if _, ok := operatorOf[logInfo.URL]; !ok {
+				operatorOf[logInfo.URL] = operator
+				operatorLogs = append(operatorLogs, logInfo)
+			}
+		}
+	}
+	if len(operatorLogs) == 0 {
+		return nil, nil, nil, withCode(errCodeNoLogs, fmt.Errorf("no logs found for %s", operatorList(operators)))
+	}
+	// Logs picked by ID or with -logs are monitored as they are, shards
+	// included.
+	if len(cfg.LogIDs) > 0 || len(cfg.Logs) > 0 {
+		selectedLogs, err := selectLogIDs(logList, operators, cfg.LogIDs)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		picked, err := selectLogs(logList, operators, cfg.Logs)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		for _, logInfo := range picked {
+			if !slices.ContainsFunc(selectedLogs, func(l LogInfo) bool { return l.URL == logInfo.URL }) {
+				selectedLogs = append(selectedLogs, logInfo)
+			}
+		}
+		if selectedLogs = cfg.ExcludeLogs.exclude(selectedLogs); len(selectedLogs) == 0 {
+			return nil, nil, nil, withCode(errCodeNoLogs, fmt.Errorf("every log selected by -log-ids or -logs is excluded by -exclude-log"))
+		}
+		return operatorOf, selectedLogs, nil, nil
+	}
+
+	var liveLogs, frozen []LogInfo
+	for _, logInfo := range operatorLogs {
+		if logInfo.frozen() {
+			frozen = append(frozen, logInfo)
+		} else {
+			liveLogs = append(liveLogs, logInfo)
+		}
+	}
+	// Of the temporal shards, only those that can hold certificates logged
+	// since the start of the monitoring window are of interest; with -since
+	// that window can span several of an operator's shards.
+	now := time.Now()
+	var selectedLogs, skipped []LogInfo
+	if cfg.CurrentShard {
+		selectedLogs, skipped = selectCurrentShard(liveLogs, now)
+	} else {
+		selectedLogs, skipped = selectShards(liveLogs, now.Add(-cfg.Since), now)
+	}
+	// A frozen log is drained like an old shard.
+	left := append(skipped, frozen...)
+	var fromStart map[string]bool
+	if state != nil {
+		selectedLogs, fromStart = planRollover(selectedLogs, left, state)
+		if cfg.CurrentShard {
+			// The next shard has been taking certificates for a long time
+			// when the current one ends; it starts at its end like any
+			// other log instead of replaying all of them.
+			fromStart = nil
+		}
+	}
+	if len(selectedLogs) == 0 {
+		if len(liveLogs) == 0 {
+			return nil, nil, nil, withCode(errCodeNoLogs, fmt.Errorf("every log of %s is read-only, retired or rejected", operatorList(operators)))
+		}
+		return nil, nil, nil, withCode(errCodeNoLogs, fmt.Errorf("none of the %d log shards of %s cover the monitoring window", len(skipped), operatorList(operators)))
+	}
+	for _, logInfo := range left {
+		_, saved := state.get(logInfo.URL)
+		switch {
+		case saved && logInfo.frozen():
+			log.Printf("Draining %s: the log is %s, but the previous run was reading it", logInfo.Description, logInfo.stateName())
+		case saved:
+			log.Printf("Draining %s: its shard no longer covers the monitoring window, but the previous run was reading it", logInfo.Description)
+		case logInfo.frozen():
+			log.Printf("Skipping %s: the log is %s", logInfo.Description, logInfo.stateName())
+		default:
+			log.Printf("Skipping %s: its shard does not cover the monitoring window", logInfo.Description)
+		}
+	}
+	return operatorOf, selectedLogs, fromStart, nil
+}
+
+// allOperators, as an -operator name, selects every operator.
+const allOperators = "all"
+
+// operatorNames splits the comma-separated -operator into names.
+func operatorNames(v string) []string {
+	var names []string
+	for _, name := range strings.Split(v, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// operatorList describes operators for messages: "the Google operator" or
+// "the Google and Cloudflare operators".
+func operatorList(operators []*Operator) string {
+	names := make([]string, len(operators))
+	for i, op := range operators {
+		names[i] = op.Name
+	}
+	if len(names) == 1 {
+		return "the " + names[0] + " operator"
+	}
+	return "the " + strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1] + " operators"
+}
+
+// findOperator returns the operator with the given name, ignoring case and
+// surrounding whitespace, or nil.
+func findOperator(logList *LogList, name string) *Operator {
+	name = strings.TrimSpace(name)
+	for i := range logList.Operators {
+		if strings.EqualFold(strings.TrimSpace(logList.Operators[i].Name), name) {
+			return &logList.Operators[i]
+		}
+	}
+	return nil
+}
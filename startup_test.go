@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func testLogList() *LogList {
+	usable := map[string]json.RawMessage{"usable": json.RawMessage(`{}`)}
+	retired := map[string]json.RawMessage{"retired": json.RawMessage(`{}`)}
+	return &LogList{Operators: []Operator{
+		{Name: "Google", Logs: []LogInfo{
+			{URL: "https://ct.googleapis.com/a/", Description: "Google A", LogID: "aWQtYQ==", State: usable},
+			{URL: "https://ct.googleapis.com/old/", Description: "Google Old", LogID: "aWQtb2xk", State: retired},
+		}},
+		{Name: "Cloudflare", Logs: []LogInfo{
+			{URL: "https://ct.cloudflare.com/b/", Description: "Cloudflare B", LogID: "aWQtYg==", State: usable},
+		}},
+		{Name: "Let's Encrypt", Logs: []LogInfo{
+			{URL: "https://oak.ct.letsencrypt.org/c/", Description: "Let's Encrypt C", LogID: "aWQtYw==", State: usable},
+		}},
+	}}
+}
+
+func descriptions(logs []LogInfo) []string {
+	var names []string
+	for _, l := range logs {
+		names = append(names, l.Description)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func TestSelectOperatorLogs(t *testing.T) {
+	tests := []struct {
+		name     string
+		operator string
+		exclude  []string
+		logIDs   []string
+		logs     []string
+		want     []string
+		wantErr  bool
+	}{
+		{name: "default is every operator", operator: allOperators, want: []string{"Cloudflare B", "Google A", "Let's Encrypt C"}},
+		{name: "one operator", operator: "cloudflare", want: []string{"Cloudflare B"}},
+		{name: "several operators, one missing", operator: "Google, Nope", want: []string{"Google A"}},
+		{name: "no operator found", operator: "Nope", wantErr: true},
+		{name: "exclude by description", operator: allOperators, exclude: []string{"google a"}, want: []string{"Cloudflare B", "Let's Encrypt C"}},
+		{name: "exclude by URL without slash", operator: allOperators, exclude: []string{"https://ct.cloudflare.com/b"}, want: []string{"Google A", "Let's Encrypt C"}},
+		{name: "log IDs", operator: allOperators, logIDs: []string{"aWQtYg==", "aWQtYw=="}, want: []string{"Cloudflare B", "Let's Encrypt C"}},
+		{name: "log IDs with an excluded log", operator: allOperators, exclude: []string{"aWQtYw=="}, logIDs: []string{"aWQtYg==", "aWQtYw=="}, want: []string{"Cloudflare B"}},
+		{name: "log IDs all excluded", operator: allOperators, exclude: []string{"Cloudflare B"}, logIDs: []string{"aWQtYg=="}, wantErr: true},
+		{name: "logs by description", operator: allOperators, logs: []string{"cloudflare b"}, want: []string{"Cloudflare B"}},
+		{name: "logs by URL without slash", operator: allOperators, logs: []string{"https://ct.cloudflare.com/b"}, want: []string{"Cloudflare B"}},
+		{name: "logs by URL with slash", operator: allOperators, logs: []string{"https://ct.cloudflare.com/b/"}, want: []string{"Cloudflare B"}},
+		{name: "logs by ID", operator: allOperators, logs: []string{"aWQtYw=="}, want: []string{"Let's Encrypt C"}},
+		{name: "logs include retired", operator: "Google", logs: []string{"Google Old"}, want: []string{"Google Old"}},
+		{name: "logs named twice", operator: allOperators, logs: []string{"Google A", "https://ct.googleapis.com/a"}, want: []string{"Google A"}},
+		{name: "logs and log IDs", operator: allOperators, logs: []string{"Google A", "Cloudflare B"}, logIDs: []string{"aWQtYg=="}, want: []string{"Cloudflare B", "Google A"}},
+		{name: "logs with an excluded log", operator: allOperators, exclude: []string{"Google A"}, logs: []string{"Google A", "Cloudflare B"}, want: []string{"Cloudflare B"}},
+		{name: "logs of another operator", operator: "Google", logs: []string{"Cloudflare B"}, wantErr: true},
+		{name: "logs not in the list", operator: allOperators, logs: []string{"Nope"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config{Operator: tt.operator, ExcludeLogs: tt.exclude, LogIDs: tt.logIDs, Logs: tt.logs}
+			_, logs, _, err := selectOperatorLogs(cfg, testLogList(), nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want an error: %v", err, tt.wantErr)
+			}
+			if got := descriptions(logs); !slices.Equal(got, tt.want) {
+				t.Errorf("selected %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultOperatorIsAll(t *testing.T) {
+	cfg, _, err := parseTestFlags(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Operator != allOperators {
+		t.Errorf("default -operator = %q, want %q", cfg.Operator, allOperators)
+	}
+}
+
+func TestLogListFromStdinReadOnce(t *testing.T) {
+	list, err := json.Marshal(testLogList())
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "log_list.json")
+	if err := os.WriteFile(path, list, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	stdin, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdin.Close()
+	saved := os.Stdin
+	os.Stdin = stdin
+	defer func() { os.Stdin = saved }()
+
+	// Refreshing the list reads it again, by which time stdin is at EOF.
+	cfg := &config{LogListURL: "-"}
+	for range 2 {
+		logList, err := getConfiguredLogList(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(logList.Operators) != 3 {
+			t.Errorf("log list has %d operators, want 3", len(logList.Operators))
+		}
+	}
+}
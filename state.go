@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	ct "github.com/google/certificate-transparency-go"
+)
+
+// stateSaveInterval is how often the state file is rewritten while running.
+const stateSaveInterval = 30 * time.Second
+
+// logState is the saved position of a log's monitor, and its last verified
+// tree head.
+type logState struct {
+	// NextIndex is the index of the first entry not yet processed.
+	NextIndex int64     `json:"next_index"`
+	Updated   time.Time `json:"updated"`
+	// LogID is the ID of the log's key in the log list when it was last
+	// monitored, to notice the key changing.
+	LogID string `json:"log_id,omitempty"`
+	// STH is the last tree head proven consistent by -verify-consistency,
+	// from which the next run's first proof starts. It is saved even before
+	// the log has a position.
+	STH *savedSTH `json:"sth,omitempty"`
+}
+
+// hasPosition reports whether a position was saved, rather than only a
+// tree head.
+func (st logState) hasPosition() bool {
+	return !st.Updated.IsZero()
+}
+
+// savedSTH is the part of a signed tree head a consistency proof needs.
+type savedSTH struct {
+	TreeSize  uint64 `json:"tree_size"`
+	Timestamp uint64 `json:"timestamp"`
+	RootHash  []byte `json:"root_hash"`
+}
+
+// stateStore holds the resume positions of all monitors, keyed by log URL,
+// and persists them to a JSON file so that a restart picks up where the
+// previous run stopped.
+type stateStore struct {
+	path string
+
+	mu    sync.Mutex
+	logs  map[string]logState
+	dirty bool
+}
+
+// loadState reads the state file at path. A missing file yields an empty
+// store. If the file is corrupt, the backup kept by the previous save is
+// used instead.
+func loadState(path string) (*stateStore, error) {
+	s := &stateStore{path: path, logs: make(map[string]logState)}
+	err := s.read(path)
+	if err == nil || errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	log.Printf("Warning: state file %s is unreadable, falling back to %s: %v", path, backupPath(path), err)
+	if err := s.read(backupPath(path)); err != nil {
+		return nil, fmt.Errorf("failed to read state backup: %w", err)
+	}
+	return s, nil
+}
+
+func (s *stateStore) read(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	logs := make(map[string]logState)
+	if err := json.Unmarshal(data, &logs); err != nil {
+		return err
+	}
+	s.logs = logs
+	return nil
+}
+
+// get returns the saved position of the log at url. A nil store has none.
+func (s *stateStore) get(url string) (logState, bool) {
+	if s == nil {
+		return logState{}, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := s.logs[url]
+	return st, ok && st.hasPosition()
+}
+
+// verifiedSTH returns the last verified tree head saved for the log at url,
+// or nil if there is none. A nil store has none.
+func (s *stateStore) verifiedSTH(url string) *ct.SignedTreeHead {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.logs[url].STH.treeHead()
+}
+
+// set records that the log at url has been processed up to nextIndex.
+func (s *stateStore) set(url string, nextIndex int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.logs[url]
+	st.NextIndex, st.Updated = nextIndex, time.Now().UTC()
+	s.logs[url] = st
+	s.dirty = true
+}
+
+// setSTH records sth as the last verified tree head of the log at url,
+// whether or not it has a saved position yet.
+func (s *stateStore) setSTH(url string, sth *ct.SignedTreeHead) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.logs[url]
+	st.STH = &savedSTH{TreeSize: sth.TreeSize, Timestamp: sth.Timestamp, RootHash: bytes.Clone(sth.SHA256RootHash[:])}
+	s.logs[url] = st
+	s.dirty = true
+}
+
+// treeHead returns the saved tree head as an STH to verify against, or nil
+// if there is none or it is malformed.
+func (s *savedSTH) treeHead() *ct.SignedTreeHead {
+	if s == nil || len(s.RootHash) != sha256.Size {
+		return nil
+	}
+	sth := &ct.SignedTreeHead{TreeSize: s.TreeSize, Timestamp: s.Timestamp}
+	copy(sth.SHA256RootHash[:], s.RootHash)
+	return sth
+}
+
+// setLogID records the ID of the log at url's key. If a different one was
+// recorded before, it returns that one and true. Logs without a saved
+// position are only recorded once they have one.
+func (s *stateStore) setLogID(url, id string) (previous string, changed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.logs[url]
+	if !st.hasPosition() || st.LogID == id {
+		return "", false
+	}
+	previous = st.LogID
+	st.LogID = id
+	s.logs[url] = st
+	s.dirty = true
+	return previous, previous != ""
+}
+
+// save writes the state file if anything changed since the last save.
+// Output is flushed first so that the saved positions never run ahead of
+// what was actually written.
+func (s *stateStore) save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.dirty {
+		return nil
+	}
+	if err := stdout.Flush(); err != nil {
+		return fmt.Errorf("failed to flush output: %w", err)
+	}
+	data, err := json.MarshalIndent(s.logs, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(s.path, append(data, '\n')); err != nil {
+		return err
+	}
+	s.dirty = false
+	return nil
+}
+
+// saveEvery saves the state every interval until done is closed.
+func (s *stateStore) saveEvery(interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.save(); err != nil {
+				log.Printf("Failed to save state: %v", err)
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+func backupPath(path string) string {
+	return path + ".bak"
+}
+
+// writeFileAtomic replaces path with data such that a crash at any point
+// leaves either the old or the new contents in place, never a partial
+// file. The previous contents are kept at backupPath(path).
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	// Hard-link rather than rename the current file to the backup, so that
+	// path exists at every moment.
+	bak := backupPath(path)
+	if err := os.Remove(bak); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err := os.Link(path, bak); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Printf("Failed to keep state backup: %v", err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	ct "github.com/google/certificate-transparency-go"
+)
+
+func testSTH(size uint64) *ct.SignedTreeHead {
+	sth := &ct.SignedTreeHead{TreeSize: size, Timestamp: 1700000000000 + size}
+	sth.SHA256RootHash[0] = byte(size)
+	return sth
+}
+
+func TestSetSTHWithoutPosition(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	s, err := loadState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const url = "https://ct.example.com/log/"
+	s.setSTH(url, testSTH(10))
+	if _, ok := s.get(url); ok {
+		t.Error("a saved tree head counts as a saved position")
+	}
+	if err := s.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = loadState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := testSTH(10)
+	if got := s.verifiedSTH(url); got == nil || got.TreeSize != want.TreeSize || got.Timestamp != want.Timestamp || got.SHA256RootHash != want.SHA256RootHash {
+		t.Fatalf("verifiedSTH = %+v, want the saved tree head of size 10", got)
+	}
+	if _, ok := s.get(url); ok {
+		t.Error("a saved tree head counts as a saved position after reloading")
+	}
+
+	s.set(url, 5)
+	s.setSTH(url, testSTH(12))
+	st, ok := s.get(url)
+	if !ok || st.NextIndex != 5 {
+		t.Errorf("get = %+v, %v; want position 5", st, ok)
+	}
+	if got := s.verifiedSTH(url); got == nil || got.TreeSize != 12 {
+		t.Errorf("verifiedSTH = %+v, want size 12", got)
+	}
+}
+
+func TestNilStateStore(t *testing.T) {
+	var s *stateStore
+	if _, ok := s.get("https://ct.example.com/"); ok {
+		t.Error("a nil store has a position")
+	}
+	if s.verifiedSTH("https://ct.example.com/") != nil {
+		t.Error("a nil store has a tree head")
+	}
+}
+
+func TestStateSaveAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+	s, err := loadState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const url = "https://ct.example.com/log/"
+	s.set(url, 100)
+	if err := s.save(); err != nil {
+		t.Fatal(err)
+	}
+	first, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.set(url, 200)
+	if err := s.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The previous version is kept as the backup, and no temporary file is
+	// left behind.
+	if bak, err := os.ReadFile(backupPath(path)); err != nil || !bytes.Equal(bak, first) {
+		t.Errorf("backup = %q, %v; want the first save, %q", bak, err, first)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if want := []string{"state.json", "state.json.bak"}; !slices.Equal(names, want) {
+		t.Errorf("directory holds %q, want %q", names, want)
+	}
+
+	s, err = loadState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st, ok := s.get(url); !ok || st.NextIndex != 200 {
+		t.Errorf("get = %+v, %v; want position 200", st, ok)
+	}
+}
+
+func TestStateSaveOnlyWhenChanged(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	s, err := loadState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.save(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("an unchanged store was written: %v", err)
+	}
+}
+
+func TestLoadStateFallsBackToBackup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	s, err := loadState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const url = "https://ct.example.com/log/"
+	s.set(url, 100)
+	if err := s.save(); err != nil {
+		t.Fatal(err)
+	}
+	s.set(url, 200)
+	if err := s.save(); err != nil {
+		t.Fatal(err)
+	}
+	// A torn write of the state file itself, which writeFileAtomic avoids
+	// but a full disk or a careless edit might not.
+	if err := os.WriteFile(path, []byte(`{"https://ct.exa`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = loadState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st, ok := s.get(url); !ok || st.NextIndex != 100 {
+		t.Errorf("get = %+v, %v; want the backup's position 100", st, ok)
+	}
+
+	if err := os.WriteFile(backupPath(path), []byte("garbage"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadState(path); err == nil {
+		t.Error("loadState succeeded with both the state file and its backup corrupt")
+	}
+}
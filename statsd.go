@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// statsdFlushInterval is how often aggregated counters, and gauges, are
+// sent.
+const statsdFlushInterval = 10 * time.Second
+
+// statsdMaxPacket keeps packets below common MTUs.
+const statsdMaxPacket = 1400
+
+// statsdRecorder sends metrics to a statsd server over UDP as
+// certtail.<name>. Counters are aggregated and sent every
+// statsdFlushInterval, so that per-entry counts cost no packets; timings
+// are sent as they are recorded. With tags, the log is attached as a
+// DogStatsD "log" tag; otherwise measurements are not broken down by log.
+type statsdRecorder struct {
+	conn net.Conn
+	tags bool
+
+	mu       sync.Mutex
+	counters map[statsdKey]int64
+}
+
+type statsdKey struct {
+	name, logName string
+}
+
+func newStatsdRecorder(addr string, tags bool) (*statsdRecorder, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &statsdRecorder{conn: conn, tags: tags, counters: make(map[statsdKey]int64)}, nil
+}
+
+func (s *statsdRecorder) key(name, logName string) statsdKey {
+	if !s.tags {
+		logName = ""
+	}
+	return statsdKey{name, logName}
+}
+
+func (s *statsdRecorder) count(name string, n int64, logName string) {
+	s.mu.Lock()
+	s.counters[s.key(name, logName)] += n
+	s.mu.Unlock()
+}
+
+func (s *statsdRecorder) timing(name string, d time.Duration, logName string) {
+	s.send([]string{s.line(s.key(name, logName), fmt.Sprintf("%g|ms", float64(d)/float64(time.Millisecond)))})
+}
+
+// gauge sends a gauge. Per-log gauges are only sent with tags: without,
+// the logs' values would overwrite each other.
+func (s *statsdRecorder) gauge(name string, value int64, logName string) {
+	if logName != "" && !s.tags {
+		return
+	}
+	s.send([]string{s.line(statsdKey{name, logName}, fmt.Sprintf("%d|g", value))})
+}
+
+// line formats a statsd line for key with the given value and type.
+func (s *statsdRecorder) line(key statsdKey, value string) string {
+	line := "certtail." + key.name + ":" + value
+	if key.logName != "" {
+		// DogStatsD tag values must not contain commas or pipes.
+		line += "|#log:" + strings.NewReplacer(",", "_", "|", "_").Replace(key.logName)
+	}
+	return line
+}
+
+// flush sends and resets the aggregated counters.
+func (s *statsdRecorder) flush() {
+	s.mu.Lock()
+	counters := s.counters
+	s.counters = make(map[statsdKey]int64)
+	s.mu.Unlock()
+
+	lines := make([]string, 0, len(counters))
+	for key, n := range counters {
+		lines = append(lines, s.line(key, fmt.Sprintf("%d|c", n)))
+	}
+	s.send(lines)
+}
+
+// send writes lines to the server, several to a packet. Errors are only
+// logged: metrics must never get in the way of monitoring.
+func (s *statsdRecorder) send(lines []string) {
+	var packet bytes.Buffer
+	write := func() {
+		if packet.Len() == 0 {
+			return
+		}
+		if _, err := s.conn.Write(packet.Bytes()); err != nil {
+			log.Printf("Failed to send metrics to statsd: %v", err)
+		}
+		packet.Reset()
+	}
+	for _, line := range lines {
+		if packet.Len() > 0 && packet.Len()+1+len(line) > statsdMaxPacket {
+			write()
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+	write()
+}
+
+// flushEvery sends the counters every interval until done is closed. The
+// final flush on shutdown is left to the caller, once the monitors have
+// stopped.
+func (s *statsdRecorder) flushEvery(interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.flush()
+		case <-done:
+			return
+		}
+	}
+}
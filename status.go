@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logStatus is what a monitor reports about its progress.
+type logStatus struct {
+	Description string    `json:"description"`
+	URL         string    `json:"url"`
+	Running     bool      `json:"running"`
+	TreeSize    uint64    `json:"tree_size"`
+	NextIndex   int64     `json:"next_index"`
+	LastSuccess time.Time `json:"last_success,omitempty"`
+	Breaker     string    `json:"breaker"`
+	// Detection latency percentiles over the most recent entries, in
+	// milliseconds.
+	LatencyP50 int64 `json:"latency_p50_ms,omitempty"`
+	LatencyP99 int64 `json:"latency_p99_ms,omitempty"`
+}
+
+// statusBoard collects the status of all monitors for the /status and
+// /healthz endpoints.
+type statusBoard struct {
+	mu      sync.Mutex
+	started time.Time
+	logs    map[string]*logStatus // keyed by log URL
+	budget  *requestBudget        // nil unless -max-requests-per-minute is set
+	// validity is the certificate lifetime histogram; nil unless
+	// -validity-stats is set.
+	validity *validityHistogram
+}
+
+func newStatusBoard(budget *requestBudget) *statusBoard {
+	return &statusBoard{started: time.Now(), logs: make(map[string]*logStatus), budget: budget}
+}
+
+// update applies fn to the status of logInfo's monitor.
+func (b *statusBoard) update(logInfo LogInfo, fn func(*logStatus)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	st := b.logs[logInfo.URL]
+	if st == nil {
+		st = &logStatus{Description: logInfo.Description, URL: logInfo.URL, Breaker: breakerClosed.String()}
+		b.logs[logInfo.URL] = st
+	}
+	fn(st)
+}
+
+// remove forgets logInfo's monitor, once it has been stopped for good.
+func (b *statusBoard) remove(logInfo LogInfo) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.logs, logInfo.URL)
+}
+
+// snapshot returns a copy of all statuses, ordered by description.
+func (b *statusBoard) snapshot() []logStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	list := make([]logStatus, 0, len(b.logs))
+	for _, st := range b.logs {
+		list = append(list, *st)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Description < list[j].Description })
+	return list
+}
+
+// stalled returns the descriptions of monitors that have stopped, or have
+// not completed a poll within threshold. Paused monitors are not stalled.
+func (b *statusBoard) stalled(pause *pauseState, threshold time.Duration, now time.Time) []string {
+	var stalled []string
+	for _, st := range b.snapshot() {
+		if pause.isPaused(st.URL) {
+			continue
+		}
+		last := st.LastSuccess
+		if last.Before(b.started) {
+			last = b.started
+		}
+		if !st.Running || now.Sub(last) > threshold {
+			stalled = append(stalled, st.Description)
+		}
+	}
+	return stalled
+}
+
+// monitorCounts summarizes the monitors, to confirm that the expected
+// number are alive.
+type monitorCounts struct {
+	Running    int `json:"running"`
+	Stopped    int `json:"stopped"`
+	Goroutines int `json:"goroutines"`
+}
+
+// countMonitors counts the running and stopped monitors in a snapshot.
+func countMonitors(logs []logStatus) monitorCounts {
+	counts := monitorCounts{Goroutines: runtime.NumGoroutine()}
+	for _, st := range logs {
+		if st.Running {
+			counts.Running++
+		} else {
+			counts.Stopped++
+		}
+	}
+	return counts
+}
+
+// recordGaugesEvery records the monitor counts, and for each log whether
+// its monitor is running, how far behind its tree head it is and when it
+// last completed a poll, as metrics gauges every interval until done is
+// closed.
+func (b *statusBoard) recordGaugesEvery(interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			logs := b.snapshot()
+			counts := countMonitors(logs)
+			metrics.gauge(metricMonitors, int64(counts.Running), "")
+			metrics.gauge(metricMonitorsDown, int64(counts.Stopped), "")
+			metrics.gauge(metricGoroutines, int64(counts.Goroutines), "")
+			for _, st := range logs {
+				running := int64(0)
+				if st.Running {
+					running = 1
+				}
+				metrics.gauge(metricRunning, running, st.Description)
+				if st.TreeSize > 0 {
+					metrics.gauge(metricLag, max(int64(st.TreeSize)-st.NextIndex, 0), st.Description)
+				}
+				if !st.LastSuccess.IsZero() {
+					metrics.gauge(metricLastSuccess, st.LastSuccess.Unix(), st.Description)
+				}
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// statusReport is the JSON body of /status.
+type statusReport struct {
+	Monitors      monitorCounts   `json:"monitors"`
+	Logs          []logStatus     `json:"logs"`
+	RequestBudget *budgetStats    `json:"request_budget,omitempty"`
+	Validity      []validityCount `json:"validity,omitempty"`
+}
+
+// serveStatus registers GET /status (the status of every monitor, of the
+// request budget and the validity histogram as JSON) and GET /healthz (see
+// serveHealthz).
+func serveStatus(mux *http.ServeMux, status *statusBoard, pause *pauseState, threshold time.Duration) {
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		logs := status.snapshot()
+		report := statusReport{Monitors: countMonitors(logs), Logs: logs}
+		if status.budget != nil {
+			stats := status.budget.stats()
+			report.RequestBudget = &stats
+		}
+		if status.validity != nil {
+			report.Validity = status.validity.snapshot()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(report); err != nil {
+			log.Printf("Failed to write status: %v", err)
+		}
+	})
+	serveHealthz(mux, status, pause, threshold)
+}
+
+// serveHealthz registers GET /healthz: 200 when all monitors are healthy,
+// 503 listing the stalled ones otherwise.
+func serveHealthz(mux *http.ServeMux, status *statusBoard, pause *pauseState, threshold time.Duration) {
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		if stalled := status.stalled(pause, threshold, time.Now()); len(stalled) > 0 {
+			http.Error(w, "stalled: "+strings.Join(stalled, ", "), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+}
+
+// runHealthcheck queries the /healthz endpoint of a running instance
+// listening on addr and returns the process exit code: 0 if healthy, 1
+// otherwise. It is meant for container liveness probes.
+func runHealthcheck(addr string) int {
+	if strings.HasPrefix(addr, ":") {
+		addr = "localhost" + addr
+	}
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get("http://" + addr + "/healthz")
+	if err != nil {
+		fmt.Printf("unhealthy: %v\n", err)
+		return 1
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	fmt.Print(string(body))
+	if resp.StatusCode != http.StatusOK {
+		return 1
+	}
+	return 0
+}
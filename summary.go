@@ -0,0 +1,83 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// runSummary counts, per log, the entries processed, certificates emitted
+// and errors of a run, for the -summary logged on shutdown. It sits in
+// front of the configured metrics recorder, passing every measurement on.
+type runSummary struct {
+	next    metricsRecorder
+	started time.Time
+
+	mu   sync.Mutex
+	logs map[string]*summaryCounts
+}
+
+type summaryCounts struct {
+	entries, certificates, parseErrors, errors int64
+}
+
+func newRunSummary(next metricsRecorder) *runSummary {
+	return &runSummary{next: next, started: time.Now(), logs: make(map[string]*summaryCounts)}
+}
+
+func (s *runSummary) count(name string, n int64, logName string) {
+	s.next.count(name, n, logName)
+	switch name {
+	case metricEntries, metricCertificates, metricParseErrors, metricErrors:
+	default:
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.logs[logName]
+	if !ok {
+		c = &summaryCounts{}
+		s.logs[logName] = c
+	}
+	switch name {
+	case metricEntries:
+		c.entries += n
+	case metricCertificates:
+		c.certificates += n
+	case metricParseErrors:
+		c.parseErrors += n
+	case metricErrors:
+		c.errors += n
+	}
+}
+
+func (s *runSummary) timing(name string, d time.Duration, logName string) {
+	s.next.timing(name, d, logName)
+}
+
+func (s *runSummary) gauge(name string, value int64, logName string) {
+	s.next.gauge(name, value, logName)
+}
+
+// report logs the totals of the run, then those of each log.
+func (s *runSummary) report() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var total summaryCounts
+	names := make([]string, 0, len(s.logs))
+	for name, c := range s.logs {
+		names = append(names, name)
+		total.entries += c.entries
+		total.certificates += c.certificates
+		total.parseErrors += c.parseErrors
+		total.errors += c.errors
+	}
+	sort.Strings(names)
+	log.Printf("Summary after %s: %d entries processed, %d certificates emitted, %d parse errors, %d failed polls",
+		time.Since(s.started).Round(time.Second), total.entries, total.certificates, total.parseErrors, total.errors)
+	for _, name := range names {
+		c := s.logs[name]
+		log.Printf("  %s: %d entries, %d certificates, %d parse errors, %d failed polls", name, c.entries, c.certificates, c.parseErrors, c.errors)
+	}
+}
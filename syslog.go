@@ -0,0 +1,95 @@
+//go:build !windows && !plan9
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"log/syslog"
+	"strings"
+	"time"
+)
+
+// syslogSupported is whether -syslog works on this platform.
+const syslogSupported = true
+
+var syslogFacilities = map[string]syslog.Priority{
+	"kern": syslog.LOG_KERN, "user": syslog.LOG_USER, "mail": syslog.LOG_MAIL,
+	"daemon": syslog.LOG_DAEMON, "auth": syslog.LOG_AUTH, "syslog": syslog.LOG_SYSLOG,
+	"lpr": syslog.LOG_LPR, "news": syslog.LOG_NEWS, "uucp": syslog.LOG_UUCP,
+	"cron": syslog.LOG_CRON, "authpriv": syslog.LOG_AUTHPRIV, "ftp": syslog.LOG_FTP,
+	"local0": syslog.LOG_LOCAL0, "local1": syslog.LOG_LOCAL1, "local2": syslog.LOG_LOCAL2,
+	"local3": syslog.LOG_LOCAL3, "local4": syslog.LOG_LOCAL4, "local5": syslog.LOG_LOCAL5,
+	"local6": syslog.LOG_LOCAL6, "local7": syslog.LOG_LOCAL7,
+}
+
+var syslogSeverities = map[string]syslog.Priority{
+	"emerg": syslog.LOG_EMERG, "alert": syslog.LOG_ALERT, "crit": syslog.LOG_CRIT,
+	"err": syslog.LOG_ERR, "warning": syslog.LOG_WARNING, "notice": syslog.LOG_NOTICE,
+	"info": syslog.LOG_INFO, "debug": syslog.LOG_DEBUG,
+}
+
+// syslogRedialInterval bounds how often an unreachable syslog server is
+// retried.
+const syslogRedialInterval = 10 * time.Second
+
+// runSyslogSink sends every event from sub to syslog until the subscription
+// is closed. target is "local" for the local syslog daemon, or
+// udp://host:port / tcp://host:port for a remote server. Events that arrive
+// while the server is unreachable are dropped; the broadcaster's buffering
+// and -sink-overflow decide what happens when the server is merely slow.
+func runSyslogSink(cfg *config, sub *subscription) error {
+	facility, ok := syslogFacilities[cfg.SyslogFacility]
+	if !ok {
+		return fmt.Errorf("unknown syslog facility %q", cfg.SyslogFacility)
+	}
+	severity, ok := syslogSeverities[cfg.SyslogSeverity]
+	if !ok {
+		return fmt.Errorf("unknown syslog severity %q", cfg.SyslogSeverity)
+	}
+	network, raddr := "", ""
+	if cfg.Syslog != "local" {
+		var found bool
+		network, raddr, found = strings.Cut(cfg.Syslog, "://")
+		if !found || (network != "udp" && network != "tcp") {
+			return fmt.Errorf("syslog target must be local, udp://host:port or tcp://host:port")
+		}
+	}
+
+	dial := func() (*syslog.Writer, error) {
+		return syslog.Dial(network, raddr, facility|severity, "certtail")
+	}
+	w, err := dial()
+	if err != nil {
+		log.Printf("Failed to connect to syslog, will retry: %v", err)
+	}
+	lastDial := time.Now()
+
+	go func() {
+		var dropped uint64
+		for ev := range sub.C {
+			if w == nil && time.Since(lastDial) >= syslogRedialInterval {
+				lastDial = time.Now()
+				if w, err = dial(); err == nil {
+					log.Printf("Connected to syslog after dropping %d events", dropped)
+				}
+			}
+			if w == nil {
+				dropped++
+				continue
+			}
+			// Writer reconnects once on its own; if that fails too, drop
+			// the connection and redial later.
+			if _, err := w.Write([]byte(formatCompact(cfg, ev))); err != nil {
+				log.Printf("Failed to write to syslog: %v", err)
+				w.Close()
+				w = nil
+				dropped++
+			}
+		}
+		if w != nil {
+			w.Close()
+		}
+	}()
+	return nil
+}
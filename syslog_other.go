@@ -0,0 +1,12 @@
+//go:build windows || plan9
+
+package main
+
+import "errors"
+
+// syslogSupported is whether -syslog works on this platform.
+const syslogSupported = false
+
+func runSyslogSink(cfg *config, sub *subscription) error {
+	return errors.New("syslog is not supported on this platform")
+}
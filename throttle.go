@@ -0,0 +1,69 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// throttleReportInterval is how often -max-output-rate reports the
+// certificates it kept off stdout.
+const throttleReportInterval = 10 * time.Second
+
+// outputThrottle caps the certificates printed on stdout per second, for
+// -max-output-rate, so that busy logs stay readable in a terminal. It is a
+// token bucket holding up to a second's worth of certificates, shared by
+// all monitors. Certificates beyond the rate are not printed but still
+// reach the sinks.
+type outputThrottle struct {
+	rate float64
+
+	mu      sync.Mutex
+	tokens  float64
+	last    time.Time
+	dropped int64 // since the last report
+}
+
+func newOutputThrottle(rate float64) *outputThrottle {
+	return &outputThrottle{rate: rate, tokens: rate, last: time.Now()}
+}
+
+// allow reports whether a certificate may be printed now. A nil throttle
+// allows everything.
+func (t *outputThrottle) allow(now time.Time) bool {
+	if t == nil {
+		return true
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.tokens = min(t.rate, t.tokens+now.Sub(t.last).Seconds()*t.rate)
+	t.last = now
+	if t.tokens < 1 {
+		t.dropped++
+		metrics.count(metricOutputDropped, 1, "")
+		return false
+	}
+	t.tokens--
+	return true
+}
+
+// reportEvery logs how many certificates were not printed every interval
+// in which there were some, until done is closed.
+func (t *outputThrottle) reportEvery(interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			t.mu.Lock()
+			dropped := t.dropped
+			t.dropped = 0
+			t.mu.Unlock()
+			if dropped > 0 {
+				log.Printf("Not printed: %d certificates in the last %s, above -max-output-rate %g/s", dropped, interval, t.rate)
+			}
+		case <-done:
+			return
+		}
+	}
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	ct "github.com/google/certificate-transparency-go"
+	"github.com/google/certificate-transparency-go/jsonclient"
+	"github.com/google/certificate-transparency-go/tls"
+)
+
+// ctLog is the part of the CT API a monitor uses. *client.LogClient
+// implements it for RFC 6962 logs, tiledLogClient for logs serving the
+// static CT API (c2sp.org/static-ct-api), such as Sunlight logs.
+type ctLog interface {
+	GetSTH(ctx context.Context) (*ct.SignedTreeHead, error)
+	GetSTHConsistency(ctx context.Context, first, second uint64) ([][]byte, error)
+	GetRawEntries(ctx context.Context, start, end int64) (*ct.GetEntriesResponse, error)
+}
+
+// tiled reports whether the log serves the static CT API. Log lists give
+// such logs in tiled_logs, with a monitoring URL instead of a URL.
+func (l LogInfo) tiled() bool {
+	return l.MonitoringURL != ""
+}
+
+// addTiledLogs moves each operator's tiled logs in with its other logs,
+// using the monitoring URL as the log's URL, so that everything keyed by
+// URL (state, pausing, status) works for them unchanged.
+func addTiledLogs(logList *LogList) {
+	for i := range logList.Operators {
+		op := &logList.Operators[i]
+		for _, l := range op.TiledLogs {
+			if l.URL == "" {
+				l.URL = l.MonitoringURL
+			}
+			op.Logs = append(op.Logs, l)
+		}
+		op.TiledLogs = nil
+	}
+}
+
+// newMonitorClient returns the client a monitor reads logInfo with: a
+// tiledLogClient for a tiled log and a CT client for the others, which
+// verifies tree heads against the log's key when the log list has it.
+func newMonitorClient(cfg *config, logInfo LogInfo) (ctLog, *retryAfterTransport, error) {
+	if !logInfo.tiled() {
+		logClient, transport, err := newLogClient(cfg, logInfo)
+		if err != nil {
+			return nil, nil, err
+		}
+		return withFaults(withSTHVerification(logClient, logInfo), logInfo), transport, nil
+	}
+	baseURL, err := logBaseURL(logInfo.MonitoringURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	transport := newLogRoundTripper(cfg, logInfo)
+	return withFaults(&tiledLogClient{
+		baseURL:       baseURL,
+		client:        &http.Client{Transport: transport},
+		authorization: cfg.Authorization,
+	}, logInfo), transport, nil
+}
+
+// tileWidth is the number of entries in a full data tile.
+const tileWidth = 256
+
+// tiledLogClient reads a log through the static CT API: the tree head is
+// a signed checkpoint, and entries come in data tiles of 256. Data tiles
+// hold only the fingerprints of the issuer chain, which is not fetched, so
+// entries are returned without one; the certificates themselves are
+// complete.
+type tiledLogClient struct {
+	baseURL       string
+	client        *http.Client
+	authorization string
+
+	// treeSize is that of the latest checkpoint. Data tiles are only
+	// published for it, the last one as a partial tile.
+	treeSize atomic.Uint64
+}
+
+// GetSTH fetches and parses the log's checkpoint.
+func (c *tiledLogClient) GetSTH(ctx context.Context) (*ct.SignedTreeHead, error) {
+	body, err := c.get(ctx, "/checkpoint")
+	if err != nil {
+		return nil, err
+	}
+	sth, err := parseCheckpoint(body)
+	if err != nil {
+		return nil, err
+	}
+	// A load balancer may hand us an older checkpoint than the last one;
+	// tiles are published for every size up to the largest seen.
+	for {
+		seen := c.treeSize.Load()
+		if sth.TreeSize <= seen || c.treeSize.CompareAndSwap(seen, sth.TreeSize) {
+			break
+		}
+	}
+	return sth, nil
+}
+
+// GetSTHConsistency is not supported: the static CT API has no proof
+// endpoints, and proofs would have to be assembled from hash tiles.
+func (c *tiledLogClient) GetSTHConsistency(ctx context.Context, first, second uint64) ([][]byte, error) {
+	return nil, errors.New("consistency proofs are not supported for tiled logs")
+}
+
+// GetRawEntries returns entries [start, end] (inclusive, as in
+// get-entries), or as many of them as the data tile holding start has.
+// Callers fetch the rest with further calls.
+func (c *tiledLogClient) GetRawEntries(ctx context.Context, start, end int64) (*ct.GetEntriesResponse, error) {
+	treeSize := int64(c.treeSize.Load())
+	if start < 0 || start > end || start >= treeSize {
+		return nil, fmt.Errorf("entries [%d, %d] are not in the tree of size %d", start, end, treeSize)
+	}
+	tile := start / tileWidth
+	width := min(int64(tileWidth), treeSize-tile*tileWidth)
+	path := "/tile/data/" + tilePath(tile)
+	if width < tileWidth {
+		path += ".p/" + strconv.FormatInt(width, 10)
+	}
+	body, err := c.get(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	leaves, err := parseDataTile(body, int(width))
+	if err != nil {
+		return nil, fmt.Errorf("data tile %d: %w", tile, err)
+	}
+	last := min(end, tile*tileWidth+width-1)
+	return &ct.GetEntriesResponse{Entries: leaves[start-tile*tileWidth : last-tile*tileWidth+1]}, nil
+}
+
+// get fetches a path below the monitoring URL. Errors carry the status in
+// a jsonclient.RspError, as the CT client's do, so that rate limiting is
+// recognized the same way.
+func (c *tiledLogClient) get(ctx context.Context, path string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.authorization != "" {
+		req.Header.Set("Authorization", c.authorization)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, jsonclient.RspError{StatusCode: resp.StatusCode, Body: body, Err: fmt.Errorf("got HTTP status %q for %s", resp.Status, path)}
+	}
+	return body, nil
+}
+
+// tilePath encodes a tile index as the static CT API's path: groups of
+// three digits, all but the last prefixed with x, e.g. x001/x234/067.
+func tilePath(n int64) string {
+	s := fmt.Sprintf("%03d", n%1000)
+	for n >= 1000 {
+		n /= 1000
+		s = fmt.Sprintf("x%03d/%s", n%1000, s)
+	}
+	return s
+}
+
+// parseCheckpoint parses a checkpoint: a signed note whose text is the
+// log's origin, tree size and base64 root hash. The timestamp and tree
+// head signature are taken from the note signature made by the origin's
+// key, which static CT logs always include. As for RFC 6962 logs, the
+// signature is not verified.
+func parseCheckpoint(note []byte) (*ct.SignedTreeHead, error) {
+	text, sigs, ok := strings.Cut(string(note), "\n\n")
+	if !ok {
+		return nil, errors.New("checkpoint is not a signed note")
+	}
+	lines := strings.Split(text, "\n")
+	if len(lines) < 3 {
+		return nil, errors.New("checkpoint is too short")
+	}
+	origin := lines[0]
+	size, err := strconv.ParseUint(lines[1], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("checkpoint has an invalid tree size: %w", err)
+	}
+	root, err := base64.StdEncoding.DecodeString(lines[2])
+	if err != nil || len(root) != 32 {
+		return nil, errors.New("checkpoint has an invalid root hash")
+	}
+	sth := &ct.SignedTreeHead{Version: ct.V1, TreeSize: size}
+	copy(sth.SHA256RootHash[:], root)
+
+	for _, line := range strings.Split(sigs, "\n") {
+		name, sig, ok := strings.Cut(strings.TrimPrefix(line, "— "), " ")
+		if !ok || name != origin {
+			continue
+		}
+		// An RFC6962NoteSignature: a 4-byte key hash, the 8-byte
+		// timestamp and the TLS-encoded tree head signature.
+		raw, err := base64.StdEncoding.DecodeString(sig)
+		if err != nil || len(raw) < 12 {
+			continue
+		}
+		sth.Timestamp = binary.BigEndian.Uint64(raw[4:12])
+		if rest, err := tls.Unmarshal(raw[12:], &sth.TreeHeadSignature); err != nil || len(rest) > 0 {
+			continue
+		}
+		return sth, nil
+	}
+	return nil, fmt.Errorf("checkpoint has no tree head signature from %s", origin)
+}
+
+// parseDataTile parses the n entries of a data tile into the leaves and
+// extra data get-entries would have returned, less the issuer chains.
+//
+// Each entry of a data tile is a TimestampedEntry followed, for a
+// certificate, by its chain's fingerprints, or for a precertificate, by
+// the precertificate as submitted and its chain's fingerprints.
+func parseDataTile(tile []byte, n int) ([]ct.LeafEntry, error) {
+	r := &tileReader{b: tile}
+	leaves := make([]ct.LeafEntry, 0, n)
+	for range n {
+		entry := r.b
+		r.uint(8) // timestamp
+		entryType := ct.LogEntryType(r.uint(2))
+		switch entryType {
+		case ct.X509LogEntryType:
+			r.vector(3)
+		case ct.PrecertLogEntryType:
+			r.take(32) // issuer key hash
+			r.vector(3)
+		default:
+			return nil, fmt.Errorf("unknown entry type %d", entryType)
+		}
+		r.vector(2) // extensions
+		if r.err != nil {
+			return nil, r.err
+		}
+		timestampedEntry := entry[:len(entry)-len(r.b)]
+
+		// The extra data holds an empty certificate chain.
+		var extra []byte
+		if entryType == ct.PrecertLogEntryType {
+			pre := r.vector(3)
+			extra = append(extra, byte(len(pre)>>16), byte(len(pre)>>8), byte(len(pre)))
+			extra = append(extra, pre...)
+		}
+		extra = append(extra, 0, 0, 0)
+		r.vector(2) // chain fingerprints
+		if r.err != nil {
+			return nil, r.err
+		}
+
+		// A MerkleTreeLeaf: version v1, leaf type timestamped_entry.
+		leaf := append([]byte{byte(ct.V1), byte(ct.TimestampedEntryLeafType)}, timestampedEntry...)
+		leaves = append(leaves, ct.LeafEntry{LeafInput: leaf, ExtraData: extra})
+	}
+	if len(r.b) > 0 {
+		return nil, fmt.Errorf("%d trailing bytes after %d entries", len(r.b), n)
+	}
+	return leaves, nil
+}
+
+// tileReader reads the TLS-encoded fields of a data tile. The first
+// error sticks, and later reads return nothing.
+type tileReader struct {
+	b   []byte
+	err error
+}
+
+func (r *tileReader) take(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.b) < n {
+		r.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	v := r.b[:n]
+	r.b = r.b[n:]
+	return v
+}
+
+// uint reads an n-byte big-endian integer.
+func (r *tileReader) uint(n int) uint64 {
+	var v uint64
+	for _, c := range r.take(n) {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+// vector reads a variable-length field with an n-byte length prefix.
+func (r *tileReader) vector(n int) []byte {
+	return r.take(int(r.uint(n)))
+}
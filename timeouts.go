@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Adaptive timeouts follow adaptiveTimeoutFactor times the 95th percentile
+// of the last adaptiveTimeoutSamples response times, once there are at
+// least adaptiveTimeoutMinSamples, but never drop below
+// adaptiveTimeoutFloor.
+const (
+	adaptiveTimeoutSamples    = 100
+	adaptiveTimeoutMinSamples = 20
+	adaptiveTimeoutFactor     = 4
+	adaptiveTimeoutFloor      = 5 * time.Second
+)
+
+// timeoutTransport bounds every request to a log, from sending it to
+// reading the last byte of the response, by a deadline on the request's
+// context. With adaptive set, the deadline shrinks to what the log's
+// recent response times call for; timeout is always the ceiling.
+type timeoutTransport struct {
+	base     http.RoundTripper
+	timeout  time.Duration
+	adaptive bool
+
+	mu      sync.Mutex
+	samples []time.Duration // ring of the latest response times
+	next    int
+}
+
+func (t *timeoutTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	timeout := t.current()
+	ctx, cancel := context.WithTimeout(req.Context(), timeout)
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) && req.Context().Err() == nil {
+			err = fmt.Errorf("request timed out after %s: %w", timeout, err)
+		}
+		cancel()
+		return nil, err
+	}
+	resp.Body = &timedBody{ReadCloser: resp.Body, cancel: cancel, done: func() { t.observe(time.Since(start)) }}
+	return resp, nil
+}
+
+// current returns the timeout for the next request.
+func (t *timeoutTransport) current() time.Duration {
+	if !t.adaptive {
+		return t.timeout
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.samples) < adaptiveTimeoutMinSamples {
+		return t.timeout
+	}
+	sorted := slices.Clone(t.samples)
+	slices.Sort(sorted)
+	p95 := sorted[len(sorted)*95/100]
+	return min(max(adaptiveTimeoutFactor*p95, adaptiveTimeoutFloor), t.timeout)
+}
+
+// observe records the response time of a request whose response was read
+// to the end.
+func (t *timeoutTransport) observe(d time.Duration) {
+	if !t.adaptive {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.samples) < adaptiveTimeoutSamples {
+		t.samples = append(t.samples, d)
+		return
+	}
+	t.samples[t.next] = d
+	t.next = (t.next + 1) % adaptiveTimeoutSamples
+}
+
+// timedBody releases the request's deadline when the response body is
+// closed, and reports when it was read to the end.
+type timedBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+	done   func()
+	once   sync.Once
+}
+
+func (b *timedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.once.Do(b.done)
+	}
+	return n, err
+}
+
+func (b *timedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// newLogTransport returns a transport for a single log's monitor. Monitors
+// never share a transport: each has its own pool of idle connections and
+// its own connection limit, so one log's slow responses or large catch-up
+// fetches cannot exhaust connections another log needs.
+//
+// Certificates are verified for every new connection, so a log that
+// rotates its TLS certificate mid-run is picked up as connections are
+// replaced; with -tls-pins the pins are checked for each new connection as
+// well.
+func newLogTransport(cfg *config) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.MaxConnsPerHost = cfg.MaxConnsPerLog
+	t.MaxIdleConnsPerHost = max(cfg.MaxConnsPerLog, cfg.FetchConcurrency)
+	if cfg.MaxIdleConnsPerLog > 0 {
+		t.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerLog
+	}
+	t.IdleConnTimeout = cfg.IdleConnTimeout
+	t.DialContext = (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: cfg.KeepAlive}).DialContext
+	if cfg.pins != nil {
+		t.TLSClientConfig = &tls.Config{VerifyConnection: cfg.pins.verifyConnection}
+	}
+	return t
+}
+
+// logBaseURL returns the base URL the CT API paths (/ct/v1/...) are
+// appended to for a log URL as found in a log list or given on the command
+// line. Logs are often served under a path prefix (/logs/us1/argon2025h1/),
+// which is preserved, with or without its trailing slash. Older log lists
+// give URLs without a scheme, which are taken to be HTTPS, and a URL that
+// already ends in the API's /ct/v1 prefix has it removed so that it is not
+// doubled.
+func logBaseURL(raw string) (string, error) {
+	if !strings.Contains(raw, "://") {
+		raw = "https://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("invalid log URL: %w", err)
+	}
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return "", fmt.Errorf("invalid log URL %q: scheme must be http or https", raw)
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("invalid log URL %q: no host", raw)
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return "", fmt.Errorf("invalid log URL %q: must not have a query or fragment", raw)
+	}
+	path := strings.TrimSuffix(strings.TrimRight(u.EscapedPath(), "/"), "/ct/v1")
+	host := u.Host
+	if u.User != nil {
+		host = u.User.String() + "@" + host
+	}
+	return u.Scheme + "://" + host + path, nil
+}
+
+// errNotJSON is returned for a successful response that is an HTML page
+// rather than JSON, such as a proxy's or single sign-on gateway's login
+// page. The CT client would otherwise fail with an unhelpful JSON syntax
+// error.
+type errNotJSON struct {
+	status      int
+	contentType string
+}
+
+func (e errNotJSON) Error() string {
+	return fmt.Sprintf("log returned non-JSON (%s) with status %d, likely a proxy or authentication issue", e.contentType, e.status)
+}
+
+// jsonOnlyTransport turns successful HTML responses into errNotJSON. Only
+// HTML is rejected, since some logs serve JSON with a generic or missing
+// content type; error statuses are left to the CT client, which reports
+// them with their body.
+type jsonOnlyTransport struct {
+	base http.RoundTripper
+}
+
+func (t *jsonOnlyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp, err
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType == "text/html" || mediaType == "application/xhtml+xml" {
+		resp.Body.Close()
+		return nil, errNotJSON{status: resp.StatusCode, contentType: mediaType}
+	}
+	return resp, nil
+}
+
+// connStats counts, per log, how many requests reused a pooled connection
+// and how many had to open a new one, for -conn-stats.
+type connStats struct {
+	mu   sync.Mutex
+	logs map[string]*connCounts
+}
+
+type connCounts struct {
+	New    atomic.Uint64
+	Reused atomic.Uint64
+	// IdleNs is the total time reused connections had been idle.
+	IdleNs atomic.Int64
+}
+
+func newConnStats() *connStats {
+	return &connStats{logs: make(map[string]*connCounts)}
+}
+
+// forLog returns the counters of the log with the given description.
+func (s *connStats) forLog(name string) *connCounts {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.logs[name]
+	if !ok {
+		c = &connCounts{}
+		s.logs[name] = c
+	}
+	return c
+}
+
+// connStatsTransport records, through httptrace, whether each request got
+// a new or a reused connection.
+type connStatsTransport struct {
+	base   http.RoundTripper
+	counts *connCounts
+}
+
+func (t *connStatsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				t.counts.Reused.Add(1)
+				t.counts.IdleNs.Add(int64(info.IdleTime))
+			} else {
+				t.counts.New.Add(1)
+			}
+		},
+	}
+	return t.base.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+}
+
+// reportEvery logs the connection counts every interval until done is
+// closed.
+func (s *connStats) reportEvery(interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.report()
+		case <-done:
+			return
+		}
+	}
+}
+
+// report logs the connection counts of every log since startup.
+func (s *connStats) report() {
+	s.mu.Lock()
+	names := make([]string, 0, len(s.logs))
+	for name := range s.logs {
+		names = append(names, name)
+	}
+	s.mu.Unlock()
+	sort.Strings(names)
+	for _, name := range names {
+		c := s.forLog(name)
+		fresh, reused := c.New.Load(), c.Reused.Load()
+		var reusedPercent float64
+		var avgIdle time.Duration
+		if fresh+reused > 0 {
+			reusedPercent = 100 * float64(reused) / float64(fresh+reused)
+		}
+		if reused > 0 {
+			avgIdle = time.Duration(c.IdleNs.Load() / int64(reused))
+		}
+		log.Printf("Connection stats for %s: %d new, %d reused (%.1f%%), average idle time before reuse %s", name, fresh, reused, reusedPercent, avgIdle.Round(time.Millisecond))
+	}
+}
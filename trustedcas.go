@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/google/certificate-transparency-go/x509"
+)
+
+// trustedCAs is the set of CAs expected to issue certificates, for
+// -trusted-cas: certificates from any other issuer are the ones emitted.
+// A CA is identified by its subject distinguished name, as printed in the
+// Issuer field, or by its key identifier, which certificates it issues
+// carry as their authority key identifier.
+type trustedCAs struct {
+	subjects map[string]bool // lower-cased DNs
+	keyIDs   map[string]bool // lower-case hex
+}
+
+// loadTrustedCAs reads a -trusted-cas file. It may hold PEM CA
+// certificates, whose subject and key identifier are both trusted, and
+// lines with a subject DN (such as "CN=R3,O=Let's Encrypt,C=US") or a hex
+// key identifier, with or without colons. Blank lines and lines starting
+// with # are ignored.
+func loadTrustedCAs(path string) (*trustedCAs, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cas := &trustedCAs{subjects: make(map[string]bool), keyIDs: make(map[string]bool)}
+	var block []string // lines of the PEM block being read
+	for n, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "-----BEGIN"):
+			block = []string{line}
+			continue
+		case block != nil:
+			block = append(block, line)
+			if strings.HasPrefix(line, "-----END") {
+				if err := cas.addPEM(strings.Join(block, "\n")); err != nil {
+					return nil, fmt.Errorf("%s:%d: %w", path, n+1, err)
+				}
+				block = nil
+			}
+			continue
+		case line == "" || strings.HasPrefix(line, "#"):
+			continue
+		case strings.Contains(line, "="):
+			cas.subjects[strings.ToLower(line)] = true
+			continue
+		}
+		keyID, err := hex.DecodeString(strings.ReplaceAll(line, ":", ""))
+		if err != nil || len(keyID) == 0 {
+			return nil, fmt.Errorf("%s:%d: %q is neither a subject DN nor a hex key identifier", path, n+1, line)
+		}
+		cas.keyIDs[hex.EncodeToString(keyID)] = true
+	}
+	if len(cas.subjects) == 0 && len(cas.keyIDs) == 0 {
+		return nil, fmt.Errorf("%s lists no CAs", path)
+	}
+	return cas, nil
+}
+
+// addPEM trusts the CA certificate in a PEM block; other blocks are
+// ignored.
+func (c *trustedCAs) addPEM(text string) error {
+	block, _ := pem.Decode([]byte(text))
+	if block == nil {
+		return fmt.Errorf("invalid PEM block")
+	}
+	if block.Type != "CERTIFICATE" {
+		return nil
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if x509.IsFatal(err) {
+		return err
+	}
+	c.subjects[strings.ToLower(cert.Subject.String())] = true
+	if len(cert.SubjectKeyId) > 0 {
+		c.keyIDs[hex.EncodeToString(cert.SubjectKeyId)] = true
+	}
+	return nil
+}
+
+// trusts reports whether cert was issued by one of the CAs.
+func (c *trustedCAs) trusts(cert *x509.Certificate) bool {
+	if len(cert.AuthorityKeyId) > 0 && c.keyIDs[hex.EncodeToString(cert.AuthorityKeyId)] {
+		return true
+	}
+	return c.subjects[strings.ToLower(cert.Issuer.String())]
+}
+
+// trustedCAsFile is the -trusted-cas file, which is read again on SIGHUP.
+type trustedCAsFile struct {
+	path string
+	cas  atomic.Pointer[trustedCAs]
+}
+
+func openTrustedCAs(path string) (*trustedCAsFile, error) {
+	f := &trustedCAsFile{path: path}
+	if err := f.reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// reload reads the file again. On error the current CAs stay in force.
+func (f *trustedCAsFile) reload() error {
+	cas, err := loadTrustedCAs(f.path)
+	if err != nil {
+		return err
+	}
+	f.cas.Store(cas)
+	return nil
+}
+
+// trusts is trustedCAs.trusts for the current CAs.
+func (f *trustedCAsFile) trusts(cert *x509.Certificate) bool {
+	return f.cas.Load().trusts(cert)
+}
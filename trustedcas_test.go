@@ -0,0 +1,112 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/certificate-transparency-go/x509"
+	"github.com/google/certificate-transparency-go/x509/pkix"
+)
+
+func TestTrustedCAsReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trusted-cas.txt")
+	write := func(list string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(list), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r3 := &x509.Certificate{Issuer: pkix.Name{CommonName: "R3", Organization: []string{"Let's Encrypt"}}}
+	e1 := &x509.Certificate{Issuer: pkix.Name{CommonName: "E1", Organization: []string{"Let's Encrypt"}}}
+
+	write("CN=R3,O=Let's Encrypt\n")
+	cas, err := openTrustedCAs(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cas.trusts(r3) || cas.trusts(e1) {
+		t.Fatal("the CAs read do not match the file")
+	}
+
+	write("# R3 retired\nCN=E1,O=Let's Encrypt\n")
+	if err := cas.reload(); err != nil {
+		t.Fatal(err)
+	}
+	if cas.trusts(r3) || !cas.trusts(e1) {
+		t.Error("reload did not replace the CAs")
+	}
+
+	write("not a CA\n")
+	if err := cas.reload(); err == nil {
+		t.Error("reload of an invalid file succeeded")
+	}
+	if cas.trusts(r3) || !cas.trusts(e1) {
+		t.Error("a failed reload did not keep the current CAs")
+	}
+}
+
+func TestTrustedCAsFilter(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Internal CA", Organization: []string{"Example Corp"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		SubjectKeyId:          []byte{1, 2, 3, 4},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "trusted-cas.txt")
+	list := "# our CAs\n" + string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})) +
+		"CN=R3,O=Let's Encrypt,C=US\n" +
+		"AA:BB:CC:DD\n"
+	if err := os.WriteFile(path, []byte(list), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	issued := func(issuer pkix.Name, keyID []byte) *x509.Certificate {
+		return &x509.Certificate{Issuer: issuer, AuthorityKeyId: keyID, DNSNames: []string{"www.example.com"}}
+	}
+	tests := []struct {
+		name string
+		args []string
+		cert *x509.Certificate
+		want bool
+	}{
+		{"by a PEM CA's subject", nil, issued(pkix.Name{CommonName: "Internal CA", Organization: []string{"Example Corp"}}, nil), false},
+		{"by a PEM CA's key", nil, issued(pkix.Name{CommonName: "Renamed CA"}, []byte{1, 2, 3, 4}), false},
+		{"by a listed subject", nil, issued(pkix.Name{CommonName: "R3", Organization: []string{"Let's Encrypt"}, Country: []string{"US"}}, nil), false},
+		{"by a listed key", nil, issued(pkix.Name{CommonName: "Other"}, []byte{0xaa, 0xbb, 0xcc, 0xdd}), false},
+		{"by another CA", nil, issued(pkix.Name{CommonName: "Rogue CA"}, []byte{9, 9}), true},
+		{"by another CA with a known name", nil, issued(pkix.Name{CommonName: "R3"}, nil), true},
+		// Certificates from other CAs still go through the other filters.
+		{"by another CA, matching -match", []string{"-match=example\\.com$"}, issued(pkix.Name{CommonName: "Rogue CA"}, nil), true},
+		{"by another CA, not matching -match", []string{"-match=example\\.org$"}, issued(pkix.Name{CommonName: "Rogue CA"}, nil), false},
+		{"by another CA, excluded issuer", []string{"-exclude-issuer=Rogue"}, issued(pkix.Name{CommonName: "Rogue CA"}, nil), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _, err := parseTestFlags(t, append([]string{"-trusted-cas=" + path}, tt.args...)...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := passes(buildFilters(cfg), tt.cert); got != tt.want {
+				t.Errorf("passes = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
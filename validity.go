@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/certificate-transparency-go/x509"
+)
+
+const day = 24 * time.Hour
+
+// validityBuckets are the upper bounds of the -validity-stats histogram of
+// certificate lifetimes (notAfter - notBefore), placed around common
+// issuance policies: short-lived certificates, the CA/Browser Forum's
+// current and past maximums and the 90 days of ACME CAs.
+var validityBuckets = []struct {
+	label string
+	max   time.Duration
+}{
+	{"7d", 7 * day},
+	{"47d", 47 * day},
+	{"90d", 90 * day},
+	{"100d", 100 * day},
+	{"200d", 200 * day},
+	{"398d", 398 * day},
+	{"825d", 825 * day},
+}
+
+// validityOverflow labels the bucket of certificates longer-lived than the
+// last bound.
+const validityOverflow = "inf"
+
+// validityHistogram counts emitted certificates by lifetime. It is safe
+// for concurrent use.
+type validityHistogram struct {
+	counts []atomic.Uint64 // one per bucket, plus the overflow bucket
+}
+
+func newValidityHistogram() *validityHistogram {
+	return &validityHistogram{counts: make([]atomic.Uint64, len(validityBuckets)+1)}
+}
+
+// observe adds cert to the histogram and records it with the metrics sink
+// as validity.<bucket>.
+func (h *validityHistogram) observe(cert *x509.Certificate, logName string) {
+	lifetime := cert.NotAfter.Sub(cert.NotBefore)
+	i := 0
+	for i < len(validityBuckets) && lifetime > validityBuckets[i].max {
+		i++
+	}
+	h.counts[i].Add(1)
+	metrics.count(metricValidity+"."+validityLabel(i), 1, logName)
+}
+
+func validityLabel(i int) string {
+	if i == len(validityBuckets) {
+		return validityOverflow
+	}
+	return validityBuckets[i].label
+}
+
+// validityCount is one bucket of the histogram: the number of certificates
+// valid for at most Max (the bucket's label) and longer than the previous
+// bucket's.
+type validityCount struct {
+	Max   string `json:"max"`
+	Count uint64 `json:"count"`
+}
+
+// snapshot returns the current counts, shortest lifetimes first.
+func (h *validityHistogram) snapshot() []validityCount {
+	counts := make([]validityCount, len(h.counts))
+	for i := range h.counts {
+		counts[i] = validityCount{Max: validityLabel(i), Count: h.counts[i].Load()}
+	}
+	return counts
+}
+
+// report logs the histogram on one line.
+func (h *validityHistogram) report() {
+	counts := h.snapshot()
+	var total uint64
+	for _, c := range counts {
+		total += c.Count
+	}
+	var b strings.Builder
+	for i, c := range counts {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		percent := 0.0
+		if total > 0 {
+			percent = 100 * float64(c.Count) / float64(total)
+		}
+		fmt.Fprintf(&b, "<=%s %d (%.1f%%)", c.Max, c.Count, percent)
+	}
+	log.Printf("Validity of %d certificates: %s", total, b.String())
+}
+
+// reportEvery logs the histogram every interval until done is closed.
+func (h *validityHistogram) reportEvery(interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			h.report()
+		case <-done:
+			return
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"runtime"
+	"runtime/debug"
+	"slices"
+)
+
+// versionInfo is what -version reports about the build.
+type versionInfo struct {
+	Version string `json:"version"`
+	// Revision is the VCS commit the binary was built from, with
+	// "-dirty" appended when the tree had changes.
+	Revision  string        `json:"revision,omitempty"`
+	GoVersion string        `json:"go_version"`
+	Platform  string        `json:"platform"`
+	Sinks     []sinkSupport `json:"sinks"`
+}
+
+// sinkSupport says whether a sink is built into this binary, and whether
+// the flags given enable it.
+type sinkSupport struct {
+	Name      string `json:"name"`
+	Available bool   `json:"available"`
+	Enabled   bool   `json:"enabled"`
+}
+
+func buildVersion(cfg *config) versionInfo {
+	v := versionInfo{
+		Version:   "(devel)",
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if info.Main.Version != "" {
+			v.Version = info.Main.Version
+		}
+		var modified bool
+		for _, s := range info.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				v.Revision = s.Value
+			case "vcs.modified":
+				modified = s.Value == "true"
+			}
+		}
+		if v.Revision != "" && modified {
+			v.Revision += "-dirty"
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(sinkConfigured)) {
+		v.Sinks = append(v.Sinks, sinkSupport{
+			Name:      name,
+			Available: name != "syslog" || syslogSupported,
+			Enabled:   sinkConfigured[name](cfg),
+		})
+	}
+	return v
+}
+
+// printVersion writes the build's version to w for -version: one line, or
+// with asJSON a versionInfo for deployment tooling to check.
+func printVersion(w io.Writer, cfg *config, asJSON bool) error {
+	v := buildVersion(cfg)
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+	line := "certtail " + v.Version
+	if v.Revision != "" {
+		line += " (" + v.Revision + ")"
+	}
+	_, err := fmt.Fprintf(w, "%s %s %s\n", line, v.GoVersion, v.Platform)
+	return err
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// warnCoalescer keeps a failing log from flooding the output with the same
+// warning every tick: the first failure of a kind is logged as it happens,
+// and those that follow within the window are counted and summarized once
+// it has passed. It belongs to one monitor and is not safe for concurrent
+// use.
+type warnCoalescer struct {
+	window   time.Duration // 0 logs every failure
+	warnings map[string]*coalescedWarning
+}
+
+// coalescedWarning counts the failures of one kind since the last one that
+// was logged.
+type coalescedWarning struct {
+	logged   time.Time
+	repeated int
+	last     error
+}
+
+func newWarnCoalescer(window time.Duration) *warnCoalescer {
+	return &warnCoalescer{window: window, warnings: make(map[string]*coalescedWarning)}
+}
+
+// warn logs what failed with err, such as "Failed to get entries for
+// Argon2025h1", unless the same failure was logged within the window.
+func (c *warnCoalescer) warn(what string, err error, now time.Time) {
+	if c.window <= 0 {
+		log.Printf("%s: %v", what, err)
+		return
+	}
+	if w, ok := c.warnings[what]; ok {
+		if now.Sub(w.logged) < c.window {
+			w.repeated++
+			w.last = err
+			return
+		}
+		c.summarize(what, w, now)
+	}
+	log.Printf("%s: %v", what, err)
+	c.warnings[what] = &coalescedWarning{logged: now}
+}
+
+// flush summarizes the failures whose window has passed, so that a count is
+// reported even when the failures have stopped.
+func (c *warnCoalescer) flush(now time.Time) {
+	for what, w := range c.warnings {
+		if now.Sub(w.logged) >= c.window {
+			c.summarize(what, w, now)
+			delete(c.warnings, what)
+		}
+	}
+}
+
+func (c *warnCoalescer) summarize(what string, w *coalescedWarning, now time.Time) {
+	if w.repeated > 0 {
+		log.Printf("%s %d more times in the last %s, last: %v", what, w.repeated, now.Sub(w.logged).Round(time.Second), w.last)
+	}
+}
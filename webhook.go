@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// webhookMaxAttempts bounds how often a batch is posted before it is
+// dropped.
+const webhookMaxAttempts = 5
+
+// webhookRequestTimeout bounds each POST to the webhook.
+const webhookRequestTimeout = 30 * time.Second
+
+// webhookMaxRetryWait caps the wait before a retry, however long the
+// webhook's Retry-After asks for.
+const webhookMaxRetryWait = time.Minute
+
+// runWebhookSink posts every event from sub to cfg.Webhook until the
+// subscription is closed, as a JSON array of the events' documents, in
+// batches of cfg.WebhookBatch or of whatever arrived within
+// cfg.WebhookFlushInterval. Once done is closed, failed posts are no
+// longer retried. The returned channel is closed once the last batch has
+// been posted after the subscription closed.
+func runWebhookSink(cfg *config, sub *subscription, done <-chan struct{}) (<-chan struct{}, error) {
+	if !strings.HasPrefix(cfg.Webhook, "http://") && !strings.HasPrefix(cfg.Webhook, "https://") {
+		return nil, fmt.Errorf("webhook URL must start with http:// or https://")
+	}
+	client := &http.Client{Timeout: webhookRequestTimeout}
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(cfg.WebhookFlushInterval)
+		defer ticker.Stop()
+		var batch []json.RawMessage
+		flush := func() {
+			if len(batch) > 0 {
+				postWebhook(client, cfg.Webhook, batch, done)
+				batch = nil
+			}
+		}
+		for {
+			select {
+			case ev, ok := <-sub.C:
+				if !ok {
+					flush()
+					return
+				}
+				doc, err := json.Marshal(newESDocument(cfg, ev))
+				if err != nil {
+					log.Printf("Failed to encode event for -webhook: %v", err)
+					continue
+				}
+				batch = append(batch, doc)
+				if len(batch) >= cfg.WebhookBatch {
+					flush()
+				}
+			case <-ticker.C:
+				flush()
+			}
+		}
+	}()
+	return stopped, nil
+}
+
+// postWebhook posts docs, retrying with backoff when the request fails or
+// the webhook answers 429 or 5xx, waiting at least as long as its
+// Retry-After asks, up to webhookMaxRetryWait. Any other answer outside 2xx
+// would fail again, and the batch is dropped straight away. So is a batch
+// waiting for a retry when done is closed, so that shutdown does not wait
+// for the webhook.
+func postWebhook(client *http.Client, url string, docs []json.RawMessage, done <-chan struct{}) {
+	body, err := json.Marshal(docs)
+	if err != nil {
+		log.Printf("Failed to encode %d events for -webhook, dropping them: %v", len(docs), err)
+		return
+	}
+	backoff := time.Second
+	for attempt := 1; ; attempt++ {
+		retryAfter, retry, err := postWebhookOnce(client, url, body)
+		if err == nil {
+			return
+		}
+		if !retry || attempt == webhookMaxAttempts {
+			log.Printf("Failed to post %d events to -webhook, dropping them: %v", len(docs), err)
+			return
+		}
+		wait := min(max(backoff, retryAfter), webhookMaxRetryWait)
+		log.Printf("Failed to post %d events to -webhook, retrying in %s: %v", len(docs), wait, err)
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-done:
+			timer.Stop()
+			log.Printf("Dropping %d events for -webhook: shutting down", len(docs))
+			return
+		}
+		backoff *= 2
+	}
+}
+
+// postWebhookOnce sends one POST of body. On failure it reports whether the
+// request is worth retrying, and how long the webhook asked to wait.
+func postWebhookOnce(client *http.Client, url string, body []byte) (retryAfter time.Duration, retry bool, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookRequestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, true, err
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return 0, false, nil
+	}
+	err = fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < 500 {
+		return 0, false, err
+	}
+	retryAfter, _ = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	return retryAfter, true, err
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPostWebhookRetries(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var docs []json.RawMessage
+		if err := json.NewDecoder(r.Body).Decode(&docs); err != nil || len(docs) != 2 {
+			t.Errorf("got %d documents, %v; want 2", len(docs), err)
+		}
+	}))
+	defer srv.Close()
+
+	postWebhook(srv.Client(), srv.URL, []json.RawMessage{json.RawMessage(`{"a":1}`), json.RawMessage(`{"b":2}`)}, make(chan struct{}))
+	if got := requests.Load(); got != 2 {
+		t.Errorf("got %d requests, want 2", got)
+	}
+}
+
+func TestPostWebhookDropsRejected(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	postWebhook(srv.Client(), srv.URL, []json.RawMessage{json.RawMessage(`{}`)}, make(chan struct{}))
+	if got := requests.Load(); got != 1 {
+		t.Errorf("got %d requests, want 1: a 400 is not retried", got)
+	}
+}
+
+func TestPostWebhookRetryAfterDoesNotBlockShutdown(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "86400")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	done := make(chan struct{})
+	returned := make(chan struct{})
+	go func() {
+		postWebhook(srv.Client(), srv.URL, []json.RawMessage{json.RawMessage(`{}`)}, done)
+		close(returned)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	close(done)
+	select {
+	case <-returned:
+	case <-time.After(5 * time.Second):
+		t.Fatal("postWebhook still waiting for the webhook's Retry-After after shutdown")
+	}
+}